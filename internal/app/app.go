@@ -1,20 +1,30 @@
 package app
 
 import (
+	"context"
 	"encoding/base64"
+	"log"
 	"net/http"
 
 	"github.com/KimNattanan/go-user-service/internal/entity"
 	"github.com/KimNattanan/go-user-service/internal/middleware"
 	"github.com/KimNattanan/go-user-service/pkg/config"
 	"github.com/KimNattanan/go-user-service/pkg/database"
+	"github.com/KimNattanan/go-user-service/pkg/identity"
+	"github.com/KimNattanan/go-user-service/pkg/passwordhash"
+	"github.com/KimNattanan/go-user-service/pkg/passwordpolicy"
 	"github.com/KimNattanan/go-user-service/pkg/redisclient"
 	"github.com/KimNattanan/go-user-service/pkg/routes"
+	"github.com/KimNattanan/go-user-service/pkg/token"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
+	roleRepo "github.com/KimNattanan/go-user-service/internal/repo/role"
+	userRepo "github.com/KimNattanan/go-user-service/internal/repo/user"
+	roleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/role"
+
 	_ "github.com/KimNattanan/go-user-service/docs"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 )
@@ -31,14 +41,42 @@ func SetupDependencies(env string) (*config.Config, *gorm.DB, *redis.Client, ses
 		db.Migrator().DropTable(
 			&entity.User{},
 			&entity.Preference{},
+			&entity.RecoveryCode{},
+			&entity.PasskeyCredential{},
+			&entity.APIKey{},
+			&entity.Identity{},
+			&entity.PasswordHistory{},
+			&entity.AuditEvent{},
+			&entity.OAuthClient{},
+			&entity.OAuthConsent{},
+			&entity.ServiceAccount{},
+			&entity.ServiceAccountSecret{},
+			&entity.Role{},
+			&entity.UserRole{},
 		)
 	}
 	if err := db.Migrator().AutoMigrate(
 		&entity.User{},
 		&entity.Preference{},
+		&entity.RecoveryCode{},
+		&entity.PasskeyCredential{},
+		&entity.APIKey{},
+		&entity.Identity{},
+		&entity.PasswordHistory{},
+		&entity.AuditEvent{},
+		&entity.OAuthClient{},
+		&entity.OAuthConsent{},
+		&entity.ServiceAccount{},
+		&entity.ServiceAccountSecret{},
+		&entity.Role{},
+		&entity.UserRole{},
 	); err != nil {
 		return nil, nil, nil, nil, err
 	}
+	roleUsecase := roleUsecase.NewRoleUsecase(roleRepo.NewRoleRepo(db), userRepo.NewUserRepo(db), cfg)
+	if err := roleUsecase.Seed(context.Background()); err != nil {
+		return nil, nil, nil, nil, err
+	}
 
 	rdb := redisclient.Connect(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB)
 
@@ -58,10 +96,30 @@ func SetupDependencies(env string) (*config.Config, *gorm.DB, *redis.Client, ses
 }
 
 func SetupRestServer(db *gorm.DB, rdb *redis.Client, sessionStore sessions.Store, cfg *config.Config) *mux.Router {
+	providers, err := identity.NewRegistry(cfg.IdentityProviders)
+	if err != nil {
+		log.Fatalf("invalid identity provider config: %v", err)
+	}
+	passwordPolicy, err := passwordpolicy.New(cfg)
+	if err != nil {
+		log.Fatalf("invalid password policy config: %v", err)
+	}
+	passwordHasher, err := passwordhash.NewHasher(cfg)
+	if err != nil {
+		log.Fatalf("invalid password hashing config: %v", err)
+	}
+	keyring, err := token.NewKeyring(cfg)
+	if err != nil {
+		log.Fatalf("invalid JWT signing key config: %v", err)
+	}
+	go keyring.Run(context.Background())
+	jwtMaker := token.NewJWTMaker(keyring, cfg.JWTIssuer)
+
 	r := mux.NewRouter()
+	r.Use(middleware.RealIP(cfg.TrustProxyHeaders))
 	r.Use(middleware.CORS)
-	routes.RegisterPublicRoutes(r, db, rdb, sessionStore, cfg)
-	routes.RegisterPrivateRoutes(r, db, rdb, sessionStore, cfg)
+	routes.RegisterPublicRoutes(r, db, rdb, sessionStore, providers, passwordPolicy, passwordHasher, jwtMaker, cfg)
+	routes.RegisterPrivateRoutes(r, db, rdb, sessionStore, providers, passwordPolicy, passwordHasher, jwtMaker, cfg)
 	routes.RegisterNotFoundRoute(r)
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 	return r
@@ -0,0 +1,33 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+type LockoutResponse struct {
+	UserID        string     `json:"user_id"`
+	Email         string     `json:"email"`
+	Failures      int        `json:"failures"`
+	Locked        bool       `json:"locked"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+}
+
+func ToLockoutResponse(user *entity.User, throttle *entity.LoginThrottle) *LockoutResponse {
+	now := time.Now()
+	res := &LockoutResponse{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Failures: throttle.Failures,
+	}
+	if throttle.LockedUntil.After(now) {
+		res.Locked = true
+		res.LockedUntil = &throttle.LockedUntil
+	}
+	if throttle.NextAttemptAt.After(now) {
+		res.NextAttemptAt = &throttle.NextAttemptAt
+	}
+	return res
+}
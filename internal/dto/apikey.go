@@ -0,0 +1,45 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" valid:"required,length(1|64)"`
+	Scopes    []string   `json:"scopes" valid:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Key        string     `json:"key,omitempty"` // only set when the key is created
+}
+
+func ToAPIKeyResponse(apiKey *entity.APIKey, key string) *APIKeyResponse {
+	return &APIKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		CreatedAt:  apiKey.CreatedAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		ExpiresAt:  apiKey.ExpiresAt,
+		Key:        key,
+	}
+}
+
+func ToAPIKeyResponseList(apiKeys []*entity.APIKey) []*APIKeyResponse {
+	apiKeyResponses := make([]*APIKeyResponse, len(apiKeys))
+	for i, apiKey := range apiKeys {
+		apiKeyResponses[i] = ToAPIKeyResponse(apiKey, "")
+	}
+	return apiKeyResponses
+}
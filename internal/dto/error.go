@@ -0,0 +1,8 @@
+package dto
+
+import "github.com/KimNattanan/go-user-service/pkg/apperror"
+
+type ValidationErrorResponse struct {
+	Error  string                           `json:"error"`
+	Fields map[string][]apperror.FieldError `json:"fields"`
+}
@@ -0,0 +1,33 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+type IdentityResponse struct {
+	ID          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	LinkedAt    time.Time  `json:"linked_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+func ToIdentityResponse(identity *entity.Identity) *IdentityResponse {
+	return &IdentityResponse{
+		ID:          identity.ID,
+		Provider:    identity.Provider,
+		Email:       identity.Email,
+		LinkedAt:    identity.LinkedAt,
+		LastLoginAt: identity.LastLoginAt,
+	}
+}
+
+func ToIdentityResponseList(identities []*entity.Identity) []*IdentityResponse {
+	identityResponses := make([]*IdentityResponse, len(identities))
+	for i, identity := range identities {
+		identityResponses[i] = ToIdentityResponse(identity)
+	}
+	return identityResponses
+}
@@ -0,0 +1,158 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+// IntrospectionResponse is the RFC 7662 introspection response. Inactive
+// tokens only report active=false.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	TokenType string `json:"token_type,omitempty"` // access_token or refresh_token
+	Subject   string `json:"sub,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	Actor     *Actor `json:"act,omitempty"` // admin impersonating the subject
+	Issuer    string `json:"iss,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// Actor is the act claim of RFC 8693.
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+func ToIntrospectionResponse(introspection *entity.TokenIntrospection) *IntrospectionResponse {
+	if !introspection.Active {
+		return &IntrospectionResponse{Active: false}
+	}
+	response := &IntrospectionResponse{
+		Active:    true,
+		TokenType: introspection.TokenType,
+		Subject:   introspection.Subject,
+		SessionID: introspection.SessionID,
+		ClientID:  introspection.ClientID,
+		Scope:     introspection.Scope,
+		Issuer:    introspection.Issuer,
+		TokenID:   introspection.TokenID,
+		IssuedAt:  introspection.IssuedAt.Unix(),
+		ExpiresAt: introspection.ExpiresAt.Unix(),
+	}
+	if introspection.Actor != "" {
+		response.Actor = &Actor{Subject: introspection.Actor}
+	}
+	return response
+}
+
+// OAuthErrorResponse is the error body of the OAuth endpoints (RFC 6749
+// section 5.2).
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthTokenResponse is the token endpoint response (RFC 6749 section 5.1).
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // in seconds
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+func ToOAuthTokenResponse(tokens *entity.OAuthTokens) *OAuthTokenResponse {
+	return &OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(tokens.AccessTokenExpiresAt).Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        tokens.Scope,
+	}
+}
+
+// ToServiceAccountTokenResponse answers the client credentials grant, which
+// comes without a refresh token.
+func ToServiceAccountTokenResponse(token *entity.ServiceAccountToken) *OAuthTokenResponse {
+	return &OAuthTokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(token.ExpiresAt).Seconds()),
+		Scope:       token.Scope,
+	}
+}
+
+type ConsentClientResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ConsentRequestResponse is what the consent screen shows the user.
+type ConsentRequestResponse struct {
+	ID     string                 `json:"id"`
+	Client *ConsentClientResponse `json:"client"`
+	Scopes []string               `json:"scopes"`
+}
+
+func ToConsentRequestResponse(req *entity.ConsentRequest) *ConsentRequestResponse {
+	return &ConsentRequestResponse{
+		ID:     req.ID,
+		Client: &ConsentClientResponse{ID: req.Client.ID, Name: req.Client.Name},
+		Scopes: req.Scopes,
+	}
+}
+
+type ConsentDecisionRequest struct {
+	Allow bool `json:"allow"`
+}
+
+// RedirectResponse tells the consent screen where to send the browser next.
+type RedirectResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" valid:"required"`
+	RedirectURIs []string `json:"redirect_uris" valid:"required"`
+	Scopes       []string `json:"scopes"`
+	FirstParty   bool     `json:"first_party"`
+	Confidential bool     `json:"confidential"`
+}
+
+type OAuthClientResponse struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	FirstParty   bool      `json:"first_party"`
+	Confidential bool      `json:"confidential"`
+	ClientSecret string    `json:"client_secret,omitempty"` // only returned when the client is created
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func ToOAuthClientResponse(client *entity.OAuthClient, secret string) *OAuthClientResponse {
+	return &OAuthClientResponse{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		FirstParty:   client.FirstParty,
+		Confidential: !client.Public(),
+		ClientSecret: secret,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+func ToOAuthClientResponseList(clients []*entity.OAuthClient) []*OAuthClientResponse {
+	clientResponses := make([]*OAuthClientResponse, len(clients))
+	for i, client := range clients {
+		clientResponses[i] = ToOAuthClientResponse(client, "")
+	}
+	return clientResponses
+}
@@ -0,0 +1,58 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+type PasskeyRegistrationBeginResponse struct {
+	CeremonyID string                       `json:"ceremony_id"`
+	Options    *protocol.CredentialCreation `json:"options" swaggertype:"object"`
+}
+
+type PasskeyRegistrationFinishRequest struct {
+	CeremonyID string          `json:"ceremony_id" valid:"required"`
+	Name       string          `json:"name" valid:"length(0|64)"`
+	Credential json.RawMessage `json:"credential" swaggertype:"object"`
+}
+
+type PasskeyLoginBeginResponse struct {
+	CeremonyID string                        `json:"ceremony_id"`
+	Options    *protocol.CredentialAssertion `json:"options" swaggertype:"object"`
+}
+
+type PasskeyLoginFinishRequest struct {
+	CeremonyID string          `json:"ceremony_id" valid:"required"`
+	Credential json.RawMessage `json:"credential" swaggertype:"object"`
+}
+
+type PasskeyRenameRequest struct {
+	Name string `json:"name" valid:"required,length(1|64)"`
+}
+
+type PasskeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func ToPasskeyResponse(passkey *entity.PasskeyCredential) *PasskeyResponse {
+	return &PasskeyResponse{
+		ID:         passkey.ID,
+		Name:       passkey.Name,
+		CreatedAt:  passkey.CreatedAt,
+		LastUsedAt: passkey.LastUsedAt,
+	}
+}
+
+func ToPasskeyResponseList(passkeys []*entity.PasskeyCredential) []*PasskeyResponse {
+	passkeyResponses := make([]*PasskeyResponse, len(passkeys))
+	for i, passkey := range passkeys {
+		passkeyResponses[i] = ToPasskeyResponse(passkey)
+	}
+	return passkeyResponses
+}
@@ -0,0 +1,44 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+type SaveRoleRequest struct {
+	Description string   `json:"description" valid:"length(0|256)"`
+	Permissions []string `json:"permissions" valid:"required"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" valid:"required"`
+}
+
+type RoleResponse struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	BuiltIn     bool      `json:"built_in"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func ToRoleResponse(role *entity.Role) *RoleResponse {
+	return &RoleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		BuiltIn:     role.Name == entity.RoleAdmin,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}
+}
+
+func ToRoleResponseList(roles []*entity.Role) []*RoleResponse {
+	roleResponses := make([]*RoleResponse, len(roles))
+	for i, role := range roles {
+		roleResponses[i] = ToRoleResponse(role)
+	}
+	return roleResponses
+}
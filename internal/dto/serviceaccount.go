@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+type CreateServiceAccountRequest struct {
+	Name   string   `json:"name" valid:"required"`
+	Scopes []string `json:"scopes" valid:"required"`
+}
+
+type RotateServiceAccountSecretRequest struct {
+	OverlapSeconds *int `json:"overlap_seconds"` // defaults to SERVICE_ACCOUNT_SECRET_OVERLAP; 0 retires the old secrets at once
+}
+
+type ServiceAccountSecretResponse struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type ServiceAccountResponse struct {
+	ID           string                          `json:"id"`
+	Name         string                          `json:"name"`
+	Scopes       []string                        `json:"scopes"`
+	Secrets      []*ServiceAccountSecretResponse `json:"secrets"`
+	ClientSecret string                          `json:"client_secret,omitempty"` // only returned when the secret is created
+	CreatedAt    time.Time                       `json:"created_at"`
+}
+
+// ServiceAccountSecretCreatedResponse returns a rotated secret, which is
+// shown only once.
+type ServiceAccountSecretCreatedResponse struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// ToServiceAccountResponse lists the account's secrets that still work.
+func ToServiceAccountResponse(account *entity.ServiceAccount, secret string) *ServiceAccountResponse {
+	now := time.Now()
+	secrets := []*ServiceAccountSecretResponse{}
+	for _, s := range account.Secrets {
+		if s.Active(now) {
+			secrets = append(secrets, &ServiceAccountSecretResponse{ID: s.ID, CreatedAt: s.CreatedAt, ExpiresAt: s.ExpiresAt})
+		}
+	}
+	return &ServiceAccountResponse{
+		ID:           account.ID,
+		Name:         account.Name,
+		Scopes:       account.Scopes,
+		Secrets:      secrets,
+		ClientSecret: secret,
+		CreatedAt:    account.CreatedAt,
+	}
+}
+
+func ToServiceAccountResponseList(accounts []*entity.ServiceAccount) []*ServiceAccountResponse {
+	accountResponses := make([]*ServiceAccountResponse, len(accounts))
+	for i, account := range accounts {
+		accountResponses[i] = ToServiceAccountResponse(account, "")
+	}
+	return accountResponses
+}
@@ -0,0 +1,45 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Provider   string    `json:"provider,omitempty"`
+	ClientID   string    `json:"client_id,omitempty"` // OAuth client the session was granted to
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func ToSessionResponse(session *entity.Session, currentSessionID string) *SessionResponse {
+	lastUsedAt := session.LastUsedAt
+	if lastUsedAt.IsZero() {
+		lastUsedAt = session.CreatedAt
+	}
+	return &SessionResponse{
+		ID:         session.ID,
+		Provider:   session.Provider,
+		ClientID:   session.ClientID,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IPAddress,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: lastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.ID == currentSessionID,
+	}
+}
+
+func ToSessionResponseList(sessions []*entity.Session, currentSessionID string) []*SessionResponse {
+	sessionResponses := make([]*SessionResponse, len(sessions))
+	for i, session := range sessions {
+		sessionResponses[i] = ToSessionResponse(session, currentSessionID)
+	}
+	return sessionResponses
+}
@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" valid:"required"`
+}
+
+// TokenResponse is returned instead of the session cookie to clients that
+// sign in with auth_mode=bearer.
+type TokenResponse struct {
+	TokenType             string `json:"token_type"`
+	AccessToken           string `json:"access_token"`
+	ExpiresIn             int    `json:"expires_in"` // in seconds
+	RefreshToken          string `json:"refresh_token"`
+	RefreshTokenExpiresIn int    `json:"refresh_token_expires_in"` // in seconds
+}
+
+func ToTokenResponse(tokens *entity.TokenPair) *TokenResponse {
+	return &TokenResponse{
+		TokenType:             "Bearer",
+		AccessToken:           tokens.AccessToken,
+		ExpiresIn:             int(time.Until(tokens.AccessTokenExpiresAt).Seconds()),
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresIn: int(time.Until(tokens.RefreshTokenExpiresAt).Seconds()),
+	}
+}
@@ -3,12 +3,14 @@ package dto
 import "github.com/KimNattanan/go-user-service/internal/entity"
 
 type UserResponse struct {
-	Email      string `json:"email"`
-	Name       string `json:"name"`
-	FirstName  string `json:"first_name"`
-	LastName   string `json:"last_name"`
-	PictureURL string `json:"picture_url"`
-	Preference *PreferenceResponse
+	Email         string `json:"email"`
+	Name          string `json:"name"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	PictureURL    string `json:"picture_url"`
+	EmailVerified bool   `json:"email_verified"`
+	MFAEnabled    bool   `json:"mfa_enabled"`
+	Preference    *PreferenceResponse
 }
 
 type UserUpdateRequest struct {
@@ -32,14 +34,49 @@ type LoginRequest struct {
 	Password string `json:"password" valid:"required"`
 }
 
+type VerifyEmailRequest struct {
+	Token string `json:"token" valid:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" valid:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" valid:"required,email"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" valid:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" valid:"required"`
+	Password string `json:"password" valid:"required"`
+}
+
+type EmailLoginStartRequest struct {
+	Email  string `json:"email" valid:"required,email"`
+	Method string `json:"method" valid:"in(link|code)"`
+}
+
+type EmailLoginCompleteRequest struct {
+	Email string `json:"email" valid:"required,email"`
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
 func ToUserResponse(user *entity.User) *UserResponse {
 	return &UserResponse{
-		Email:      user.Email,
-		Name:       user.Name,
-		FirstName:  user.FirstName,
-		LastName:   user.LastName,
-		PictureURL: user.PictureURL,
-		Preference: ToPreferenceResponse(&user.Preference),
+		Email:         user.Email,
+		Name:          user.Name,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		PictureURL:    user.PictureURL,
+		EmailVerified: user.EmailVerified,
+		MFAEnabled:    user.TOTPEnabled,
+		Preference:    ToPreferenceResponse(&user.Preference),
 	}
 }
 
@@ -0,0 +1,87 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+)
+
+type AdminUserUpdateRequest struct {
+	Email         string `json:"email,omitempty" valid:"email"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	FirstName     string `json:"first_name,omitempty"`
+	LastName      string `json:"last_name,omitempty"`
+	PictureURL    string `json:"picture_url,omitempty" valid:"url"`
+}
+
+type AdminUserResponse struct {
+	ID                    string     `json:"id"`
+	Email                 string     `json:"email"`
+	Name                  string     `json:"name"`
+	FirstName             string     `json:"first_name"`
+	LastName              string     `json:"last_name"`
+	PictureURL            string     `json:"picture_url"`
+	EmailVerified         bool       `json:"email_verified"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at"`
+	MFAEnabled            bool       `json:"mfa_enabled"`
+	HasPassword           bool       `json:"has_password"`
+	Disabled              bool       `json:"disabled"`
+	DisabledAt            *time.Time `json:"disabled_at"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+}
+
+type AdminUserListResponse struct {
+	Users    []*AdminUserResponse `json:"users"`
+	Total    int64                `json:"total"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"page_size"`
+}
+
+type AdminUserDetailResponse struct {
+	AdminUserResponse
+	Preference *PreferenceResponse `json:"preference"`
+	Identities []*IdentityResponse `json:"identities"`
+	Sessions   []*SessionResponse  `json:"sessions"`
+}
+
+func ToAdminUserResponse(user *entity.User) *AdminUserResponse {
+	return &AdminUserResponse{
+		ID:                    user.ID,
+		Email:                 user.Email,
+		Name:                  user.Name,
+		FirstName:             user.FirstName,
+		LastName:              user.LastName,
+		PictureURL:            user.PictureURL,
+		EmailVerified:         user.EmailVerified,
+		EmailVerifiedAt:       user.EmailVerifiedAt,
+		MFAEnabled:            user.TOTPEnabled,
+		HasPassword:           user.Password != "",
+		Disabled:              user.Disabled,
+		DisabledAt:            user.DisabledAt,
+		PasswordResetRequired: user.PasswordResetRequired,
+	}
+}
+
+func ToAdminUserListResponse(page *usecase.UserPage) *AdminUserListResponse {
+	userResponses := make([]*AdminUserResponse, len(page.Users))
+	for i, user := range page.Users {
+		userResponses[i] = ToAdminUserResponse(user)
+	}
+	return &AdminUserListResponse{
+		Users:    userResponses,
+		Total:    page.Total,
+		Page:     page.Page,
+		PageSize: page.PageSize,
+	}
+}
+
+func ToAdminUserDetailResponse(details *usecase.UserDetails) *AdminUserDetailResponse {
+	return &AdminUserDetailResponse{
+		AdminUserResponse: *ToAdminUserResponse(details.User),
+		Preference:        ToPreferenceResponse(&details.User.Preference),
+		Identities:        ToIdentityResponseList(details.Identities),
+		Sessions:          ToSessionResponseList(details.Sessions, ""),
+	}
+}
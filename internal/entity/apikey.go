@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Scopes an API key may be granted. Each one covers a single /me route.
+const (
+	ScopeProfileRead      = "profile:read"
+	ScopeProfileWrite     = "profile:write"
+	ScopePreferencesRead  = "preferences:read"
+	ScopePreferencesWrite = "preferences:write"
+)
+
+// APIKeyScopes are the scopes API keys may be granted.
+var APIKeyScopes = []string{ScopeProfileRead, ScopeProfileWrite, ScopePreferencesRead, ScopePreferencesWrite}
+
+// APIKey is a long-lived personal credential for scripting against the
+// user's own account. Only a hash of the key is stored; Prefix identifies it
+// in listings and is used to look it up.
+type APIKey struct {
+	ID         string     `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     string     `gorm:"type:uuid;index" json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `gorm:"uniqueIndex" json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+func (k *APIKey) BeforeCreate(db *gorm.DB) (err error) {
+	k.ID = uuid.New().String()
+	return
+}
+
+// Expired reports whether the key has passed its expiry, if it has one.
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	AuditEventRefreshTokenReuse = "refresh_token_reuse"
+
+	AuditEventAdminUserViewed          = "admin_user_viewed"
+	AuditEventAdminUserUpdated         = "admin_user_updated"
+	AuditEventAdminUserDisabled        = "admin_user_disabled"
+	AuditEventAdminUserEnabled         = "admin_user_enabled"
+	AuditEventAdminPasswordResetForced = "admin_password_reset_forced"
+	AuditEventAdminSessionsRevoked     = "admin_sessions_revoked"
+	AuditEventAdminUserDeleted         = "admin_user_deleted"
+	AuditEventAdminUserUnlocked        = "admin_user_unlocked"
+	AuditEventAdminRoleAssigned        = "admin_role_assigned"
+	AuditEventAdminRoleUnassigned      = "admin_role_unassigned"
+
+	AuditEventImpersonationStarted = "impersonation_started"
+	AuditEventImpersonationEnded   = "impersonation_ended"
+	AuditEventImpersonatedRequest  = "impersonated_request"
+)
+
+// AuditEvent is a security-relevant event in a user's account. Events are
+// kept after the user is deleted.
+type AuditEvent struct {
+	ID        string            `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    string            `gorm:"type:uuid;index" json:"user_id"`
+	ActorID   *string           `gorm:"type:uuid;index" json:"actor_id,omitempty"` // admin or service account acting on the user, nil for the user's own events
+	ActorType string            `json:"actor_type,omitempty"`
+	Type      string            `gorm:"index" json:"type"`
+	IPAddress string            `json:"ip_address,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Details   map[string]string `gorm:"serializer:json" json:"details,omitempty"`
+	CreatedAt time.Time         `gorm:"index" json:"created_at"`
+}
+
+func (e *AuditEvent) BeforeCreate(db *gorm.DB) (err error) {
+	e.ID = uuid.New().String()
+	return
+}
+
+// Actor is who performs an action on another user's account, and from where.
+type Actor struct {
+	ID        string
+	Type      string
+	IPAddress string
+	UserAgent string
+}
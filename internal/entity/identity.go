@@ -0,0 +1,24 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Identity links an account at an external identity provider to a user.
+type Identity struct {
+	ID          string     `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      string     `gorm:"type:uuid;index" json:"user_id"`
+	Provider    string     `gorm:"uniqueIndex:idx_identities_provider_subject" json:"provider"`
+	Subject     string     `gorm:"uniqueIndex:idx_identities_provider_subject" json:"subject"`
+	Email       string     `json:"email"`
+	LinkedAt    time.Time  `gorm:"autoCreateTime" json:"linked_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+func (i *Identity) BeforeCreate(db *gorm.DB) (err error) {
+	i.ID = uuid.New().String()
+	return
+}
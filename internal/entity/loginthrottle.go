@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// LoginThrottle tracks recent failed password logins for one email address
+// or client IP. It lives in Redis and disappears once the failure window and
+// any lock have passed.
+type LoginThrottle struct {
+	Failures      int       `json:"failures"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
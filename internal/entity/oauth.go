@@ -0,0 +1,126 @@
+package entity
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// SupportedScopes are the scopes clients may be allowed to request.
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// OAuthClient is an application that signs users in through this service's
+// authorization server. Confidential clients authenticate with a secret,
+// public clients (SPAs, mobile apps) only with PKCE.
+type OAuthClient struct {
+	ID           string    `gorm:"type:uuid;primaryKey" json:"id"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"-"`
+	RedirectURIs []string  `gorm:"serializer:json" json:"redirect_uris"`
+	Scopes       []string  `gorm:"serializer:json" json:"scopes"` // scopes the client may request
+	FirstParty   bool      `gorm:"default:false" json:"first_party"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	Consents []OAuthConsent `gorm:"foreignKey:ClientID;constraint:onDelete:CASCADE" json:"-"`
+}
+
+func (c *OAuthClient) BeforeCreate(db *gorm.DB) (err error) {
+	c.ID = uuid.New().String()
+	return
+}
+
+func (c *OAuthClient) Public() bool {
+	return c.SecretHash == ""
+}
+
+// OAuthConsent records the scopes a user allowed a client, so they are only
+// asked again when the client wants more.
+type OAuthConsent struct {
+	ID        string    `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    string    `gorm:"type:uuid;uniqueIndex:idx_oauth_consent_user_client" json:"user_id"`
+	ClientID  string    `gorm:"type:uuid;uniqueIndex:idx_oauth_consent_user_client" json:"client_id"`
+	Scopes    []string  `gorm:"serializer:json" json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (c *OAuthConsent) BeforeCreate(db *gorm.DB) (err error) {
+	c.ID = uuid.New().String()
+	return
+}
+
+// Covers reports whether every scope was already granted.
+func (c *OAuthConsent) Covers(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthorizationRequest holds the parameters of an /oauth/authorize request.
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func (r *AuthorizationRequest) Scopes() []string {
+	return strings.Fields(r.Scope)
+}
+
+// ConsentRequest is an authorization request waiting for the user to allow
+// or deny it.
+type ConsentRequest struct {
+	ID     string
+	Client *OAuthClient
+	Scopes []string
+}
+
+// TokenRequest holds the parameters of an /oauth/token request.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	UserAgent    string
+	IPAddress    string
+}
+
+// OAuthTokens is the result of a token request. IDToken is only set when the
+// openid scope was granted.
+type OAuthTokens struct {
+	*TokenPair
+	IDToken string
+	Scope   string
+}
+
+// UserInfo holds the claims about a user a client may see with its scopes.
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+}
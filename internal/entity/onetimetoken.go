@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+type OneTimeToken struct {
+	Hash      string            `json:"hash"`
+	Purpose   string            `json:"purpose"`
+	UserID    string            `json:"user_id"`
+	Email     string            `json:"email"`
+	Data      map[string]string `json:"data,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailLogin        = "email_login"
+	TokenPurposeMFAChallenge      = "mfa_challenge"
+	TokenPurposePasskeyRegister   = "passkey_registration"
+	TokenPurposePasskeyLogin      = "passkey_login"
+	TokenPurposeOAuthState        = "oauth_state"
+	TokenPurposeOAuthCode         = "oauth_code"
+	TokenPurposeOAuthConsent      = "oauth_consent"
+)
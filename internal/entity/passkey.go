@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PasskeyCredential struct {
+	ID           string     `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID       string     `gorm:"type:uuid;index" json:"user_id"`
+	Name         string     `json:"name"`
+	CredentialID []byte     `gorm:"uniqueIndex" json:"-"`
+	Credential   []byte     `json:"-"` // JSON encoded webauthn credential record
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+}
+
+func (c *PasskeyCredential) BeforeCreate(db *gorm.DB) (err error) {
+	c.ID = uuid.New().String()
+	return
+}
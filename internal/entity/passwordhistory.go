@@ -0,0 +1,22 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasswordHistory keeps the hash of a password the user has set, so that the
+// last few cannot be chosen again.
+type PasswordHistory struct {
+	ID           string    `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID       string    `gorm:"type:uuid;index" json:"user_id"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (h *PasswordHistory) BeforeCreate(db *gorm.DB) (err error) {
+	h.ID = uuid.New().String()
+	return
+}
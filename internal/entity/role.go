@@ -0,0 +1,49 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Permissions guard the admin API. Roles bundle them for users, and service
+// accounts are granted them directly as scopes.
+const (
+	PermissionUsersRead        = "users:read"        // user directory and lockout state
+	PermissionUsersWrite       = "users:write"       // edit, disable and sign out users, clear lockouts
+	PermissionUsersDelete      = "users:delete"      // hard delete users
+	PermissionUsersImpersonate = "users:impersonate" // sign in as a user, read-only
+	PermissionRolesManage      = "roles:manage"      // define roles and assign them
+	PermissionClientsManage    = "clients:manage"    // OAuth clients and service accounts
+)
+
+// Permissions are all known permissions.
+var Permissions = []string{PermissionUsersRead, PermissionUsersWrite, PermissionUsersDelete, PermissionUsersImpersonate, PermissionRolesManage, PermissionClientsManage}
+
+// RoleAdmin is the built-in role holding every permission. It is created at
+// startup and cannot be changed or deleted.
+const RoleAdmin = "admin"
+
+type Role struct {
+	ID          string    `gorm:"type:uuid;primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex" json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `gorm:"serializer:json" json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Assignments []UserRole `gorm:"foreignKey:RoleID;constraint:onDelete:CASCADE" json:"-"`
+}
+
+func (r *Role) BeforeCreate(db *gorm.DB) (err error) {
+	r.ID = uuid.New().String()
+	return
+}
+
+// UserRole assigns a role to a user.
+type UserRole struct {
+	UserID    string    `gorm:"type:uuid;primaryKey" json:"user_id"`
+	RoleID    string    `gorm:"type:uuid;primaryKey;index" json:"role_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
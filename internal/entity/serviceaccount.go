@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ServiceAccountScopes are the scopes service accounts may be granted: the
+// permissions of the admin API.
+var ServiceAccountScopes = Permissions
+
+// ServiceAccount is a non-human principal, such as a backend job, that
+// authenticates with the client credentials grant. Its ID is the client_id.
+type ServiceAccount struct {
+	ID        string    `gorm:"type:uuid;primaryKey" json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `gorm:"serializer:json" json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Secrets []ServiceAccountSecret `gorm:"foreignKey:ServiceAccountID;constraint:onDelete:CASCADE" json:"-"`
+}
+
+func (a *ServiceAccount) BeforeCreate(db *gorm.DB) (err error) {
+	a.ID = uuid.New().String()
+	return
+}
+
+// ServiceAccountSecret is a hashed client secret. An account has several
+// while a rotation is in progress: the replaced ones expire after the
+// overlap, so jobs can switch to the new secret without downtime.
+type ServiceAccountSecret struct {
+	ID               string     `gorm:"type:uuid;primaryKey" json:"id"`
+	ServiceAccountID string     `gorm:"type:uuid;index" json:"service_account_id"`
+	Hash             string     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ExpiresAt        *time.Time `json:"expires_at"` // nil until the secret is rotated
+}
+
+func (s *ServiceAccountSecret) BeforeCreate(db *gorm.DB) (err error) {
+	s.ID = uuid.New().String()
+	return
+}
+
+func (s *ServiceAccountSecret) Active(now time.Time) bool {
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// ServiceAccountToken is an access token issued with the client credentials
+// grant. It comes without a refresh token; jobs request a new one instead.
+type ServiceAccountToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+	Scope       string
+}
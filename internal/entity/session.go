@@ -2,11 +2,62 @@ package entity
 
 import "time"
 
+// Session is one refresh token. Rotating the token replaces the session with
+// a child in the same family, which keeps the original CreatedAt.
 type Session struct {
-	ID                 string    `json:"id"`
-	UserID             string    `json:"user_id"`
-	GoogleRefreshToken string    `json:"google_refresh_token"`
-	IsRevoked          bool      `json:"is_revoked"`
-	CreatedAt          time.Time `json:"created_at"`
-	ExpiresAt          time.Time `json:"expires_at"`
+	ID                   string    `json:"id"`
+	UserID               string    `json:"user_id"`
+	FamilyID             string    `json:"family_id,omitempty"`   // ID of the family's first session
+	ParentID             string    `json:"parent_id,omitempty"`   // session this one was rotated from
+	ReplacedBy           string    `json:"replaced_by,omitempty"` // set once the refresh token has been rotated
+	Provider             string    `json:"provider,omitempty"`    // identity provider the user signed in with, if any
+	ProviderRefreshToken string    `json:"provider_refresh_token,omitempty"`
+	ClientID             string    `json:"client_id,omitempty"` // OAuth client the tokens were issued to, if any
+	Scope                string    `json:"scope,omitempty"`
+	ImpersonatorID       string    `json:"impersonator_id,omitempty"` // admin acting as the user, if any
+	IsRevoked            bool      `json:"is_revoked"`
+	UserAgent            string    `json:"user_agent,omitempty"`
+	IPAddress            string    `json:"ip_address,omitempty"` // address of the latest token refresh
+	CreatedAt            time.Time `json:"created_at"`
+	LastUsedAt           time.Time `json:"last_used_at"`
+	ExpiresAt            time.Time `json:"expires_at"`
+}
+
+// Family returns the session's family ID. Sessions created before families
+// were recorded form a family of their own.
+func (s *Session) Family() string {
+	if s.FamilyID == "" {
+		return s.ID
+	}
+	return s.FamilyID
+}
+
+// TokenPair is the refresh and access token issued for a session.
+type TokenPair struct {
+	SessionID             string    `json:"session_id"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+}
+
+const (
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// TokenIntrospection describes a token presented by a resource server. Only
+// Active is set for tokens that are invalid, expired or revoked.
+type TokenIntrospection struct {
+	Active    bool
+	TokenType string
+	Subject   string
+	SessionID string
+	ClientID  string
+	Scope     string
+	Actor     string // admin impersonating the subject, if any
+	Issuer    string
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
 }
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -14,7 +16,25 @@ type User struct {
 	LastName   string `json:"last_name"`
 	PictureURL string `json:"picture_url"`
 
-	Preference Preference `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE"`
+	EmailVerified   bool       `gorm:"default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+
+	TOTPSecret       string `json:"-"`
+	TOTPEnabled      bool   `gorm:"default:false" json:"totp_enabled"`
+	TOTPLastUsedStep int64  `json:"-"`
+
+	Disabled              bool       `gorm:"default:false" json:"disabled"`
+	DisabledAt            *time.Time `json:"disabled_at"`
+	PasswordResetRequired bool       `gorm:"default:false" json:"password_reset_required"` // set by an admin, cleared by the next password change
+
+	Preference    Preference          `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE"`
+	RecoveryCodes []RecoveryCode      `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE" json:"-"`
+	Passkeys      []PasskeyCredential `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE" json:"-"`
+	APIKeys       []APIKey            `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE" json:"-"`
+	Identities    []Identity          `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE" json:"-"`
+	Passwords     []PasswordHistory   `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE" json:"-"`
+	OAuthConsents []OAuthConsent      `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE" json:"-"`
+	Roles         []UserRole          `gorm:"foreignKey:UserID;constraint:onDelete:CASCADE" json:"-"`
 }
 
 func (u *User) BeforeCreate(db *gorm.DB) (err error) {
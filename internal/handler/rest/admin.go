@@ -0,0 +1,349 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+)
+
+type HttpAdminHandler struct {
+	userUsecase           usecase.UserUsecase
+	loginThrottleUsecase  usecase.LoginThrottleUsecase
+	oauthUsecase          usecase.OAuthUsecase
+	serviceAccountUsecase usecase.ServiceAccountUsecase
+	roleUsecase           usecase.RoleUsecase
+}
+
+func NewHttpAdminHandler(userUsecase usecase.UserUsecase, loginThrottleUsecase usecase.LoginThrottleUsecase, oauthUsecase usecase.OAuthUsecase, serviceAccountUsecase usecase.ServiceAccountUsecase, roleUsecase usecase.RoleUsecase) *HttpAdminHandler {
+	return &HttpAdminHandler{
+		userUsecase:           userUsecase,
+		loginThrottleUsecase:  loginThrottleUsecase,
+		oauthUsecase:          oauthUsecase,
+		serviceAccountUsecase: serviceAccountUsecase,
+		roleUsecase:           roleUsecase,
+	}
+}
+
+// @Summary Get a user's login lockout state
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.LockoutResponse
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/lockout [get]
+func (h *HttpAdminHandler) GetLockout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	user, err := h.userUsecase.FindByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	throttle, err := h.loginThrottleUsecase.Status(ctx, user.Email)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToLockoutResponse(user, throttle))
+}
+
+// @Summary Register an OAuth client
+// @Description Registers an application that signs users in through the authorization server. Confidential clients get a client secret, which is only returned here
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateOAuthClientRequest true "Client"
+// @Success 200 {object} dto.OAuthClientResponse
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Router /admin/oauth/clients [post]
+func (h *HttpAdminHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.CreateOAuthClientRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := &entity.OAuthClient{
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       req.Scopes,
+		FirstParty:   req.FirstParty,
+	}
+	secret, err := h.oauthUsecase.CreateClient(ctx, client, req.Confidential)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToOAuthClientResponse(client, secret))
+}
+
+// @Summary List OAuth clients
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} dto.OAuthClientResponse
+// @Failure 403 {string} string
+// @Router /admin/oauth/clients [get]
+func (h *HttpAdminHandler) FindClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	clients, err := h.oauthUsecase.FindClients(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToOAuthClientResponseList(clients))
+}
+
+// @Summary Delete an OAuth client
+// @Description Deletes the client and the consents users gave it
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} map[string]interface{} "client deleted"
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/oauth/clients/{id} [delete]
+func (h *HttpAdminHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	if err := h.oauthUsecase.DeleteClient(ctx, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "client deleted"})
+}
+
+// @Summary Create a service account
+// @Description Creates a non-human principal for backend jobs, which get tokens from /oauth/token with the client_credentials grant. The client secret is only returned here
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateServiceAccountRequest true "Service account"
+// @Success 200 {object} dto.ServiceAccountResponse
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Router /admin/service-accounts [post]
+func (h *HttpAdminHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.CreateServiceAccountRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account := &entity.ServiceAccount{Name: req.Name, Scopes: req.Scopes}
+	secret, err := h.serviceAccountUsecase.Create(ctx, account)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToServiceAccountResponse(account, secret))
+}
+
+// @Summary List service accounts
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} dto.ServiceAccountResponse
+// @Failure 403 {string} string
+// @Router /admin/service-accounts [get]
+func (h *HttpAdminHandler) FindServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	accounts, err := h.serviceAccountUsecase.FindAll(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToServiceAccountResponseList(accounts))
+}
+
+// @Summary Rotate a service account's secret
+// @Description Issues a new client secret. The current secrets keep working for the overlap, so jobs can switch over without downtime
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Service account ID"
+// @Param request body dto.RotateServiceAccountSecretRequest false "Overlap"
+// @Success 200 {object} dto.ServiceAccountSecretCreatedResponse
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/service-accounts/{id}/secrets [post]
+func (h *HttpAdminHandler) RotateServiceAccountSecret(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	id := mux.Vars(r)["id"]
+
+	req := new(dto.RotateServiceAccountSecretRequest)
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	var overlap *time.Duration
+	if req.OverlapSeconds != nil {
+		d := time.Duration(*req.OverlapSeconds) * time.Second
+		overlap = &d
+	}
+
+	secret, err := h.serviceAccountUsecase.RotateSecret(ctx, id, overlap)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ServiceAccountSecretCreatedResponse{ClientID: id, ClientSecret: secret})
+}
+
+// @Summary Delete a service account
+// @Description Deletes the account. Its tokens stop working right away
+// @Tags Admin
+// @Produce json
+// @Param id path string true "Service account ID"
+// @Success 200 {object} map[string]interface{} "service account deleted"
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/service-accounts/{id} [delete]
+func (h *HttpAdminHandler) DeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	if err := h.serviceAccountUsecase.Delete(ctx, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "service account deleted"})
+}
+
+// @Summary List roles
+// @Tags Admin
+// @Produce json
+// @Success 200 {array} dto.RoleResponse
+// @Failure 403 {string} string
+// @Router /admin/roles [get]
+func (h *HttpAdminHandler) FindRoles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	roles, err := h.roleUsecase.FindAll(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToRoleResponseList(roles))
+}
+
+// @Summary Create or replace a role
+// @Description Defines a role as a set of permissions. The built-in admin role cannot be changed
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param request body dto.SaveRoleRequest true "Role"
+// @Success 200 {object} dto.RoleResponse
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Router /admin/roles/{name} [put]
+func (h *HttpAdminHandler) SaveRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.SaveRoleRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	role := &entity.Role{
+		Name:        mux.Vars(r)["name"],
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+	if err := h.roleUsecase.Save(ctx, role); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToRoleResponse(role))
+}
+
+// @Summary Delete a role
+// @Description Deletes the role and takes it away from its users. The built-in admin role cannot be deleted
+// @Tags Admin
+// @Produce json
+// @Param name path string true "Role name"
+// @Success 200 {object} map[string]interface{} "role deleted"
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/roles/{name} [delete]
+func (h *HttpAdminHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	if err := h.roleUsecase.Delete(ctx, mux.Vars(r)["name"]); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "role deleted"})
+}
+
+// @Summary List a user's roles
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {array} dto.RoleResponse
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/roles [get]
+func (h *HttpAdminHandler) FindUserRoles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	roles, err := h.roleUsecase.FindByUserID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToRoleResponseList(roles))
+}
@@ -0,0 +1,74 @@
+package rest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/handler/rest"
+	"github.com/KimNattanan/go-user-service/internal/middleware"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// serveServiceAccounts adds the admin route listing service accounts.
+func (s *testServer) serveServiceAccounts() {
+	adminHandler := rest.NewHttpAdminHandler(nil, nil, nil, s.serviceAccountUsecase, s.roleUsecase)
+	s.admin.Handle("/service-accounts", middleware.RequirePermission(entity.PermissionClientsManage)(http.HandlerFunc(adminHandler.FindServiceAccounts))).Methods("GET")
+}
+
+// createServiceAccount creates a service account granted scopes and returns
+// it with its secret.
+func (s *testServer) createServiceAccount(t *testing.T, scopes ...string) (*entity.ServiceAccount, string) {
+	t.Helper()
+	serviceAccount := &entity.ServiceAccount{Name: "nightly-sync", Scopes: scopes}
+	secret, err := s.serviceAccountUsecase.Create(context.Background(), serviceAccount)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return serviceAccount, secret
+}
+
+func TestClientCredentials(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	s.serveOAuth()
+	s.serveServiceAccounts()
+	serviceAccount, serviceAccountSecret := s.createServiceAccount(t, entity.PermissionClientsManage)
+	config := &clientcredentials.Config{
+		ClientID:     serviceAccount.ID,
+		ClientSecret: serviceAccountSecret,
+		TokenURL:     s.server.URL + "/api/v1/oauth/token",
+	}
+
+	tokens, err := config.Token(ctx)
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if tokens.RefreshToken != "" || tokens.Extra("scope") != entity.PermissionClientsManage {
+		t.Errorf("expected a clients:manage scoped token without a refresh token, got %+v", tokens)
+	}
+	if status := s.status(t, "/api/v1/admin/service-accounts", tokens.AccessToken); status != http.StatusOK {
+		t.Errorf("expected the clients:manage scope to reach the admin API, got %d", status)
+	}
+	if status := s.status(t, "/api/v1/me", tokens.AccessToken); status != http.StatusForbidden {
+		t.Errorf("expected a service account to be kept out of user routes, got %d", status)
+	}
+
+	config.Scopes = []string{"openid"}
+	if _, err := config.Token(ctx); err == nil {
+		t.Error("expected a scope the account was not granted to be rejected")
+	}
+	config.Scopes = nil
+	config.ClientSecret = "wrong"
+	if _, err := config.Token(ctx); err == nil {
+		t.Error("expected a wrong secret to be rejected")
+	}
+
+	if err := s.serviceAccountUsecase.Delete(ctx, serviceAccount.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if status := s.status(t, "/api/v1/admin/service-accounts", tokens.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("expected the token of a deleted account to be rejected, got %d", status)
+	}
+}
@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+)
+
+type HttpAPIKeyHandler struct {
+	apiKeyUsecase usecase.APIKeyUsecase
+}
+
+func NewHttpAPIKeyHandler(apiKeyUsecase usecase.APIKeyUsecase) *HttpAPIKeyHandler {
+	return &HttpAPIKeyHandler{apiKeyUsecase: apiKeyUsecase}
+}
+
+// @Summary Create an API key
+// @Description Issues a personal API key for scripting against /me. The key is only returned here; send it as Authorization: ApiKey <key>
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Param request body dto.CreateAPIKeyRequest true "Name, scopes and optional expiry"
+// @Success 200 {object} dto.APIKeyResponse
+// @Failure 400 {string} string
+// @Router /me/api-keys [post]
+func (h *HttpAPIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	req := new(dto.CreateAPIKeyRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	apiKey, key, err := h.apiKeyUsecase.Create(ctx, userID, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToAPIKeyResponse(apiKey, key))
+}
+
+// @Summary List API keys
+// @Tags API Keys
+// @Produce json
+// @Success 200 {array} dto.APIKeyResponse
+// @Router /me/api-keys [get]
+func (h *HttpAPIKeyHandler) FindAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	apiKeys, err := h.apiKeyUsecase.FindByUserID(ctx, userID)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToAPIKeyResponseList(apiKeys))
+}
+
+// @Summary Revoke an API key
+// @Tags API Keys
+// @Produce json
+// @Param id path string true "API key ID"
+// @Success 200 {object} map[string]interface{} "api key revoked"
+// @Failure 404 {string} string
+// @Router /me/api-keys/{id} [delete]
+func (h *HttpAPIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+	id := mux.Vars(r)["id"]
+
+	if err := h.apiKeyUsecase.Revoke(ctx, userID, id); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "api key revoked"})
+}
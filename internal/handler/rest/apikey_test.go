@@ -0,0 +1,83 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/handler/rest"
+)
+
+// serveAPIKeys adds the routes managing the user's API keys.
+func (s *testServer) serveAPIKeys() {
+	apiKeyHandler := rest.NewHttpAPIKeyHandler(s.apiKeyUsecase)
+	s.account.HandleFunc("/api-keys", apiKeyHandler.FindAPIKeys).Methods("GET")
+	s.account.HandleFunc("/api-keys", apiKeyHandler.Create).Methods("POST")
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := newTestServer(t)
+	s.serveAPIKeys()
+
+	resp := s.do(t, "POST", s.server.URL+"/api/v1/me/api-keys", `{"name":"script","scopes":["profile:read"]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the key to be created, got %d", resp.StatusCode)
+	}
+	created := new(dto.APIKeyResponse)
+	if err := json.NewDecoder(resp.Body).Decode(created); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if created.Key == "" || !strings.Contains(created.Key, created.Prefix) {
+		t.Fatalf("expected the key to be returned once, got %+v", created)
+	}
+
+	resp = s.do(t, "GET", s.server.URL+"/api/v1/me/api-keys", "")
+	var listed []*dto.APIKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Key != "" || listed[0].Prefix != created.Prefix {
+		t.Errorf("expected the listing to show the prefix but not the key, got %+v", listed)
+	}
+
+	apiKey := "ApiKey " + created.Key
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/api/v1/me", http.StatusOK},
+		{"GET", "/api/v1/me/preferences", http.StatusForbidden},
+		{"DELETE", "/api/v1/me", http.StatusForbidden},
+		{"GET", "/api/v1/me/api-keys", http.StatusForbidden},
+		{"GET", "/api/v1/users", http.StatusForbidden},
+	} {
+		if status := s.statusWith(t, tc.method, tc.path, apiKey); status != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.want, status)
+		}
+	}
+	if status := s.statusWith(t, "GET", "/api/v1/me", "ApiKey "+created.Key+"x"); status != http.StatusUnauthorized {
+		t.Errorf("expected a wrong key to be rejected, got %d", status)
+	}
+	if status := s.statusWith(t, "DELETE", "/api/v1/me", "Bearer "+s.userToken); status != http.StatusOK {
+		t.Errorf("expected a session to keep its full access, got %d", status)
+	}
+
+	s.users.Users["user-1"].Disabled = true
+	if status := s.statusWith(t, "GET", "/api/v1/me", apiKey); status != http.StatusUnauthorized {
+		t.Errorf("expected the key of a disabled user to be rejected, got %d", status)
+	}
+	s.users.Users["user-1"].Disabled = false
+	if status := s.statusWith(t, "GET", "/api/v1/me", apiKey); status != http.StatusOK {
+		t.Errorf("expected the key to work again once the user is enabled, got %d", status)
+	}
+
+	if err := s.apiKeyUsecase.Revoke(context.Background(), "user-1", created.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if status := s.statusWith(t, "GET", "/api/v1/me", apiKey); status != http.StatusUnauthorized {
+		t.Errorf("expected a revoked key to be rejected, got %d", status)
+	}
+}
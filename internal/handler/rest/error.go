@@ -0,0 +1,27 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+)
+
+// writeError answers like http.Error, except that validation errors are
+// written as JSON with their field-level details.
+func writeError(w http.ResponseWriter, err error) {
+	var validationErr *apperror.ValidationError
+	if !errors.As(err, &validationErr) {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apperror.StatusCode(err))
+	json.NewEncoder(w).Encode(&dto.ValidationErrorResponse{
+		Error:  validationErr.Error(),
+		Fields: validationErr.Fields,
+	})
+}
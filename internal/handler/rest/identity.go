@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+type HttpIdentityHandler struct {
+	identityUsecase usecase.IdentityUsecase
+	sessionStore    sessions.Store
+}
+
+func NewHttpIdentityHandler(identityUsecase usecase.IdentityUsecase, sessionStore sessions.Store) *HttpIdentityHandler {
+	return &HttpIdentityHandler{
+		identityUsecase: identityUsecase,
+		sessionStore:    sessionStore,
+	}
+}
+
+// @Summary List linked identities
+// @Tags Identities
+// @Produce json
+// @Success 200 {array} dto.IdentityResponse
+// @Router /me/identities [get]
+func (h *HttpIdentityHandler) FindIdentities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	identities, err := h.identityUsecase.FindByUserID(ctx, userID)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToIdentityResponseList(identities))
+}
+
+// @Summary Link an identity provider
+// @Description Redirects to the provider. Its callback links the external account to the current user
+// @Tags Identities
+// @Param provider path string true "Provider name"
+// @Param return_to query string false "Allowlisted URL to redirect to after the callback"
+// @Success 302
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Router /me/identities/{provider}/link [get]
+func (h *HttpIdentityHandler) Link(w http.ResponseWriter, r *http.Request) {
+	userID := principal.UserID(r.Context())
+	redirectToProvider(w, r, h.sessionStore, h.identityUsecase, mux.Vars(r)["provider"], userID)
+}
+
+// @Summary Unlink an identity
+// @Description Refuses to remove the last way to sign in
+// @Tags Identities
+// @Produce json
+// @Param id path string true "Identity ID"
+// @Success 200 {object} map[string]interface{} "identity unlinked"
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Router /me/identities/{id} [delete]
+func (h *HttpIdentityHandler) Unlink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	if err := h.identityUsecase.Unlink(ctx, userID, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "identity unlinked"})
+}
@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/asaskevich/govalidator"
+)
+
+type HttpMFAHandler struct {
+	mfaUsecase usecase.MFAUsecase
+}
+
+func NewHttpMFAHandler(mfaUsecase usecase.MFAUsecase) *HttpMFAHandler {
+	return &HttpMFAHandler{mfaUsecase: mfaUsecase}
+}
+
+// @Summary Start TOTP enrollment
+// @Description Generates a new TOTP secret. It is not active until confirmed with a code
+// @Tags MFA
+// @Produce json
+// @Success 200 {object} dto.TOTPEnrollmentResponse
+// @Failure 409 {string} string
+// @Router /me/mfa/totp [post]
+func (h *HttpMFAHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	secret, uri, err := h.mfaUsecase.EnrollTOTP(ctx, userID)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(&dto.TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+	})
+}
+
+// @Summary Confirm TOTP enrollment
+// @Description Activates TOTP with a first code and returns one-time recovery codes
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "TOTP code"
+// @Success 200 {object} dto.RecoveryCodesResponse
+// @Failure 400 {string} string
+// @Router /me/mfa/totp/confirm [post]
+func (h *HttpMFAHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	req := new(dto.MFACodeRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfaUsecase.ConfirmTOTP(ctx, userID, req.Code)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(&dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary Disable TOTP
+// @Description Requires a current TOTP code or an unused recovery code
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} map[string]interface{} "mfa disabled"
+// @Failure 400 {string} string
+// @Router /me/mfa/totp [delete]
+func (h *HttpMFAHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	req := new(dto.MFACodeRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.mfaUsecase.DisableTOTP(ctx, userID, req.Code); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "mfa disabled"})
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replaces every recovery code. Requires a current TOTP code or an unused recovery code
+// @Tags MFA
+// @Accept json
+// @Produce json
+// @Param request body dto.MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {object} dto.RecoveryCodesResponse
+// @Failure 400 {string} string
+// @Router /me/mfa/recovery-codes [post]
+func (h *HttpMFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	req := new(dto.MFACodeRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.mfaUsecase.RegenerateRecoveryCodes(ctx, userID, req.Code)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(&dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
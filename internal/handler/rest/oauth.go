@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	oauthSessionName = "oauth"
+	oauthStateMaxAge = 10 * 60 // in seconds
+
+	authModeBearer = "bearer"
+)
+
+// redirectToProvider starts an authorization code flow. The PKCE verifier,
+// nonce, linking user and return_to are kept server-side under the state; the
+// state itself goes into a short-lived encrypted cookie so the callback can
+// only be completed by the browser that started the flow. With
+// auth_mode=bearer the callback answers with the tokens instead of setting
+// the session cookie, which rules out a return_to redirect.
+func redirectToProvider(w http.ResponseWriter, r *http.Request, sessionStore sessions.Store, identityUsecase usecase.IdentityUsecase, providerName, linkUserID string) {
+	returnTo := r.URL.Query().Get("return_to")
+	bearer := bearerMode(r)
+	if bearer && returnTo != "" {
+		http.Error(w, apperror.ErrInvalidRedirect.Error(), http.StatusBadRequest)
+		return
+	}
+	url, state, err := identityUsecase.BeginAuthorization(r.Context(), providerName, linkUserID, returnTo)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	oauthSession, _ := sessionStore.Get(r, oauthSessionName)
+	oauthSession.Options.MaxAge = oauthStateMaxAge
+	oauthSession.Values["state"] = state
+	oauthSession.Values["bearer"] = bearer
+	if err := oauthSession.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", url)
+	w.WriteHeader(http.StatusFound)
+}
+
+// consumeOAuthState clears the state cookie and checks that the callback
+// state matches it. It also reports whether the flow was started in bearer
+// mode.
+func consumeOAuthState(w http.ResponseWriter, r *http.Request, sessionStore sessions.Store) (string, bool, error) {
+	oauthSession, err := sessionStore.Get(r, oauthSessionName)
+	if err != nil {
+		return "", false, apperror.ErrInvalidOAuthState
+	}
+	state, _ := oauthSession.Values["state"].(string)
+	bearer, _ := oauthSession.Values["bearer"].(bool)
+
+	oauthSession.Options.MaxAge = -1
+	oauthSession.Save(r, w)
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(r.URL.Query().Get("state"))) != 1 {
+		return "", false, apperror.ErrInvalidOAuthState
+	}
+	return state, bearer, nil
+}
+
+// loginErrorCode maps a failed external login to the error code passed to
+// the login error page.
+func loginErrorCode(err error) string {
+	switch {
+	case errors.Is(err, apperror.ErrInvalidOAuthState):
+		return "invalid_state"
+	case errors.Is(err, apperror.ErrAccessDenied):
+		return "access_denied"
+	case errors.Is(err, apperror.ErrIdentityNotLinked):
+		return "identity_not_linked"
+	case errors.Is(err, apperror.ErrIdentityInUse):
+		return "identity_in_use"
+	case errors.Is(err, apperror.ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, apperror.ErrRegistrationClosed):
+		return "registration_closed"
+	case errors.Is(err, apperror.ErrUnknownProvider):
+		return "unknown_provider"
+	case errors.Is(err, apperror.ErrDependencyFail):
+		return "provider_unavailable"
+	case errors.Is(err, apperror.ErrUnauthorized), errors.Is(err, apperror.ErrInvalidData):
+		return "authentication_failed"
+	default:
+		return "server_error"
+	}
+}
+
+func withFragment(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Fragment = params.Encode()
+	return u.String()
+}
+
+// withQuery adds params to the query of rawURL, keeping the parameters it
+// already has.
+func withQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
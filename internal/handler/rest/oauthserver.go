@@ -0,0 +1,425 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/middleware"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/gorilla/mux"
+)
+
+// HttpOAuthServerHandler serves the OAuth 2.0 / OpenID Connect authorization
+// server. Clients and resource servers authenticate either with HTTP Basic
+// or as client_id and client_secret form fields, and the errors of the
+// endpoints they call follow RFC 6749 instead of the plain-text errors of
+// the rest of the API. Resource servers are configured in RESOURCE_SERVERS.
+type HttpOAuthServerHandler struct {
+	sessionUsecase        usecase.SessionUsecase
+	oauthUsecase          usecase.OAuthUsecase
+	serviceAccountUsecase usecase.ServiceAccountUsecase
+	clientSecrets         map[string]string
+	issuer                string
+	loginURL              string
+	consentURL            string
+}
+
+func NewHttpOAuthServerHandler(sessionUsecase usecase.SessionUsecase, oauthUsecase usecase.OAuthUsecase, serviceAccountUsecase usecase.ServiceAccountUsecase, resourceServers []config.ResourceServerConfig, issuer, loginURL, consentURL string) *HttpOAuthServerHandler {
+	clientSecrets := make(map[string]string, len(resourceServers))
+	for _, server := range resourceServers {
+		if server.Secret != "" {
+			clientSecrets[server.ID] = server.Secret
+		}
+	}
+	return &HttpOAuthServerHandler{
+		sessionUsecase:        sessionUsecase,
+		oauthUsecase:          oauthUsecase,
+		serviceAccountUsecase: serviceAccountUsecase,
+		clientSecrets:         clientSecrets,
+		issuer:                strings.TrimSuffix(issuer, "/"),
+		loginURL:              loginURL,
+		consentURL:            consentURL,
+	}
+}
+
+// @Summary Authorize a client
+// @Description Starts the authorization code flow with PKCE (S256). Users who are not signed in are sent to the login page with return_to, and users who have not yet allowed the client its scopes to the consent screen with consent_id. Otherwise the browser is redirected to redirect_uri with a code, or an error, and the state
+// @Tags OAuth
+// @Param response_type query string true "code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string false "One of the client's redirect URIs"
+// @Param scope query string false "Space separated, e.g. openid profile email"
+// @Param state query string false "Opaque value returned to the client"
+// @Param nonce query string false "Copied into the ID token"
+// @Param code_challenge query string true "PKCE code challenge"
+// @Param code_challenge_method query string true "S256"
+// @Success 302
+// @Failure 400 {string} string
+// @Failure 401 {string} string
+// @Router /oauth/authorize [get]
+func (h *HttpOAuthServerHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	req := &entity.AuthorizationRequest{
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		ResponseType:        query.Get("response_type"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	// Without a valid client and redirect URI there is nowhere safe to
+	// redirect an error to.
+	client, err := h.oauthUsecase.ValidateClient(ctx, req)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	userID := principal.UserID(ctx)
+	if userID == "" {
+		if query.Get("prompt") == "none" {
+			redirectAuthorizationError(w, r, req, "login_required")
+			return
+		}
+		returnTo := h.issuer + r.URL.RequestURI()
+		http.Redirect(w, r, withQuery(h.loginURL, url.Values{"return_to": {returnTo}}), http.StatusFound)
+		return
+	}
+
+	code, consentID, err := h.oauthUsecase.Authorize(ctx, userID, client, req)
+	switch {
+	case err != nil:
+		redirectAuthorizationError(w, r, req, oauthErrorCode(err))
+	case consentID != "":
+		if query.Get("prompt") == "none" {
+			redirectAuthorizationError(w, r, req, "consent_required")
+			return
+		}
+		http.Redirect(w, r, withQuery(h.consentURL, url.Values{"consent_id": {consentID}}), http.StatusFound)
+	default:
+		http.Redirect(w, r, authorizationResponse(req, code), http.StatusFound)
+	}
+}
+
+func authorizationResponse(req *entity.AuthorizationRequest, code string) string {
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return withQuery(req.RedirectURI, params)
+}
+
+func authorizationError(req *entity.AuthorizationRequest, code string) string {
+	params := url.Values{"error": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return withQuery(req.RedirectURI, params)
+}
+
+func redirectAuthorizationError(w http.ResponseWriter, r *http.Request, req *entity.AuthorizationRequest, code string) {
+	http.Redirect(w, r, authorizationError(req, code), http.StatusFound)
+}
+
+// @Summary Get a consent request
+// @Description Returns the client and scopes the consent screen asks the current user about
+// @Tags OAuth
+// @Produce json
+// @Param id path string true "Consent ID"
+// @Success 200 {object} dto.ConsentRequestResponse
+// @Failure 404 {string} string
+// @Router /oauth/consent/{id} [get]
+func (h *HttpOAuthServerHandler) FindConsentRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	consentRequest, err := h.oauthUsecase.FindConsentRequest(ctx, userID, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToConsentRequestResponse(consentRequest))
+}
+
+// @Summary Answer a consent request
+// @Description Allows or denies the client the requested scopes and returns where to send the browser: the client's redirect URI with a code or an access_denied error
+// @Tags OAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "Consent ID"
+// @Param request body dto.ConsentDecisionRequest true "Decision"
+// @Success 200 {object} dto.RedirectResponse
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Router /oauth/consent/{id} [post]
+func (h *HttpOAuthServerHandler) DecideConsent(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	req := new(dto.ConsentDecisionRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+
+	authorization, code, err := h.oauthUsecase.DecideConsent(ctx, userID, mux.Vars(r)["id"], req.Allow)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	redirectTo := authorizationError(authorization, "access_denied")
+	if code != "" {
+		redirectTo = authorizationResponse(authorization, code)
+	}
+
+	json.NewEncoder(w).Encode(dto.RedirectResponse{RedirectTo: redirectTo})
+}
+
+// @Summary Issue tokens
+// @Description Redeems an authorization code (with its PKCE code verifier) or a refresh token for an access token, a refresh token and, with the openid scope, an ID token. Confidential clients authenticate with their secret. Service accounts use the client_credentials grant and get a short-lived access token only
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI of the authorization request"
+// @Param code_verifier formData string false "PKCE code verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Scopes requested with client_credentials, space separated"
+// @Param client_id formData string false "Client ID, unless sent with HTTP Basic"
+// @Param client_secret formData string false "Client secret, unless sent with HTTP Basic"
+// @Success 200 {object} dto.OAuthTokenResponse
+// @Failure 400 {object} dto.OAuthErrorResponse
+// @Failure 401 {object} dto.OAuthErrorResponse
+// @Router /oauth/token [post]
+func (h *HttpOAuthServerHandler) Token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	ctx := r.Context()
+
+	clientID, clientSecret, ok := clientCredentials(r)
+	if !ok {
+		writeInvalidClient(w)
+		return
+	}
+	if r.PostFormValue("grant_type") == grantTypeClientCredentials {
+		h.clientCredentials(w, r, clientID, clientSecret)
+		return
+	}
+	tokens, err := h.oauthUsecase.Exchange(ctx, &entity.TokenRequest{
+		GrantType:    r.PostFormValue("grant_type"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Code:         r.PostFormValue("code"),
+		RedirectURI:  r.PostFormValue("redirect_uri"),
+		CodeVerifier: r.PostFormValue("code_verifier"),
+		RefreshToken: r.PostFormValue("refresh_token"),
+		UserAgent:    r.UserAgent(),
+		IPAddress:    middleware.ClientIP(r),
+	})
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToOAuthTokenResponse(tokens))
+}
+
+const grantTypeClientCredentials = "client_credentials"
+
+// clientCredentials issues a service account token (RFC 6749 section 4.4).
+func (h *HttpOAuthServerHandler) clientCredentials(w http.ResponseWriter, r *http.Request, clientID, clientSecret string) {
+	token, err := h.serviceAccountUsecase.IssueToken(r.Context(), clientID, clientSecret, r.PostFormValue("scope"))
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(dto.ToServiceAccountTokenResponse(token))
+}
+
+func writeTokenError(w http.ResponseWriter, err error) {
+	code := oauthErrorCode(err)
+	switch code {
+	case "invalid_client":
+		writeInvalidClient(w)
+	case "server_error":
+		writeOAuthError(w, http.StatusInternalServerError, code, "")
+	default:
+		writeOAuthError(w, http.StatusBadRequest, code, err.Error())
+	}
+}
+
+// @Summary Get the signed-in user's claims
+// @Description Returns the claims about the user that the scopes of the access token allow (OpenID Connect UserInfo). Requires an access token issued to a client with the openid scope
+// @Tags OAuth
+// @Produce json
+// @Success 200 {object} entity.UserInfo
+// @Failure 401 {string} string
+// @Router /oauth/userinfo [get]
+func (h *HttpOAuthServerHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	scheme, accessToken, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		http.Error(w, apperror.ErrUnauthorized.Error(), http.StatusUnauthorized)
+		return
+	}
+	info, err := h.oauthUsecase.UserInfo(ctx, strings.TrimSpace(accessToken))
+	if err != nil {
+		if errors.Is(err, apperror.ErrUnauthorized) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(info)
+}
+
+// oauthErrorCode maps errors to the error codes of RFC 6749.
+func oauthErrorCode(err error) string {
+	switch {
+	case errors.Is(err, apperror.ErrInvalidClient):
+		return "invalid_client"
+	case errors.Is(err, apperror.ErrInvalidGrant):
+		return "invalid_grant"
+	case errors.Is(err, apperror.ErrInvalidScope):
+		return "invalid_scope"
+	case errors.Is(err, apperror.ErrUnsupportedGrantType):
+		return "unsupported_grant_type"
+	case errors.Is(err, apperror.ErrUnsupportedResponseType):
+		return "unsupported_response_type"
+	case errors.Is(err, apperror.ErrInvalidData), errors.Is(err, apperror.ErrInvalidRedirect):
+		return "invalid_request"
+	default:
+		return "server_error"
+	}
+}
+
+// @Summary Introspect a token
+// @Description Tells a resource server whether a token issued by this service is active (RFC 7662)
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 {object} dto.IntrospectionResponse
+// @Failure 400 {object} dto.OAuthErrorResponse
+// @Failure 401 {object} dto.OAuthErrorResponse
+// @Router /oauth/introspect [post]
+func (h *HttpOAuthServerHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	ctx := r.Context()
+
+	if !h.authenticateClient(r) {
+		writeInvalidClient(w)
+		return
+	}
+	tokenStr := r.PostFormValue("token")
+	if tokenStr == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	introspection, err := h.sessionUsecase.Introspect(ctx, tokenStr)
+	if err == nil && !introspection.Active {
+		introspection, err = h.serviceAccountUsecase.Introspect(ctx, tokenStr)
+	}
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	json.NewEncoder(w).Encode(dto.ToIntrospectionResponse(introspection))
+}
+
+// @Summary Revoke a token
+// @Description Revokes the session a token belongs to, together with all its tokens (RFC 7009). Unknown or invalid tokens are accepted as well. Service account tokens have no session and run out on their own
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "Access or refresh token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200
+// @Failure 400 {object} dto.OAuthErrorResponse
+// @Failure 401 {object} dto.OAuthErrorResponse
+// @Router /oauth/revoke [post]
+func (h *HttpOAuthServerHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if !h.authenticateClient(r) {
+		writeInvalidClient(w)
+		return
+	}
+	tokenStr := r.PostFormValue("token")
+	if tokenStr == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	if err := h.sessionUsecase.RevokeToken(ctx, tokenStr); err != nil {
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticateClient checks the resource server credentials of the request.
+func (h *HttpOAuthServerHandler) authenticateClient(r *http.Request) bool {
+	clientID, clientSecret, ok := clientCredentials(r)
+	if !ok {
+		return false
+	}
+	expected, known := h.clientSecrets[clientID]
+	if !known || clientSecret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(clientSecret), []byte(expected)) == 1
+}
+
+// clientCredentials reads the client ID and secret from HTTP Basic, for
+// which RFC 6749 has clients form-encode them first, or from the form.
+func clientCredentials(r *http.Request) (string, string, bool) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		return r.PostFormValue("client_id"), r.PostFormValue("client_secret"), true
+	}
+	clientID, err := url.QueryUnescape(clientID)
+	if err != nil {
+		return "", "", false
+	}
+	clientSecret, err = url.QueryUnescape(clientSecret)
+	if err != nil {
+		return "", "", false
+	}
+	return clientID, clientSecret, true
+}
+
+func writeInvalidClient(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(dto.OAuthErrorResponse{Error: code, ErrorDescription: description})
+}
@@ -0,0 +1,243 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/handler/rest"
+	"github.com/KimNattanan/go-user-service/internal/middleware"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	oauthUsecase "github.com/KimNattanan/go-user-service/internal/usecase/oauth"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const redirectURI = "https://app.example.com/callback"
+
+// serveOAuth adds the OAuth and OpenID Connect routes.
+func (s *testServer) serveOAuth() *oauthUsecase.OAuthUsecase {
+	oauthUsecase := oauthUsecase.NewOAuthUsecase(
+		repotest.NewOAuthClientRepo(),
+		repotest.NewOAuthConsentRepo(),
+		repotest.NewOneTimeTokenRepo(),
+		s.users,
+		s.sessionUsecase,
+		s.jwtMaker,
+	)
+	oauthServerHandler := rest.NewHttpOAuthServerHandler(s.sessionUsecase, oauthUsecase, s.serviceAccountUsecase, nil, s.server.URL, "https://app.example.com/login", "https://app.example.com/consent")
+	wellKnownHandler := rest.NewHttpWellKnownHandler(s.jwtMaker)
+
+	s.router.HandleFunc("/.well-known/jwks.json", wellKnownHandler.JWKS).Methods("GET")
+	s.router.HandleFunc("/.well-known/openid-configuration", wellKnownHandler.OpenIDConfiguration).Methods("GET")
+	s.router.HandleFunc("/api/v1/oauth/token", oauthServerHandler.Token).Methods("POST")
+	s.router.HandleFunc("/api/v1/oauth/userinfo", oauthServerHandler.UserInfo).Methods("GET", "POST")
+	authorizeGroup := s.router.PathPrefix("/api/v1/oauth/authorize").Subrouter()
+	authorizeGroup.Use(s.authMiddleware.Optional)
+	authorizeGroup.HandleFunc("", oauthServerHandler.Authorize).Methods("GET")
+	oauthGroup := s.api.PathPrefix("/oauth").Subrouter()
+	oauthGroup.Use(middleware.RequireUser)
+	oauthGroup.HandleFunc("/consent/{id}", oauthServerHandler.FindConsentRequest).Methods("GET")
+	oauthGroup.HandleFunc("/consent/{id}", oauthServerHandler.DecideConsent).Methods("POST")
+	return oauthUsecase
+}
+
+type authorizationServer struct {
+	*testServer
+	oauthUsecase *oauthUsecase.OAuthUsecase
+	client       *entity.OAuthClient
+	clientSecret string
+}
+
+// newAuthorizationServer serves the OAuth routes with a confidential
+// third-party client.
+func newAuthorizationServer(t *testing.T) *authorizationServer {
+	t.Helper()
+	s := &authorizationServer{testServer: newTestServer(t)}
+	s.oauthUsecase = s.serveOAuth()
+	s.client = &entity.OAuthClient{Name: "Example App", RedirectURIs: []string{redirectURI}}
+	clientSecret, err := s.oauthUsecase.CreateClient(context.Background(), s.client, true)
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	s.clientSecret = clientSecret
+	return s
+}
+
+func redirectQuery(t *testing.T, resp *http.Response, prefix string) url.Values {
+	t.Helper()
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusFound || !strings.HasPrefix(location, prefix) {
+		t.Fatalf("expected a redirect to %s, got %d %q", prefix, resp.StatusCode, location)
+	}
+	parsed, err := url.Parse(location)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return parsed.Query()
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	s := newAuthorizationServer(t)
+
+	provider, err := oidc.NewProvider(ctx, s.server.URL)
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	config := &oauth2.Config{
+		ClientID:     s.client.ID,
+		ClientSecret: s.clientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURI,
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+	}
+	verifier := oauth2.GenerateVerifier()
+	authURL := config.AuthCodeURL("state-1", oauth2.S256ChallengeOption(verifier), oidc.Nonce("nonce-1"))
+
+	// The first authorization asks for consent.
+	consentID := redirectQuery(t, s.do(t, "GET", authURL, ""), "https://app.example.com/consent").Get("consent_id")
+	resp := s.do(t, "GET", s.server.URL+"/api/v1/oauth/consent/"+consentID, "")
+	var consentRequest dto.ConsentRequestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&consentRequest); err != nil || consentRequest.Client.ID != s.client.ID {
+		t.Fatalf("unexpected consent request %+v, %v", consentRequest, err)
+	}
+	resp = s.do(t, "POST", s.server.URL+"/api/v1/oauth/consent/"+consentID, `{"allow":true}`)
+	var decision dto.RedirectResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	callback, err := url.Parse(decision.RedirectTo)
+	if err != nil || callback.Query().Get("state") != "state-1" {
+		t.Fatalf("unexpected redirect %q", decision.RedirectTo)
+	}
+	code := callback.Query().Get("code")
+
+	if _, err := config.Exchange(ctx, code, oauth2.VerifierOption("wrong-verifier-"+verifier)); err == nil {
+		t.Error("expected a wrong code verifier to be rejected")
+	}
+
+	// Another client cannot redeem the code, nor use it up for the client it
+	// was issued to.
+	otherClient := &entity.OAuthClient{Name: "Other App", RedirectURIs: []string{redirectURI}}
+	otherSecret, err := s.oauthUsecase.CreateClient(ctx, otherClient, true)
+	if err != nil {
+		t.Fatalf("CreateClient: %v", err)
+	}
+	otherConfig := *config
+	otherConfig.ClientID, otherConfig.ClientSecret = otherClient.ID, otherSecret
+	if _, err := otherConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier)); err == nil {
+		t.Error("expected another client's code to be rejected")
+	}
+
+	tokens, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier)); err == nil {
+		t.Error("expected a used code to be rejected")
+	}
+
+	// Authorizing again skips the consent screen, as the user already allowed
+	// these scopes. The token request has to repeat the redirect URI it was
+	// authorized for.
+	otherVerifier := oauth2.GenerateVerifier()
+	query := redirectQuery(t, s.do(t, "GET", config.AuthCodeURL("state-2", oauth2.S256ChallengeOption(otherVerifier)), ""), redirectURI)
+	if query.Get("state") != "state-2" {
+		t.Errorf("expected the state to be returned, got %q", query.Get("state"))
+	}
+	otherCode := query.Get("code")
+	withoutRedirect := *config
+	withoutRedirect.RedirectURL = ""
+	if _, err := withoutRedirect.Exchange(ctx, otherCode, oauth2.VerifierOption(otherVerifier)); err == nil {
+		t.Error("expected a token request without redirect_uri to be rejected")
+	}
+
+	rawIDToken, _ := tokens.Extra("id_token").(string)
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.client.ID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	var claims struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		t.Fatalf("Claims: %v", err)
+	}
+	if idToken.Subject != "user-1" || idToken.Nonce != "nonce-1" || claims.Email != "jane@example.com" || claims.Name != "Jane Doe" {
+		t.Errorf("unexpected ID token %+v %+v", idToken, claims)
+	}
+
+	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(tokens))
+	if err != nil {
+		t.Fatalf("UserInfo: %v", err)
+	}
+	if userInfo.Subject != "user-1" || userInfo.Email != "jane@example.com" || !userInfo.EmailVerified {
+		t.Errorf("unexpected user info %+v", userInfo)
+	}
+
+	// Client tokens are not accepted by the rest of the API.
+	if status := s.status(t, "/api/v1/me", tokens.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("expected a client access token to be rejected, got %d", status)
+	}
+
+	refreshed, err := config.TokenSource(ctx, &oauth2.Token{RefreshToken: tokens.RefreshToken}).Token()
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if refreshed.AccessToken == "" || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Errorf("expected new tokens, got %+v", refreshed)
+	}
+	if _, err := config.TokenSource(ctx, &oauth2.Token{RefreshToken: tokens.RefreshToken}).Token(); err == nil {
+		t.Error("expected a rotated refresh token to be rejected")
+	}
+}
+
+func TestAuthorizeRedirectsSignedOutUsersToLogin(t *testing.T) {
+	s := newAuthorizationServer(t)
+	authURL := s.server.URL + "/api/v1/oauth/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.client.ID},
+		"redirect_uri":          {redirectURI},
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	query := redirectQuery(t, resp, "https://app.example.com/login")
+	if query.Get("return_to") != authURL {
+		t.Errorf("expected return_to %q, got %q", authURL, query.Get("return_to"))
+	}
+
+	resp, err = client.Get(authURL + "&prompt=none")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if query := redirectQuery(t, resp, redirectURI); query.Get("error") != "login_required" {
+		t.Errorf("expected login_required, got %q", query.Get("error"))
+	}
+}
+
+func TestAuthorizeDoesNotRedirectToUnknownURIs(t *testing.T) {
+	s := newAuthorizationServer(t)
+	resp := s.do(t, "GET", s.server.URL+"/api/v1/oauth/authorize?"+url.Values{
+		"response_type": {"code"},
+		"client_id":     {s.client.ID},
+		"redirect_uri":  {"https://evil.example.com/callback"},
+	}.Encode(), "")
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Location") != "" {
+		t.Errorf("expected a 400 without a redirect, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
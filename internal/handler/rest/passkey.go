@@ -0,0 +1,152 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+)
+
+type HttpPasskeyHandler struct {
+	passkeyUsecase usecase.PasskeyUsecase
+}
+
+func NewHttpPasskeyHandler(passkeyUsecase usecase.PasskeyUsecase) *HttpPasskeyHandler {
+	return &HttpPasskeyHandler{passkeyUsecase: passkeyUsecase}
+}
+
+// @Summary Start passkey registration
+// @Description Returns credential creation options to pass to navigator.credentials.create
+// @Tags Passkeys
+// @Produce json
+// @Success 200 {object} dto.PasskeyRegistrationBeginResponse
+// @Router /me/passkeys/register/begin [post]
+func (h *HttpPasskeyHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	ceremonyID, options, err := h.passkeyUsecase.BeginRegistration(ctx, userID)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(&dto.PasskeyRegistrationBeginResponse{
+		CeremonyID: ceremonyID,
+		Options:    options,
+	})
+}
+
+// @Summary Finish passkey registration
+// @Description Verifies the authenticator attestation and stores the new credential
+// @Tags Passkeys
+// @Accept json
+// @Produce json
+// @Param request body dto.PasskeyRegistrationFinishRequest true "Ceremony ID and attestation response"
+// @Success 200 {object} dto.PasskeyResponse
+// @Failure 400 {string} string
+// @Router /me/passkeys/register/finish [post]
+func (h *HttpPasskeyHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	req := new(dto.PasskeyRegistrationFinishRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	passkey, err := h.passkeyUsecase.FinishRegistration(ctx, userID, req.CeremonyID, req.Name, req.Credential)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToPasskeyResponse(passkey))
+}
+
+// @Summary List passkeys
+// @Tags Passkeys
+// @Produce json
+// @Success 200 {array} dto.PasskeyResponse
+// @Router /me/passkeys [get]
+func (h *HttpPasskeyHandler) FindPasskeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+
+	passkeys, err := h.passkeyUsecase.FindByUserID(ctx, userID)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToPasskeyResponseList(passkeys))
+}
+
+// @Summary Rename a passkey
+// @Tags Passkeys
+// @Accept json
+// @Produce json
+// @Param id path string true "Passkey ID"
+// @Param request body dto.PasskeyRenameRequest true "New name"
+// @Success 200 {object} dto.PasskeyResponse
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Router /me/passkeys/{id} [patch]
+func (h *HttpPasskeyHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+	id := mux.Vars(r)["id"]
+
+	req := new(dto.PasskeyRenameRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	passkey, err := h.passkeyUsecase.Rename(ctx, userID, id, req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToPasskeyResponse(passkey))
+}
+
+// @Summary Delete a passkey
+// @Tags Passkeys
+// @Produce json
+// @Param id path string true "Passkey ID"
+// @Success 200 {object} map[string]interface{} "passkey deleted"
+// @Failure 404 {string} string
+// @Router /me/passkeys/{id} [delete]
+func (h *HttpPasskeyHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+	id := mux.Vars(r)["id"]
+
+	if err := h.passkeyUsecase.Delete(ctx, userID, id); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "passkey deleted"})
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/principal"
 	"github.com/KimNattanan/go-user-service/internal/usecase"
 	"github.com/KimNattanan/go-user-service/pkg/apperror"
 )
@@ -24,7 +25,7 @@ func NewHttpPreferenceHandler(preferenceUsecase usecase.PreferenceUsecase) *Http
 func (h *HttpPreferenceHandler) GetPreference(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
-	userID, _ := ctx.Value("userID").(string)
+	userID := principal.UserID(ctx)
 
 	preference, err := h.preferenceUsecase.FindByUserID(ctx, userID)
 	if err != nil {
@@ -43,7 +44,7 @@ func (h *HttpPreferenceHandler) GetPreference(w http.ResponseWriter, r *http.Req
 func (h *HttpPreferenceHandler) Update(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
-	userID, _ := ctx.Value("userID").(string)
+	userID := principal.UserID(ctx)
 
 	var (
 		data0 dto.PreferenceUpdateRequest
@@ -0,0 +1,209 @@
+package rest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/middleware"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	apiKeyUsecase "github.com/KimNattanan/go-user-service/internal/usecase/apikey"
+	roleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/role"
+	serviceAccountUsecase "github.com/KimNattanan/go-user-service/internal/usecase/serviceaccount"
+	sessionUsecase "github.com/KimNattanan/go-user-service/internal/usecase/session"
+	userAdminUsecase "github.com/KimNattanan/go-user-service/internal/usecase/useradmin"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+// fakeUserUsecase serves the user lookups the auth middleware makes.
+type fakeUserUsecase struct {
+	usecase.UserUsecase
+	repo *repotest.UserRepo
+}
+
+func (u *fakeUserUsecase) FindByID(ctx context.Context, id string) (*entity.User, error) {
+	return u.repo.FindByID(ctx, id)
+}
+
+// testServer serves the API behind the auth middleware, grouped the way
+// pkg/routes groups it, with a signed-in user and a second user. Routes
+// other than the handlers under test answer 200, so tests can check who gets
+// through; each test adds the handlers it exercises before sending requests.
+type testServer struct {
+	server  *httptest.Server
+	router  *mux.Router // routes outside the auth middleware
+	api     *mux.Router // /api/v1, behind AuthMiddleware.Handle
+	account *mux.Router // /api/v1/me, for the user's own session only
+	admin   *mux.Router // /api/v1/admin
+
+	jwtMaker              *token.JWTMaker
+	users                 *repotest.UserRepo
+	roleRepo              *repotest.RoleRepo
+	auditEvents           *repotest.AuditEventRepo
+	roleUsecase           *roleUsecase.RoleUsecase
+	sessionUsecase        *sessionUsecase.SessionUsecase
+	serviceAccountUsecase *serviceAccountUsecase.ServiceAccountUsecase
+	apiKeyUsecase         *apiKeyUsecase.APIKeyUsecase
+	userAdminUsecase      *userAdminUsecase.UserAdminUsecase
+	authMiddleware        *middleware.AuthMiddleware
+	sessionStore          *sessions.CookieStore
+	otherUser             *entity.User
+	userToken             string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	ctx := context.Background()
+
+	router := mux.NewRouter()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{JWTAlgorithm: token.AlgorithmEdDSA, JWTExpiration: 3600, ServiceAccountTokenExpiration: 300, ImpersonationExpiration: 900}
+	keyring, err := token.NewKeyring(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	jwtMaker := token.NewJWTMaker(keyring, server.URL)
+
+	otherUser := &entity.User{ID: uuid.NewString(), Email: "john@example.com", EmailVerified: true, Name: "John Roe"}
+	users := repotest.NewUserRepo(&entity.User{
+		ID:            "user-1",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane Doe",
+		FirstName:     "Jane",
+		LastName:      "Doe",
+	}, otherUser)
+	roleRepo := repotest.NewRoleRepo()
+	roleUsecase := roleUsecase.NewRoleUsecase(roleRepo, users, cfg)
+	if err := roleUsecase.Seed(ctx); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	auditEvents := repotest.NewAuditEventRepo()
+	sessionUsecase := sessionUsecase.NewSessionUsecase(repotest.NewSessionRepo(), users, auditEvents, roleUsecase, jwtMaker, cfg)
+	serviceAccountUsecase := serviceAccountUsecase.NewServiceAccountUsecase(repotest.NewServiceAccountRepo(), jwtMaker, cfg)
+	apiKeyUsecase := apiKeyUsecase.NewAPIKeyUsecase(repotest.NewAPIKeyRepo())
+	userAdminUsecase := userAdminUsecase.NewUserAdminUsecase(users, repotest.NewIdentityRepo(users), auditEvents, sessionUsecase, roleUsecase, nil)
+	sessionStore := sessions.NewCookieStore([]byte("test"))
+	authMiddleware := middleware.NewAuthMiddleware(&fakeUserUsecase{repo: users}, sessionUsecase, serviceAccountUsecase, apiKeyUsecase, userAdminUsecase, sessionStore, jwtMaker, nil, "")
+
+	userTokens, err := sessionUsecase.Start(ctx, "user-1", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	whoami := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := principal.FromContext(r.Context())
+		w.Write([]byte(p.ID))
+	})
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(authMiddleware.Handle)
+	meGroup := api.PathPrefix("/me").Subrouter()
+	meGroup.Handle("", middleware.RequireScope(entity.ScopeProfileRead)(whoami)).Methods("GET")
+	meGroup.Handle("/preferences", middleware.RequireScope(entity.ScopePreferencesRead)(ok)).Methods("GET")
+	accountGroup := meGroup.NewRoute().Subrouter()
+	accountGroup.Use(middleware.RequireUser)
+	accountGroup.Handle("", ok).Methods("DELETE")
+	accountGroup.Handle("/sessions", ok).Methods("GET")
+	accountGroup.Handle("/passkeys", ok).Methods("GET")
+	accountGroup.Handle("/identities/{provider}/link", ok).Methods("GET")
+	usersGroup := api.PathPrefix("/users").Subrouter()
+	usersGroup.Use(middleware.RequirePermission(entity.PermissionUsersRead))
+	usersGroup.Handle("", ok).Methods("GET")
+
+	return &testServer{
+		server:                server,
+		router:                router,
+		api:                   api,
+		account:               accountGroup,
+		admin:                 api.PathPrefix("/admin").Subrouter(),
+		jwtMaker:              jwtMaker,
+		users:                 users,
+		roleRepo:              roleRepo,
+		auditEvents:           auditEvents,
+		roleUsecase:           roleUsecase,
+		sessionUsecase:        sessionUsecase,
+		serviceAccountUsecase: serviceAccountUsecase,
+		apiKeyUsecase:         apiKeyUsecase,
+		userAdminUsecase:      userAdminUsecase,
+		authMiddleware:        authMiddleware,
+		sessionStore:          sessionStore,
+		otherUser:             otherUser,
+		userToken:             userTokens.AccessToken,
+	}
+}
+
+// do sends a request as the signed-in user without following redirects.
+func (s *testServer) do(t *testing.T, method, target, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.userToken)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, target, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (s *testServer) status(t *testing.T, path, accessToken string) int {
+	t.Helper()
+	return s.statusWith(t, "GET", path, "Bearer "+accessToken)
+}
+
+func (s *testServer) statusWith(t *testing.T, method, path, authorization string) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, s.server.URL+path, nil)
+	req.Header.Set("Authorization", authorization)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// adminToken makes the signed-in user an admin and returns an access token
+// carrying the admin permissions.
+func (s *testServer) adminToken(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	admin, err := s.roleRepo.FindByName(ctx, entity.RoleAdmin)
+	if err != nil {
+		t.Fatalf("FindByName: %v", err)
+	}
+	s.roleRepo.Assign(ctx, "user-1", admin.ID)
+	tokens, err := s.sessionUsecase.Start(ctx, "user-1", "", "", "", "")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return tokens.AccessToken
+}
+
+// sessionCookie returns the cookie of a browser signed in with accessToken.
+func (s *testServer) sessionCookie(t *testing.T, accessToken string) *http.Cookie {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	cookieSession, _ := s.sessionStore.Get(r, "session")
+	cookieSession.Values["access_token"] = accessToken
+	if err := cookieSession.Save(r, w); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return w.Result().Cookies()[0]
+}
@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+type HttpSessionHandler struct {
+	sessionUsecase usecase.SessionUsecase
+	sessionStore   sessions.Store
+}
+
+func NewHttpSessionHandler(sessionUsecase usecase.SessionUsecase, sessionStore sessions.Store) *HttpSessionHandler {
+	return &HttpSessionHandler{
+		sessionUsecase: sessionUsecase,
+		sessionStore:   sessionStore,
+	}
+}
+
+// @Summary List sessions
+// @Description Lists the active sessions of the current user, most recently used first
+// @Tags Sessions
+// @Produce json
+// @Success 200 {array} dto.SessionResponse
+// @Router /me/sessions [get]
+func (h *HttpSessionHandler) FindSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+	sessionID := principal.SessionID(ctx)
+
+	sessions, err := h.sessionUsecase.FindByUserID(ctx, userID)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToSessionResponseList(sessions, sessionID))
+}
+
+// @Summary Revoke a session
+// @Description Signs the session out. Revoking the current session also clears the session cookie
+// @Tags Sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{} "session revoked"
+// @Failure 404 {string} string
+// @Router /me/sessions/{id} [delete]
+func (h *HttpSessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+	sessionID := principal.SessionID(ctx)
+	id := mux.Vars(r)["id"]
+
+	if err := h.sessionUsecase.RevokeForUser(ctx, userID, id); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if id == sessionID {
+		cookieSession, _ := h.sessionStore.Get(r, "session")
+		cookieSession.Values["access_token"] = ""
+		cookieSession.Values["refresh_token"] = ""
+		cookieSession.Save(r, w)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "session revoked"})
+}
+
+// @Summary Revoke other sessions
+// @Description Signs out every session of the current user except this one
+// @Tags Sessions
+// @Produce json
+// @Success 200 {object} map[string]interface{} "other sessions revoked"
+// @Router /me/sessions/revoke-others [post]
+func (h *HttpSessionHandler) RevokeOthers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+	sessionID := principal.SessionID(ctx)
+
+	if err := h.sessionUsecase.RevokeByUserID(ctx, userID, sessionID); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "other sessions revoked"})
+}
@@ -1,175 +1,170 @@
 package rest
 
 import (
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"math"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
 
-	"cloud.google.com/go/auth/credentials/idtoken"
 	"github.com/KimNattanan/go-user-service/internal/dto"
 	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/middleware"
+	"github.com/KimNattanan/go-user-service/internal/principal"
 	"github.com/KimNattanan/go-user-service/internal/usecase"
 	"github.com/KimNattanan/go-user-service/pkg/apperror"
-	"github.com/KimNattanan/go-user-service/pkg/token"
 	"github.com/asaskevich/govalidator"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
-	"golang.org/x/oauth2"
 )
 
 type HttpUserHandler struct {
-	userUsecase       usecase.UserUsecase
-	sessionUsecase    usecase.SessionUsecase
-	sessionStore      sessions.Store
-	googleOauthConfig *oauth2.Config
-	jwtMaker          *token.JWTMaker
-	jwtExpiration     time.Duration
+	userUsecase          usecase.UserUsecase
+	sessionUsecase       usecase.SessionUsecase
+	mfaUsecase           usecase.MFAUsecase
+	identityUsecase      usecase.IdentityUsecase
+	passkeyUsecase       usecase.PasskeyUsecase
+	loginThrottleUsecase usecase.LoginThrottleUsecase
+	sessionStore         sessions.Store
+	loginErrorURL        string
 }
 
-func NewHttpUserHandler(userUsecase usecase.UserUsecase, sessionUsecase usecase.SessionUsecase, sessionStore sessions.Store, googleOauthConfig *oauth2.Config, jwtMaker *token.JWTMaker, jwtExpiration int) *HttpUserHandler {
+func NewHttpUserHandler(userUsecase usecase.UserUsecase, sessionUsecase usecase.SessionUsecase, mfaUsecase usecase.MFAUsecase, identityUsecase usecase.IdentityUsecase, passkeyUsecase usecase.PasskeyUsecase, loginThrottleUsecase usecase.LoginThrottleUsecase, sessionStore sessions.Store, loginErrorURL string) *HttpUserHandler {
 	return &HttpUserHandler{
-		userUsecase:       userUsecase,
-		sessionUsecase:    sessionUsecase,
-		sessionStore:      sessionStore,
-		googleOauthConfig: googleOauthConfig,
-		jwtMaker:          jwtMaker,
-		jwtExpiration:     time.Duration(jwtExpiration),
+		userUsecase:          userUsecase,
+		sessionUsecase:       sessionUsecase,
+		mfaUsecase:           mfaUsecase,
+		identityUsecase:      identityUsecase,
+		passkeyUsecase:       passkeyUsecase,
+		loginThrottleUsecase: loginThrottleUsecase,
+		sessionStore:         sessionStore,
+		loginErrorURL:        loginErrorURL,
 	}
 }
 
-// @Summary Redirect to Google OAuth login
-// @Description Redirects user to Google OAuth provider
+// @Summary Redirect to an identity provider
+// @Description Redirects the user to the login page of a configured provider such as google, github or microsoft
 // @Tags Auth
+// @Param provider path string true "Provider name"
+// @Param return_to query string false "Allowlisted URL to redirect to after the callback"
+// @Param auth_mode query string false "bearer to get the tokens in the response body instead of the session cookie"
 // @Success 302
-// @Router /auth/google/login [get]
-func (h *HttpUserHandler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
-	b := make([]byte, 16)
-	rand.Read(b)
-	state := base64.URLEncoding.EncodeToString(b)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauthstate",
-		Value:    state,
-		Expires:  time.Now().Add(10 * time.Minute),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
-	url := h.googleOauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "select_account"))
-
-	w.Header().Set("Location", url)
-	w.WriteHeader(http.StatusFound)
+// @Failure 400 {string} string
+// @Failure 404 {string} string
+// @Router /auth/{provider}/login [get]
+func (h *HttpUserHandler) ProviderLogin(w http.ResponseWriter, r *http.Request) {
+	redirectToProvider(w, r, h.sessionStore, h.identityUsecase, mux.Vars(r)["provider"], "")
 }
 
-// @Summary OAuth callback from Google
-// @Description Handles Google OAuth callback and creates a session
+// @Summary OAuth callback from an identity provider
+// @Description Handles the provider callback. Signs the user in (or responds with an MFA challenge), or completes linking the identity started from /me/identities.
+// @Description Flows started with return_to redirect there on success, with an MFA challenge as the mfa_challenge_token fragment. When LOGIN_ERROR_URL is set, failures redirect there with an error code
 // @Tags Auth
 // @Produce json
+// @Param provider path string true "Provider name"
 // @Success 200 {object} map[string]interface{} "logged in successfully"
+// @Success 302
 // @Failure 400 {string} string
 // @Failure 401 {string} string
-// @Router /auth/google/callback [get]
-func (h *HttpUserHandler) GoogleCallback(w http.ResponseWriter, r *http.Request) {
+// @Failure 403 {string} string
+// @Router /auth/{provider}/callback [get]
+func (h *HttpUserHandler) ProviderCallback(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
-	query := r.URL.Query()
-	if state, err := r.Cookie("oauthstate"); err != nil || state.Value != query.Get("state") {
-		http.Error(w, "invalid oauth state", http.StatusUnauthorized)
+	providerName := mux.Vars(r)["provider"]
+	state, bearer, err := consumeOAuthState(w, r, h.sessionStore)
+	if err != nil {
+		h.loginFailed(w, r, err)
 		return
 	}
+	query := r.URL.Query()
 	code := query.Get("code")
-	if code == "" {
-		http.Error(w, "code not found", http.StatusBadRequest)
-		return
+	if query.Get("error") != "" {
+		// Still redeem the state so it cannot be used again.
+		code = ""
+	}
+	auth, err := h.identityUsecase.CompleteAuthorization(ctx, providerName, state, code)
+	if query.Get("error") != "" {
+		err = apperror.ErrAccessDenied
 	}
-	token, err := h.googleOauthConfig.Exchange(ctx, code)
 	if err != nil {
-		http.Error(w, "failed to exchange token", http.StatusUnauthorized)
+		h.loginFailed(w, r, err)
 		return
 	}
 
-	rawIDToken, ok := token.Extra("id_token").(string)
-	if !ok {
-		http.Error(w, "id_token missing", http.StatusUnauthorized)
+	if auth.LinkUserID != "" {
+		if _, err := h.identityUsecase.Link(ctx, auth.LinkUserID, auth.Claims); err != nil {
+			h.loginFailed(w, r, err)
+			return
+		}
+		if auth.ReturnTo != "" {
+			http.Redirect(w, r, auth.ReturnTo, http.StatusFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"message": "identity linked"})
 		return
 	}
 
-	payload, err := idtoken.Validate(ctx, rawIDToken, h.googleOauthConfig.ClientID)
+	user, err := h.identityUsecase.LoginOrRegister(ctx, auth.Claims)
 	if err != nil {
-		http.Error(w, "invalid id token", http.StatusUnauthorized)
+		h.loginFailed(w, r, err)
 		return
 	}
-
-	userInfo := map[string]interface{}{
-		"sub":            payload.Subject,
-		"email":          payload.Claims["email"],
-		"email_verified": payload.Claims["email_verified"],
-		"name":           payload.Claims["name"],
-		"given_name":     payload.Claims["given_name"],
-		"family_name":    payload.Claims["family_name"],
-		"picture":        payload.Claims["picture"],
-	}
-	if userInfo["email_verified"] != true {
-		http.Error(w, "email not verified", http.StatusUnauthorized)
+	if user.TOTPEnabled {
+		if auth.ReturnTo == "" {
+			h.writeMFAChallenge(w, r, user, providerName, auth.ProviderRefreshToken)
+			return
+		}
+		challengeToken, err := h.mfaUsecase.CreateChallenge(ctx, user, providerName, auth.ProviderRefreshToken)
+		if err != nil {
+			h.loginFailed(w, r, err)
+			return
+		}
+		// The fragment keeps the challenge out of server logs and referrers.
+		http.Redirect(w, r, withFragment(auth.ReturnTo, url.Values{"mfa_challenge_token": {challengeToken}}), http.StatusFound)
 		return
 	}
-
-	user, err := h.userUsecase.LoginOrRegisterWithGoogle(ctx, userInfo)
+	tokens, err := h.startSession(w, r, user, providerName, auth.ProviderRefreshToken, bearer)
 	if err != nil {
-		http.Error(w, err.Error(), apperror.StatusCode(err))
+		h.loginFailed(w, r, err)
 		return
 	}
 
-	refreshToken, refreshClaims, err := h.jwtMaker.CreateToken(user.ID, time.Second*h.jwtExpiration)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	accessToken, _, err := h.jwtMaker.CreateToken(user.ID, time.Hour)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if auth.ReturnTo != "" {
+		http.Redirect(w, r, auth.ReturnTo, http.StatusFound)
 		return
 	}
+	writeSessionStarted(w, tokens, "logged in successfully")
+}
 
-	session := &entity.Session{
-		ID:                 refreshClaims.RegisteredClaims.ID,
-		UserID:             user.ID,
-		GoogleRefreshToken: token.RefreshToken,
-		IsRevoked:          false,
-		CreatedAt:          time.Now(),
-		ExpiresAt:          refreshClaims.RegisteredClaims.ExpiresAt.Time,
-	}
-	if err := h.sessionUsecase.Create(ctx, session); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// loginFailed sends a browser to the configured login error page with a
+// machine-readable error code, or answers with a plain error when none is
+// configured.
+func (h *HttpUserHandler) loginFailed(w http.ResponseWriter, r *http.Request, err error) {
+	if h.loginErrorURL == "" {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauthstate",
-		Expires:  time.Now(),
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
-	cookieSession, _ := h.sessionStore.Get(r, "session")
-	cookieSession.Values["access_token"] = accessToken
-	cookieSession.Values["refresh_token"] = refreshToken
-	if err := cookieSession.Save(r, w); err != nil {
+	errorURL, parseErr := url.Parse(h.loginErrorURL)
+	if parseErr != nil {
 		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "logged in successfully"})
+	query := errorURL.Query()
+	query.Set("error", loginErrorCode(err))
+	errorURL.RawQuery = query.Encode()
+	http.Redirect(w, r, errorURL.String(), http.StatusFound)
 }
 
 // @Summary Register new user
 // @Tags Auth
 // @Produce json
+// @Param auth_mode query string false "bearer to get the tokens in the response body instead of the session cookie"
 // @Success 200 {object} map[string]interface{} "registered successfully"
 // @Failure 400 {string} string
 // @Failure 401 {string} string
+// @Failure 422 {object} dto.ValidationErrorResponse
 // @Router /auth/register [post]
 func (h *HttpUserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -180,10 +175,8 @@ func (h *HttpUserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
 		return
 	}
-	ok, errr := govalidator.ValidateStruct(req)
-	fmt.Println(ok, errr, "!!")
-	if !ok {
-		http.Error(w, errr.Error(), http.StatusBadRequest)
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -197,58 +190,135 @@ func (h *HttpUserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, err := h.userUsecase.Register(ctx, user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tokens, err := h.startSession(w, r, user, "", "", bearerMode(r))
 	if err != nil {
 		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
 
-	refreshToken, refreshClaims, err := h.jwtMaker.CreateToken(user.ID, time.Second*h.jwtExpiration)
+	writeSessionStarted(w, tokens, "registered successfully")
+}
+
+// @Summary Login user
+// @Description Responds with an MFA challenge instead of a session when the user has enrolled a second factor.
+// @Description Repeated failures are delayed (429) and eventually lock the account (423), both with a Retry-After header.
+// @Description Disabled accounts, and accounts an admin has flagged for a password reset, are refused (403); the latter are emailed a reset link
+// @Tags Auth
+// @Produce json
+// @Param auth_mode query string false "bearer to get the tokens in the response body instead of the session cookie"
+// @Success 200 {object} map[string]interface{} "logged in successfully"
+// @Failure 400 {string} string
+// @Failure 401 {string} string
+// @Failure 403 {string} string
+// @Failure 423 {string} string
+// @Failure 429 {string} string
+// @Router /auth/login [post]
+func (h *HttpUserHandler) Login(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.LoginRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.throttled(w, r, req.Email) {
+		return
+	}
+
+	user, err := h.userUsecase.Login(ctx, req.Email, req.Password)
+	if errors.Is(err, apperror.ErrRecordNotFound) || errors.Is(err, apperror.ErrIncorrectPassword) {
+		if err := h.loginThrottleUsecase.RecordFailure(ctx, req.Email, middleware.ClientIP(r)); err != nil {
+			http.Error(w, err.Error(), apperror.StatusCode(err))
+			return
+		}
+		http.Error(w, "invalid email or password", http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	// The counter is only cleared once the second factor has been passed too,
+	// otherwise the password alone would buy unlimited challenges.
+	if user.TOTPEnabled {
+		h.writeMFAChallenge(w, r, user, "", "")
 		return
 	}
-	accessToken, _, err := h.jwtMaker.CreateToken(user.ID, time.Hour)
+
+	tokens, err := h.startSession(w, r, user, "", "", bearerMode(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if err := h.loginThrottleUsecase.Reset(ctx, req.Email); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
 
-	session := &entity.Session{
-		ID:                 refreshClaims.RegisteredClaims.ID,
-		UserID:             user.ID,
-		GoogleRefreshToken: "",
-		IsRevoked:          false,
-		CreatedAt:          time.Now(),
-		ExpiresAt:          refreshClaims.RegisteredClaims.ExpiresAt.Time,
+	writeSessionStarted(w, tokens, "logged in successfully")
+}
+
+// @Summary Refresh bearer tokens
+// @Description Rotates a refresh token obtained with auth_mode=bearer. Presenting a refresh token that was already rotated signs out every session descending from the same login
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dto.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} dto.TokenResponse
+// @Failure 400 {string} string
+// @Failure 401 {string} string
+// @Router /auth/refresh [post]
+func (h *HttpUserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.RefreshTokenRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
 	}
-	if err := h.sessionUsecase.Create(ctx, session); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	cookieSession, _ := h.sessionStore.Get(r, "session")
-	cookieSession.Values["access_token"] = accessToken
-	cookieSession.Values["refresh_token"] = refreshToken
-	if err := cookieSession.Save(r, w); err != nil {
+	_, tokens, err := h.sessionUsecase.Refresh(ctx, req.RefreshToken, "", r.UserAgent(), middleware.ClientIP(r))
+	if err != nil {
 		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "registered successfully"})
+	json.NewEncoder(w).Encode(dto.ToTokenResponse(tokens))
 }
 
-// @Summary Login user
+// @Summary Complete a login with a second factor
+// @Description Exchanges an MFA challenge token and a TOTP or recovery code for a session
 // @Tags Auth
+// @Accept json
 // @Produce json
+// @Param request body dto.MFAVerifyRequest true "Challenge token and code"
+// @Param auth_mode query string false "bearer to get the tokens in the response body instead of the session cookie"
 // @Success 200 {object} map[string]interface{} "logged in successfully"
 // @Failure 400 {string} string
-// @Failure 401 {string} string
-// @Router /auth/login [post]
-func (h *HttpUserHandler) Login(w http.ResponseWriter, r *http.Request) {
+// @Failure 423 {string} string
+// @Failure 429 {string} string
+// @Router /auth/mfa/verify [post]
+func (h *HttpUserHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
 
-	req := new(dto.LoginRequest)
+	req := new(dto.MFAVerifyRequest)
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
 		return
@@ -258,45 +328,329 @@ func (h *HttpUserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userUsecase.Login(ctx, req.Email, req.Password)
+	// Wrong codes count against the same email and IP as wrong passwords.
+	challenge, err := h.mfaUsecase.FindChallenge(ctx, req.ChallengeToken)
 	if err != nil {
-		http.Error(w, "invalid email or password", http.StatusUnauthorized)
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if h.throttled(w, r, challenge.Email) {
 		return
 	}
 
-	refreshToken, refreshClaims, err := h.jwtMaker.CreateToken(user.ID, time.Second*h.jwtExpiration)
+	user, provider, providerRefreshToken, err := h.mfaUsecase.VerifyChallenge(ctx, req.ChallengeToken, req.Code)
+	if errors.Is(err, apperror.ErrInvalidCode) {
+		if err := h.loginThrottleUsecase.RecordFailure(ctx, challenge.Email, middleware.ClientIP(r)); err != nil {
+			http.Error(w, err.Error(), apperror.StatusCode(err))
+			return
+		}
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
-	accessToken, _, err := h.jwtMaker.CreateToken(user.ID, time.Hour)
+
+	tokens, err := h.startSession(w, r, user, provider, providerRefreshToken, bearerMode(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if err := h.loginThrottleUsecase.Reset(ctx, challenge.Email); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
 
-	session := &entity.Session{
-		ID:                 refreshClaims.RegisteredClaims.ID,
-		UserID:             user.ID,
-		GoogleRefreshToken: "",
-		IsRevoked:          false,
-		CreatedAt:          time.Now(),
-		ExpiresAt:          refreshClaims.RegisteredClaims.ExpiresAt.Time,
+	writeSessionStarted(w, tokens, "logged in successfully")
+}
+
+// @Summary Start passwordless email login
+// @Description Emails a magic link or a 6-digit code. Always responds the same way whether or not the address is registered
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dto.EmailLoginStartRequest true "Email address and delivery method (link or code)"
+// @Success 200 {object} map[string]interface{} "sign-in email sent"
+// @Failure 400 {string} string
+// @Failure 423 {string} string
+// @Failure 429 {string} string
+// @Router /auth/email/start [post]
+func (h *HttpUserHandler) StartEmailLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.EmailLoginStartRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if err := h.sessionUsecase.Create(ctx, session); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if h.throttled(w, r, req.Email) {
 		return
 	}
 
-	cookieSession, _ := h.sessionStore.Get(r, "session")
-	cookieSession.Values["access_token"] = accessToken
-	cookieSession.Values["refresh_token"] = refreshToken
-	if err := cookieSession.Save(r, w); err != nil {
+	if err := h.userUsecase.StartEmailLogin(ctx, req.Email, req.Method); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "if the address can sign in, an email has been sent"})
+}
+
+// @Summary Complete passwordless email login
+// @Description Exchanges the emailed link token or code for a session. Responds with an MFA challenge when the user has enrolled a second factor
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dto.EmailLoginCompleteRequest true "Email address and either the link token or the code"
+// @Param auth_mode query string false "bearer to get the tokens in the response body instead of the session cookie"
+// @Success 200 {object} map[string]interface{} "logged in successfully"
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Failure 423 {string} string
+// @Failure 429 {string} string
+// @Router /auth/email/complete [post]
+func (h *HttpUserHandler) CompleteEmailLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.EmailLoginCompleteRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	secret := req.Token
+	if secret == "" {
+		secret = req.Code
+	}
+	if secret == "" {
+		http.Error(w, apperror.ErrRequiredField.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.throttled(w, r, req.Email) {
+		return
+	}
+
+	user, err := h.userUsecase.CompleteEmailLogin(ctx, req.Email, secret)
+	if errors.Is(err, apperror.ErrInvalidCode) {
+		if err := h.loginThrottleUsecase.RecordFailure(ctx, req.Email, middleware.ClientIP(r)); err != nil {
+			http.Error(w, err.Error(), apperror.StatusCode(err))
+			return
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if user.TOTPEnabled {
+		h.writeMFAChallenge(w, r, user, "", "")
+		return
+	}
+
+	tokens, err := h.startSession(w, r, user, "", "", bearerMode(r))
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if err := h.loginThrottleUsecase.Reset(ctx, req.Email); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	writeSessionStarted(w, tokens, "logged in successfully")
+}
+
+// @Summary Start passkey login
+// @Description Returns credential request options for a discoverable passkey
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} dto.PasskeyLoginBeginResponse
+// @Router /auth/passkey/login/begin [post]
+func (h *HttpUserHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	ceremonyID, options, err := h.passkeyUsecase.BeginLogin(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(&dto.PasskeyLoginBeginResponse{
+		CeremonyID: ceremonyID,
+		Options:    options,
+	})
+}
+
+// @Summary Finish passkey login
+// @Description Verifies the authenticator assertion and creates a session. Passkeys require user verification, so no further factor is asked for
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dto.PasskeyLoginFinishRequest true "Ceremony ID and assertion response"
+// @Param auth_mode query string false "bearer to get the tokens in the response body instead of the session cookie"
+// @Success 200 {object} map[string]interface{} "logged in successfully"
+// @Failure 400 {string} string
+// @Failure 401 {string} string
+// @Router /auth/passkey/login/finish [post]
+func (h *HttpUserHandler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.PasskeyLoginFinishRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.passkeyUsecase.FinishLogin(ctx, req.CeremonyID, req.Credential)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	tokens, err := h.startSession(w, r, user, "", "", bearerMode(r))
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	writeSessionStarted(w, tokens, "logged in successfully")
+}
+
+// @Summary Verify email address
+// @Description Consumes the token sent by email and marks the address as verified
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dto.VerifyEmailRequest true "Verification token"
+// @Success 200 {object} map[string]interface{} "email verified"
+// @Failure 400 {string} string
+// @Router /auth/verify-email [post]
+func (h *HttpUserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.VerifyEmailRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.userUsecase.VerifyEmail(ctx, req.Token); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "email verified"})
+}
+
+// @Summary Resend verification email
+// @Description Always responds the same way whether or not the address is registered
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dto.ResendVerificationRequest true "Email address"
+// @Success 200 {object} map[string]interface{} "verification email sent"
+// @Failure 400 {string} string
+// @Router /auth/verify-email/resend [post]
+func (h *HttpUserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.ResendVerificationRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userUsecase.ResendVerification(ctx, req.Email); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "if the address needs verification, an email has been sent"})
+}
+
+// @Summary Request a password reset
+// @Description Emails a reset link. Always responds the same way whether or not the address is registered
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dto.ForgotPasswordRequest true "Email address"
+// @Success 200 {object} map[string]interface{} "password reset email sent"
+// @Failure 400 {string} string
+// @Router /auth/password/forgot [post]
+func (h *HttpUserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.ForgotPasswordRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userUsecase.ForgotPassword(ctx, req.Email); err != nil {
 		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "logged in successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "if the address is registered, a password reset email has been sent"})
+}
+
+// @Summary Reset password
+// @Description Consumes a reset token, sets the new password and revokes every session of the user
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body dto.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]interface{} "password reset"
+// @Failure 400 {string} string
+// @Failure 422 {object} dto.ValidationErrorResponse
+// @Router /auth/password/reset [post]
+func (h *HttpUserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.ResetPasswordRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userUsecase.ResetPassword(ctx, req.Token, req.Password); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "password reset"})
 }
 
 // @Summary Logout user
@@ -308,26 +662,79 @@ func (h *HttpUserHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
 
-	cookieSession, err := h.sessionStore.Get(r, "session")
-	if err != nil {
-		http.Error(w, apperror.ErrUnauthorized.Error(), http.StatusUnauthorized)
+	sessionID := principal.SessionID(ctx)
+
+	if err := h.sessionUsecase.Revoke(ctx, sessionID); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
-	refreshToken, _ := cookieSession.Values["refresh_token"].(string)
-	refreshClaims, err := h.jwtMaker.VerfiyToken(refreshToken)
+	if cookieSession, err := h.sessionStore.Get(r, "session"); err == nil && !cookieSession.IsNew {
+		cookieSession.Values["access_token"] = ""
+		cookieSession.Values["refresh_token"] = ""
+		cookieSession.Save(r, w)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "logged out successfully"})
+}
+
+// @Summary Change password
+// @Description Requires the current password, or a recent login for accounts without one, and revokes every other session.
+// @Description Wrong current passwords count towards the login throttle, like failed logins
+// @Tags Me
+// @Accept json
+// @Produce json
+// @Param request body dto.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]interface{} "password changed"
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Failure 422 {object} dto.ValidationErrorResponse
+// @Failure 423 {string} string
+// @Failure 429 {string} string
+// @Router /me/password [post]
+func (h *HttpUserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	userID := principal.UserID(ctx)
+	sessionID := principal.SessionID(ctx)
+
+	req := new(dto.ChangePasswordRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Guessing the current password counts against the same throttle as the
+	// login form, so a stolen session cannot be used to try passwords.
+	user, err := h.userUsecase.FindByID(ctx, userID)
 	if err != nil {
-		http.Error(w, apperror.ErrUnauthorized.Error(), http.StatusUnauthorized)
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if h.throttled(w, r, user.Email) {
 		return
 	}
 
-	if err := h.sessionUsecase.Revoke(ctx, refreshClaims.RegisteredClaims.ID); err != nil {
+	err = h.userUsecase.ChangePassword(ctx, userID, sessionID, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, apperror.ErrIncorrectPassword) {
+		if err := h.loginThrottleUsecase.RecordFailure(ctx, user.Email, middleware.ClientIP(r)); err != nil {
+			http.Error(w, err.Error(), apperror.StatusCode(err))
+			return
+		}
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := h.loginThrottleUsecase.Reset(ctx, user.Email); err != nil {
 		http.Error(w, err.Error(), apperror.StatusCode(err))
 		return
 	}
-	cookieSession.Values["access_token"] = ""
-	cookieSession.Save(r, w)
 
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "logged out successfully"})
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "password changed"})
 }
 
 // @Summary Delete current user
@@ -338,7 +745,7 @@ func (h *HttpUserHandler) Logout(w http.ResponseWriter, r *http.Request) {
 func (h *HttpUserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
-	userID, _ := ctx.Value("userID").(string)
+	userID := principal.UserID(ctx)
 
 	if err := h.userUsecase.Delete(ctx, userID); err != nil {
 		http.Error(w, err.Error(), apperror.StatusCode(err))
@@ -349,11 +756,13 @@ func (h *HttpUserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get user by ID
+// @Description Requires the users:read permission
 // @Tags Users
 // @Accept json
 // @Produce json
 // @Param id path string true "User ID"
 // @Success 200 {object} dto.UserResponse
+// @Failure 403 {string} string
 // @Failure 404 {string} string
 // @Router /users/{id} [get]
 func (h *HttpUserHandler) FindUser(w http.ResponseWriter, r *http.Request) {
@@ -372,9 +781,11 @@ func (h *HttpUserHandler) FindUser(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get all users
+// @Description Requires the users:read permission
 // @Tags Users
 // @Produce json
 // @Success 200 {array} dto.UserResponse
+// @Failure 403 {string} string
 // @Router /users [get]
 func (h *HttpUserHandler) FindAllUsers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -397,7 +808,7 @@ func (h *HttpUserHandler) FindAllUsers(w http.ResponseWriter, r *http.Request) {
 func (h *HttpUserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
-	userID, _ := ctx.Value("userID").(string)
+	userID := principal.UserID(ctx)
 
 	user, err := h.userUsecase.FindByID(ctx, userID)
 	if err != nil {
@@ -419,7 +830,7 @@ func (h *HttpUserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 func (h *HttpUserHandler) Update(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	ctx := r.Context()
-	userID, _ := ctx.Value("userID").(string)
+	userID := principal.UserID(ctx)
 
 	var (
 		data0 dto.UserUpdateRequest
@@ -447,3 +858,65 @@ func (h *HttpUserHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(dto.ToUserResponse(user))
 }
+
+// startSession signs the user in. Browsers get the tokens in the session
+// cookie; in bearer mode they are returned for the response body instead.
+func (h *HttpUserHandler) startSession(w http.ResponseWriter, r *http.Request, user *entity.User, provider, providerRefreshToken string, bearer bool) (*dto.TokenResponse, error) {
+	tokens, err := h.sessionUsecase.Start(r.Context(), user.ID, provider, providerRefreshToken, r.UserAgent(), middleware.ClientIP(r))
+	if err != nil {
+		return nil, err
+	}
+	if bearer {
+		return dto.ToTokenResponse(tokens), nil
+	}
+
+	cookieSession, _ := h.sessionStore.Get(r, "session")
+	cookieSession.Values["access_token"] = tokens.AccessToken
+	cookieSession.Values["refresh_token"] = tokens.RefreshToken
+	return nil, cookieSession.Save(r, w)
+}
+
+// writeSessionStarted answers a successful login with the tokens in bearer
+// mode, or with message when they went into the cookie.
+func writeSessionStarted(w http.ResponseWriter, tokens *dto.TokenResponse, message string) {
+	if tokens != nil {
+		json.NewEncoder(w).Encode(tokens)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": message})
+}
+
+// bearerMode reports whether the client asked for the tokens in the response
+// body rather than the session cookie.
+func bearerMode(r *http.Request) bool {
+	return r.URL.Query().Get("auth_mode") == authModeBearer
+}
+
+// writeMFAChallenge answers a successful first factor with a challenge token
+// that must be redeemed at /auth/mfa/verify before a session is issued.
+func (h *HttpUserHandler) writeMFAChallenge(w http.ResponseWriter, r *http.Request, user *entity.User, provider, providerRefreshToken string) {
+	challengeToken, err := h.mfaUsecase.CreateChallenge(r.Context(), user, provider, providerRefreshToken)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	json.NewEncoder(w).Encode(&dto.MFAChallengeResponse{
+		MFARequired:    true,
+		ChallengeToken: challengeToken,
+	})
+}
+
+// throttled applies the login throttle to the email and the request's IP. It
+// answers the request, with Retry-After where known, when the caller has to
+// wait.
+func (h *HttpUserHandler) throttled(w http.ResponseWriter, r *http.Request, email string) bool {
+	retryAfter, err := h.loginThrottleUsecase.Check(r.Context(), email, middleware.ClientIP(r))
+	if err == nil {
+		return false
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	http.Error(w, err.Error(), apperror.StatusCode(err))
+	return true
+}
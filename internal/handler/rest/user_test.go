@@ -0,0 +1,127 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/handler/rest"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	loginThrottleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/loginthrottle"
+	userUsecase "github.com/KimNattanan/go-user-service/internal/usecase/user"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/mailer"
+)
+
+type fakeMailer struct {
+	mu       sync.Mutex
+	messages []*mailer.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var emailLoginCode = regexp.MustCompile(`code is (\d+)`)
+
+// lastCode returns the sign-in code of the last email sent.
+func (m *fakeMailer) lastCode(t *testing.T) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		t.Fatal("expected a sign-in email")
+	}
+	match := emailLoginCode.FindStringSubmatch(m.messages[len(m.messages)-1].Body)
+	if match == nil {
+		t.Fatal("expected a sign-in code in the email")
+	}
+	return match[1]
+}
+
+// fakeMFAUsecase hands out a challenge token for every user.
+type fakeMFAUsecase struct {
+	usecase.MFAUsecase
+	challenged []string // user IDs
+}
+
+func (u *fakeMFAUsecase) CreateChallenge(ctx context.Context, user *entity.User, provider, providerRefreshToken string) (string, error) {
+	u.challenged = append(u.challenged, user.ID)
+	return "challenge-token", nil
+}
+
+// serveEmailLogin adds the passwordless email login routes and returns the
+// mailer the codes are sent through.
+func (s *testServer) serveEmailLogin(mfaUsecase usecase.MFAUsecase) *fakeMailer {
+	cfg := &config.Config{
+		PasswordlessURL:      "https://app.example.com/login/email",
+		PasswordlessTTL:      600,
+		LoginMaxFailures:     5,
+		LoginDelayAfter:      3,
+		LoginMaxDelay:        30,
+		LoginFailureWindow:   900,
+		LoginLockoutDuration: 900,
+		LoginIPMaxFailures:   20,
+	}
+	mailer := &fakeMailer{}
+	userUsecase := userUsecase.NewUserUsecase(s.users, repotest.NewSessionRepo(), repotest.NewOneTimeTokenRepo(), repotest.NewPasswordHistoryRepo(), mailer, nil, nil, cfg)
+	loginThrottleUsecase := loginThrottleUsecase.NewLoginThrottleUsecase(repotest.NewLoginThrottleRepo(), cfg)
+	userHandler := rest.NewHttpUserHandler(userUsecase, s.sessionUsecase, mfaUsecase, nil, nil, loginThrottleUsecase, s.sessionStore, "")
+
+	s.router.HandleFunc("/api/v1/auth/email/start", userHandler.StartEmailLogin).Methods("POST")
+	s.router.HandleFunc("/api/v1/auth/email/complete", userHandler.CompleteEmailLogin).Methods("POST")
+	return mailer
+}
+
+func TestEmailLoginAsksForTheSecondFactor(t *testing.T) {
+	s := newTestServer(t)
+	mfa := &fakeMFAUsecase{}
+	mailer := s.serveEmailLogin(mfa)
+	s.users.Users["user-1"].TOTPEnabled = true
+
+	signIn := func(email string) map[string]interface{} {
+		t.Helper()
+		resp, err := http.Post(s.server.URL+"/api/v1/auth/email/start", "application/json", strings.NewReader(`{"email":"`+email+`","method":"code"}`))
+		if err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the code to be sent, got %d", resp.StatusCode)
+		}
+		resp, err = http.Post(s.server.URL+"/api/v1/auth/email/complete?auth_mode=bearer", "application/json", strings.NewReader(`{"email":"`+email+`","code":"`+mailer.lastCode(t)+`"}`))
+		if err != nil {
+			t.Fatalf("complete: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected the code to be accepted, got %d", resp.StatusCode)
+		}
+		body := map[string]interface{}{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return body
+	}
+
+	body := signIn("jane@example.com")
+	if body["mfa_required"] != true || body["challenge_token"] != "challenge-token" || body["access_token"] != nil {
+		t.Errorf("expected an MFA challenge instead of a session, got %v", body)
+	}
+	if len(mfa.challenged) != 1 || mfa.challenged[0] != "user-1" {
+		t.Errorf("expected the user to be challenged, got %v", mfa.challenged)
+	}
+
+	if body := signIn(s.otherUser.Email); body["access_token"] == nil || body["mfa_required"] != nil {
+		t.Errorf("expected a user without a second factor to get a session, got %v", body)
+	}
+}
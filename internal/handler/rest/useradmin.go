@@ -0,0 +1,411 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/middleware"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/asaskevich/govalidator"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+type HttpUserAdminHandler struct {
+	userAdminUsecase usecase.UserAdminUsecase
+	sessionStore     sessions.Store
+}
+
+func NewHttpUserAdminHandler(userAdminUsecase usecase.UserAdminUsecase, sessionStore sessions.Store) *HttpUserAdminHandler {
+	return &HttpUserAdminHandler{
+		userAdminUsecase: userAdminUsecase,
+		sessionStore:     sessionStore,
+	}
+}
+
+// @Summary Search users
+// @Description Matches the query against email and name, ordered by email
+// @Tags Admin
+// @Produce json
+// @Param q query string false "Search text"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Users per page, at most 100 (default 20)"
+// @Success 200 {object} dto.AdminUserListResponse
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Router /admin/users [get]
+func (h *HttpUserAdminHandler) Search(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	query := r.URL.Query()
+	page, err := intParam(query.Get("page"))
+	if err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	pageSize, err := intParam(query.Get("page_size"))
+	if err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.userAdminUsecase.Search(ctx, query.Get("q"), page, pageSize)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToAdminUserListResponse(users))
+}
+
+// @Summary Get a user
+// @Description Includes the user's preferences, linked identities and active sessions
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.AdminUserDetailResponse
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id} [get]
+func (h *HttpUserAdminHandler) FindByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	details, err := h.userAdminUsecase.FindByID(ctx, actor(r), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToAdminUserDetailResponse(details))
+}
+
+// @Summary Update a user
+// @Description Changing the email marks it unverified unless email_verified is sent too
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body dto.AdminUserUpdateRequest true "Fields to change"
+// @Success 200 {object} dto.AdminUserResponse
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Router /admin/users/{id} [patch]
+func (h *HttpUserAdminHandler) Update(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	var (
+		data0 dto.AdminUserUpdateRequest
+		data  map[string]interface{}
+	)
+	if err := json.NewDecoder(r.Body).Decode(&data0); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(data0); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dataBytes, err := json.Marshal(data0)
+	if err != nil {
+		http.Error(w, apperror.ErrInternalServer.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.Unmarshal(dataBytes, &data); err != nil {
+		http.Error(w, apperror.ErrInternalServer.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.userAdminUsecase.Update(ctx, actor(r), mux.Vars(r)["id"], data)
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToAdminUserResponse(user))
+}
+
+// @Summary Disable a user
+// @Description Blocks every way of signing in and revokes the user's sessions. API keys stop working until the user is enabled
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.AdminUserResponse
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/disable [post]
+func (h *HttpUserAdminHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	user, err := h.userAdminUsecase.Disable(ctx, actor(r), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToAdminUserResponse(user))
+}
+
+// @Summary Enable a user
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.AdminUserResponse
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/enable [post]
+func (h *HttpUserAdminHandler) Enable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	user, err := h.userAdminUsecase.Enable(ctx, actor(r), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToAdminUserResponse(user))
+}
+
+// @Summary Force a password reset
+// @Description The user's next password login is refused and emails them a reset link instead, until they set a new password
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} dto.AdminUserResponse
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/password-reset [post]
+func (h *HttpUserAdminHandler) RequirePasswordReset(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	user, err := h.userAdminUsecase.RequirePasswordReset(ctx, actor(r), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(dto.ToAdminUserResponse(user))
+}
+
+// @Summary Sign a user out everywhere
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{} "sessions revoked"
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/sessions [delete]
+func (h *HttpUserAdminHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	if err := h.userAdminUsecase.RevokeSessions(ctx, actor(r), mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "sessions revoked"})
+}
+
+// @Summary Unlock a user's password login
+// @Description Clears the failure counter, progressive delay and lock of the user's email
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{} "account unlocked"
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/lockout [delete]
+func (h *HttpUserAdminHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	if err := h.userAdminUsecase.Unlock(ctx, actor(r), mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "account unlocked"})
+}
+
+// @Summary Assign a role to a user
+// @Description The user's permissions change when their access token is next refreshed
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param request body dto.AssignRoleRequest true "Role"
+// @Success 200 {object} map[string]interface{} "role assigned"
+// @Failure 400 {string} string
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/roles [post]
+func (h *HttpUserAdminHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	req := new(dto.AssignRoleRequest)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, apperror.ErrInvalidData.Error(), http.StatusBadRequest)
+		return
+	}
+	if ok, err := govalidator.ValidateStruct(req); !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userAdminUsecase.AssignRole(ctx, actor(r), mux.Vars(r)["id"], req.Role); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "role assigned"})
+}
+
+// @Summary Take a role away from a user
+// @Description The last admin cannot lose the admin role
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param role path string true "Role name"
+// @Success 200 {object} map[string]interface{} "role unassigned"
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Failure 409 {string} string
+// @Router /admin/users/{id}/roles/{role} [delete]
+func (h *HttpUserAdminHandler) UnassignRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	vars := mux.Vars(r)
+
+	if err := h.userAdminUsecase.UnassignRole(ctx, actor(r), vars["id"], vars["role"]); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "role unassigned"})
+}
+
+// @Summary Delete a user
+// @Description Permanently deletes the user and everything they own. Audit events are kept
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{} "user deleted"
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id} [delete]
+func (h *HttpUserAdminHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	if err := h.userAdminUsecase.Delete(ctx, actor(r), mux.Vars(r)["id"]); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "user deleted"})
+}
+
+// @Summary Impersonate a user
+// @Description Starts a read-only session as the user, to see what they see. Its tokens carry the admin in the act claim, cannot be refreshed and expire after IMPERSONATION_EXPIRATION.
+// @Description Browsers keep their own session in the cookie and get it back when impersonation ends; in bearer mode the tokens are returned instead. Every request made while impersonating is audited
+// @Tags Admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param auth_mode query string false "bearer to get the tokens in the response body instead of the session cookie"
+// @Success 200 {object} map[string]interface{} "impersonation started"
+// @Failure 403 {string} string
+// @Failure 404 {string} string
+// @Router /admin/users/{id}/impersonate [post]
+func (h *HttpUserAdminHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	// Only a person signed in as themselves can impersonate, not a service
+	// account or an API key.
+	if p, ok := principal.FromContext(ctx); !ok || !p.HasSession() || p.IsImpersonated() {
+		http.Error(w, apperror.ErrForbidden.Error(), http.StatusForbidden)
+		return
+	}
+	tokens, err := h.userAdminUsecase.Impersonate(ctx, actor(r), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if bearerMode(r) {
+		json.NewEncoder(w).Encode(dto.ToTokenResponse(tokens))
+		return
+	}
+
+	cookieSession, _ := h.sessionStore.Get(r, "session")
+	cookieSession.Values["impersonation_access_token"] = tokens.AccessToken
+	if err := cookieSession.Save(r, w); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "impersonation started"})
+}
+
+// @Summary Stop impersonating
+// @Description Revokes the impersonation session. Browsers are back on the admin's own session
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]interface{} "impersonation ended"
+// @Failure 403 {string} string
+// @Router /auth/impersonation [delete]
+func (h *HttpUserAdminHandler) StopImpersonation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	p, ok := principal.FromContext(ctx)
+	if !ok || !p.IsImpersonated() {
+		http.Error(w, apperror.ErrOperationDenied.Error(), http.StatusForbidden)
+		return
+	}
+	if err := h.userAdminUsecase.EndImpersonation(ctx, actor(r), p.ID, p.SessionID); err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	if cookieSession, err := h.sessionStore.Get(r, "session"); err == nil && !cookieSession.IsNew {
+		delete(cookieSession.Values, "impersonation_access_token")
+		cookieSession.Save(r, w)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "impersonation ended"})
+}
+
+// actor returns who is making an admin request, for the audit log. While
+// impersonating, that is the admin rather than the user.
+func actor(r *http.Request) *entity.Actor {
+	actor := &entity.Actor{IPAddress: middleware.ClientIP(r), UserAgent: r.UserAgent()}
+	if p, ok := principal.FromContext(r.Context()); ok {
+		actor.ID = p.ID
+		actor.Type = string(p.Type)
+		if p.IsImpersonated() {
+			actor.ID = p.ImpersonatorID
+		}
+	}
+	return actor
+}
+
+// intParam parses an optional integer query parameter, zero when absent.
+func intParam(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
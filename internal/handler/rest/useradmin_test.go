@@ -0,0 +1,171 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/handler/rest"
+	"github.com/KimNattanan/go-user-service/internal/middleware"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// serveImpersonation adds the routes starting and ending an impersonation,
+// and the API key routes as an example of account settings an impersonating
+// admin is kept away from.
+func (s *testServer) serveImpersonation() {
+	userAdminHandler := rest.NewHttpUserAdminHandler(s.userAdminUsecase, s.sessionStore)
+	s.api.HandleFunc("/auth/impersonation", userAdminHandler.StopImpersonation).Methods("DELETE")
+	s.admin.Handle("/users/{id}/impersonate", middleware.RequirePermission(entity.PermissionUsersImpersonate)(http.HandlerFunc(userAdminHandler.Impersonate))).Methods("POST")
+	s.serveAPIKeys()
+}
+
+func TestImpersonation(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	s.serveImpersonation()
+	impersonatePath := "/api/v1/admin/users/" + s.otherUser.ID + "/impersonate?auth_mode=bearer"
+
+	if status := s.statusWith(t, "POST", impersonatePath, "Bearer "+s.userToken); status != http.StatusForbidden {
+		t.Errorf("expected a user without users:impersonate to be refused, got %d", status)
+	}
+
+	adminToken := s.adminToken(t)
+	req, _ := http.NewRequest("POST", s.server.URL+impersonatePath, nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("impersonate: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected impersonation to start, got %d", resp.StatusCode)
+	}
+	var tokens dto.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if tokens.ExpiresIn > 900 || tokens.RefreshTokenExpiresIn > 900 {
+		t.Errorf("expected both tokens to expire with the impersonation, got %d and %d", tokens.ExpiresIn, tokens.RefreshTokenExpiresIn)
+	}
+
+	claims := &token.UserClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokens.AccessToken, claims); err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if claims.ID != s.otherUser.ID || claims.Actor == nil || claims.Actor.Subject != "user-1" || len(claims.Permissions) != 0 {
+		t.Errorf("expected a token for the user naming the admin in act, got %+v", claims)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/api/v1/me", http.StatusOK},
+		{"GET", "/api/v1/me/preferences", http.StatusOK},
+		{"DELETE", "/api/v1/me", http.StatusForbidden},
+		{"GET", "/api/v1/me/identities/google/link", http.StatusForbidden},
+		{"GET", "/api/v1/me/sessions", http.StatusForbidden},
+		{"GET", "/api/v1/me/api-keys", http.StatusForbidden},
+		{"POST", "/api/v1/me/api-keys", http.StatusForbidden},
+		{"GET", "/api/v1/me/passkeys", http.StatusForbidden},
+		{"GET", "/api/v1/users", http.StatusForbidden},
+		{"POST", "/api/v1/admin/users/" + s.otherUser.ID + "/impersonate", http.StatusForbidden},
+	} {
+		if status := s.statusWith(t, tc.method, tc.path, "Bearer "+tokens.AccessToken); status != tc.want {
+			t.Errorf("%s %s while impersonating: expected %d, got %d", tc.method, tc.path, tc.want, status)
+		}
+	}
+
+	if _, _, err := s.sessionUsecase.Refresh(ctx, tokens.RefreshToken, "", "", ""); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected the impersonation session not to refresh, got %v", err)
+	}
+
+	if status := s.statusWith(t, "DELETE", "/api/v1/auth/impersonation", "Bearer "+adminToken); status != http.StatusForbidden {
+		t.Errorf("expected only an impersonation session to be ended, got %d", status)
+	}
+	if status := s.statusWith(t, "DELETE", "/api/v1/auth/impersonation", "Bearer "+tokens.AccessToken); status != http.StatusOK {
+		t.Errorf("expected impersonation to end, got %d", status)
+	}
+	if status := s.status(t, "/api/v1/me", tokens.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("expected the impersonation token to be revoked, got %d", status)
+	}
+
+	if started := s.auditEvents.OfType(entity.AuditEventImpersonationStarted); len(started) != 1 || started[0].ActorID == nil || *started[0].ActorID != "user-1" || started[0].UserID != s.otherUser.ID {
+		t.Errorf("expected the start to be recorded against the admin, got %+v", started)
+	}
+	if ended := s.auditEvents.OfType(entity.AuditEventImpersonationEnded); len(ended) != 1 || ended[0].ActorID == nil || *ended[0].ActorID != "user-1" {
+		t.Errorf("expected the end to be recorded against the admin, got %+v", ended)
+	}
+	var blocked int
+	requests := s.auditEvents.OfType(entity.AuditEventImpersonatedRequest)
+	for _, event := range requests {
+		if event.ActorID == nil || *event.ActorID != "user-1" || event.UserID != s.otherUser.ID {
+			t.Errorf("expected the request to name the admin and the user, got %+v", event)
+		}
+		if event.Details["blocked"] == "true" {
+			blocked++
+		}
+	}
+	if len(requests) != 11 || blocked != 8 {
+		t.Errorf("expected 11 requests with 8 blocked to be recorded, got %d with %d blocked", len(requests), blocked)
+	}
+}
+
+func TestImpersonationRestoresTheAdminCookieSession(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	s.serveImpersonation()
+	jar, _ := cookiejar.New(nil)
+	serverURL, _ := url.Parse(s.server.URL)
+	jar.SetCookies(serverURL, []*http.Cookie{s.sessionCookie(t, s.adminToken(t))})
+	browser := &http.Client{Jar: jar}
+
+	send := func(method, path string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, s.server.URL+path, nil)
+		resp, err := browser.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	impersonate := func() {
+		t.Helper()
+		if status, _ := send("POST", "/api/v1/admin/users/"+s.otherUser.ID+"/impersonate"); status != http.StatusOK {
+			t.Fatalf("expected impersonation to start, got %d", status)
+		}
+		if _, me := send("GET", "/api/v1/me"); me != s.otherUser.ID {
+			t.Fatalf("expected the browser to act as the user, got %q", me)
+		}
+	}
+
+	impersonate()
+	if status, _ := send("DELETE", "/api/v1/auth/impersonation"); status != http.StatusOK {
+		t.Errorf("expected impersonation to end, got %d", status)
+	}
+	if _, me := send("GET", "/api/v1/me"); me != "user-1" {
+		t.Errorf("expected the admin's own session back after ending, got %q", me)
+	}
+
+	// An impersonation that expires or is revoked elsewhere also falls back.
+	impersonate()
+	started := s.auditEvents.OfType(entity.AuditEventImpersonationStarted)
+	if err := s.sessionUsecase.Revoke(ctx, started[len(started)-1].Details["session_id"]); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, me := send("GET", "/api/v1/me"); me != "user-1" {
+		t.Errorf("expected the admin's own session back after a revocation, got %q", me)
+	}
+}
@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/KimNattanan/go-user-service/internal/dto"
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+)
+
+// wellKnownMaxAge lets verifiers cache the documents briefly. Verifiers are
+// expected to refetch the key set when they meet an unknown kid.
+const wellKnownMaxAge = "public, max-age=300"
+
+var clientAuthMethods = []string{"client_secret_basic", "client_secret_post"}
+
+// HttpWellKnownHandler serves the documents clients and other services use to
+// discover the authorization server and verify our tokens. They live at the
+// root rather than under /api/v1, so they are not part of the swagger docs.
+type HttpWellKnownHandler struct {
+	jwtMaker *token.JWTMaker
+}
+
+func NewHttpWellKnownHandler(jwtMaker *token.JWTMaker) *HttpWellKnownHandler {
+	return &HttpWellKnownHandler{jwtMaker: jwtMaker}
+}
+
+// JWKS serves the public keys of the signing keyring, including retired
+// keys whose tokens have not expired yet.
+func (h *HttpWellKnownHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	set, err := h.jwtMaker.JWKS()
+	if err != nil {
+		http.Error(w, err.Error(), apperror.StatusCode(err))
+		return
+	}
+	w.Header().Set("Cache-Control", wellKnownMaxAge)
+	json.NewEncoder(w).Encode(set)
+}
+
+func (h *HttpWellKnownHandler) OpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	issuer := strings.TrimSuffix(h.jwtMaker.Issuer(), "/")
+	w.Header().Set("Cache-Control", wellKnownMaxAge)
+	json.NewEncoder(w).Encode(dto.OpenIDConfiguration{
+		Issuer:                           h.jwtMaker.Issuer(),
+		AuthorizationEndpoint:            issuer + "/api/v1/oauth/authorize",
+		TokenEndpoint:                    issuer + "/api/v1/oauth/token",
+		TokenEndpointAuthMethods:         []string{"client_secret_basic", "client_secret_post", "none"},
+		UserInfoEndpoint:                 issuer + "/api/v1/oauth/userinfo",
+		JWKSURI:                          issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:            issuer + "/api/v1/oauth/introspect",
+		IntrospectionAuthMethods:         clientAuthMethods,
+		RevocationEndpoint:               issuer + "/api/v1/oauth/revoke",
+		RevocationAuthMethods:            clientAuthMethods,
+		ScopesSupported:                  entity.SupportedScopes,
+		ResponseTypesSupported:           []string{"code"},
+		GrantTypesSupported:              []string{"authorization_code", "refresh_token", "client_credentials"},
+		CodeChallengeMethodsSupported:    []string{"S256"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: h.jwtMaker.Algorithms(),
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "iat", "exp", "jti", "sid", "scope", "client_id", "nonce", "auth_time",
+			"email", "email_verified", "name", "given_name", "family_name", "picture",
+		},
+	})
+}
@@ -2,124 +2,344 @@ package middleware
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"net/http"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/principal"
 	"github.com/KimNattanan/go-user-service/internal/usecase"
 	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/identity"
 	"github.com/KimNattanan/go-user-service/pkg/token"
 	"github.com/gorilla/sessions"
-	"golang.org/x/oauth2"
 )
 
+// impersonationRoutes are the only requests an admin may make while
+// impersonating: reading the user's profile and preferences, and ending the
+// impersonation. Everything else, including reads of account settings such
+// as sessions, API keys or identity linking, is refused.
+var impersonationRoutes = map[string][]string{
+	"/api/v1/me":                 {http.MethodGet, http.MethodHead},
+	"/api/v1/me/preferences":     {http.MethodGet, http.MethodHead},
+	"/api/v1/auth/impersonation": {http.MethodDelete},
+}
+
 type AuthMiddleware struct {
-	userUsecase       usecase.UserUsecase
-	sessionUsecase    usecase.SessionUsecase
-	sessionStore      sessions.Store
-	jwtMaker          *token.JWTMaker
-	googleOauthConfig *oauth2.Config
-	jwtExpiration     time.Duration
+	userUsecase             usecase.UserUsecase
+	sessionUsecase          usecase.SessionUsecase
+	serviceAccountUsecase   usecase.ServiceAccountUsecase
+	apiKeyUsecase           usecase.APIKeyUsecase
+	userAdminUsecase        usecase.UserAdminUsecase
+	sessionStore            sessions.Store
+	jwtMaker                *token.JWTMaker
+	providers               identity.Registry
+	emailVerificationPolicy string
 }
 
-func NewAuthMiddleware(userUsecase usecase.UserUsecase, sessionUsecase usecase.SessionUsecase, sessionStore sessions.Store, jwtMaker *token.JWTMaker, googleOauthConfig *oauth2.Config, jwtExpiration int) *AuthMiddleware {
+func NewAuthMiddleware(userUsecase usecase.UserUsecase, sessionUsecase usecase.SessionUsecase, serviceAccountUsecase usecase.ServiceAccountUsecase, apiKeyUsecase usecase.APIKeyUsecase, userAdminUsecase usecase.UserAdminUsecase, sessionStore sessions.Store, jwtMaker *token.JWTMaker, providers identity.Registry, emailVerificationPolicy string) *AuthMiddleware {
 	return &AuthMiddleware{
-		userUsecase:       userUsecase,
-		sessionUsecase:    sessionUsecase,
-		sessionStore:      sessionStore,
-		jwtMaker:          jwtMaker,
-		googleOauthConfig: googleOauthConfig,
-		jwtExpiration:     time.Duration(jwtExpiration),
+		userUsecase:             userUsecase,
+		sessionUsecase:          sessionUsecase,
+		serviceAccountUsecase:   serviceAccountUsecase,
+		apiKeyUsecase:           apiKeyUsecase,
+		userAdminUsecase:        userAdminUsecase,
+		sessionStore:            sessionStore,
+		jwtMaker:                jwtMaker,
+		providers:               providers,
+		emailVerificationPolicy: emailVerificationPolicy,
 	}
 }
 
+// Handle authenticates the request with an Authorization: Bearer access
+// token or, for browsers, the session cookie, and stores the principal in
+// the request context. Only the cookie carries a refresh token, which is
+// rotated once the access token has expired; bearer clients refresh through
+// /auth/refresh themselves. Service accounts send the bearer tokens of the
+// client credentials grant, and scripts send Authorization: ApiKey with a
+// personal API key. Requests made while impersonating are recorded, and only
+// impersonationRoutes are let through.
 func (m *AuthMiddleware) Handle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookieSession, err := m.sessionStore.Get(r, "session")
+		p, err := m.authenticate(w, r)
 		if err != nil {
-			http.Error(w, apperror.ErrUnauthorized.Error(), http.StatusUnauthorized)
-			return
-		}
-		accessToken, _ := cookieSession.Values["access_token"].(string)
-		accessClaims, err := m.jwtMaker.VerfiyToken(accessToken)
-		if err == nil {
-			ctx := context.WithValue(r.Context(), "userID", accessClaims.ID)
-			next.ServeHTTP(w, r.WithContext(ctx))
-			return
-		}
-		refreshToken, _ := cookieSession.Values["refresh_token"].(string)
-		refreshClaims, err := m.jwtMaker.VerfiyToken(refreshToken)
-		if err != nil {
-			http.Error(w, apperror.ErrUnauthorized.Error(), http.StatusUnauthorized)
+			http.Error(w, err.Error(), apperror.StatusCode(err))
 			return
 		}
-		user, err := m.userUsecase.FindByID(r.Context(), refreshClaims.ID)
-		if err != nil || user == nil {
-			http.Error(w, apperror.ErrUnauthorized.Error(), http.StatusUnauthorized)
+		m.serve(w, r, next, p)
+	})
+}
+
+// Optional is Handle for endpoints that also serve anonymous requests, which
+// reach next without a principal. Only users with a session of their own are
+// let through as themselves.
+func (m *AuthMiddleware) Optional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := m.authenticate(w, r)
+		if err != nil || !p.HasSession() || p.IsImpersonated() {
+			next.ServeHTTP(w, r)
 			return
 		}
-		session, err := m.sessionUsecase.FindByID(r.Context(), refreshClaims.RegisteredClaims.ID)
-		if err != nil || session == nil || session.IsRevoked {
-			http.Error(w, apperror.ErrUnauthorized.Error(), http.StatusUnauthorized)
+		m.serve(w, r, next, p)
+	})
+}
+
+// RequireUser rejects service accounts, API keys and impersonating admins on
+// endpoints that act on the signed-in user's account. It has to run after
+// AuthMiddleware.
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := principal.FromContext(r.Context())
+		if !ok || !p.HasSession() {
+			http.Error(w, apperror.ErrForbidden.Error(), http.StatusForbidden)
 			return
 		}
-		if err := m.sessionUsecase.Revoke(r.Context(), session.ID); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if p.IsImpersonated() {
+			http.Error(w, apperror.ErrImpersonationReadOnly.Error(), http.StatusForbidden)
 			return
 		}
-		go func() { // update user's info
-			client := m.googleOauthConfig.Client(r.Context(), &oauth2.Token{
-				RefreshToken: session.GoogleRefreshToken,
-			})
-			clientRes, _ := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
-			if err != nil {
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission admits principals holding permission: users through
+// their roles and service accounts through their scopes. It has to run after
+// AuthMiddleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := principal.FromContext(r.Context())
+			if !ok {
+				http.Error(w, apperror.ErrUnauthorized.Error(), http.StatusUnauthorized)
 				return
 			}
-			defer clientRes.Body.Close()
-			var userInfo map[string]interface{}
-			if err := json.NewDecoder(clientRes.Body).Decode(&userInfo); err != nil {
+			if !p.HasPermission(permission) {
+				http.Error(w, apperror.ErrForbidden.Error(), http.StatusForbidden)
 				return
 			}
-			firstName, _ := userInfo["given_name"].(string)
-			lastName, _ := userInfo["family_name"].(string)
-			pictureURL, _ := userInfo["picture"].(string)
-			m.userUsecase.Update(r.Context(), user.ID, map[string]interface{}{
-				"first_name":  firstName,
-				"last_name":   lastName,
-				"picture_url": pictureURL,
-			})
-		}()
-
-		refreshToken, refreshClaims, err = m.jwtMaker.CreateToken(user.ID, time.Second*m.jwtExpiration)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope admits signed-in users and principals granted scope, such as
+// API keys. It has to run after AuthMiddleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p, ok := principal.FromContext(r.Context()); !ok || !p.Allows(scope) {
+				http.Error(w, apperror.ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (m *AuthMiddleware) authenticate(w http.ResponseWriter, r *http.Request) (*principal.Principal, error) {
+	if key, ok := authorization(r, "ApiKey"); ok {
+		return m.checkAPIKey(r, key)
+	}
+	if accessToken, ok := authorization(r, "Bearer"); ok {
+		accessClaims, err := m.jwtMaker.VerfiyToken(accessToken)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, apperror.ErrUnauthorized
 		}
-		accessToken, accessClaims, err = m.jwtMaker.CreateToken(user.ID, time.Hour)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if accessClaims.PrincipalType == token.PrincipalTypeServiceAccount {
+			return m.checkServiceAccount(r, accessClaims)
 		}
-		newSession := &entity.Session{
-			ID:                 refreshClaims.RegisteredClaims.ID,
-			UserID:             user.ID,
-			GoogleRefreshToken: session.GoogleRefreshToken,
-			IsRevoked:          false,
-			CreatedAt:          session.CreatedAt,
-			ExpiresAt:          refreshClaims.RegisteredClaims.ExpiresAt.Time,
+		return m.checkSession(r, accessClaims)
+	}
+
+	cookieSession, err := m.sessionStore.Get(r, "session")
+	if err != nil {
+		return nil, apperror.ErrUnauthorized
+	}
+	if p, ok := m.checkImpersonationCookie(w, r, cookieSession); ok {
+		return p, nil
+	}
+	accessToken, _ := cookieSession.Values["access_token"].(string)
+	accessClaims, err := m.jwtMaker.VerfiyToken(accessToken)
+	if err == nil {
+		return m.checkSession(r, accessClaims)
+	}
+	refreshToken, _ := cookieSession.Values["refresh_token"].(string)
+	session, tokens, err := m.sessionUsecase.Refresh(r.Context(), refreshToken, "", r.UserAgent(), ClientIP(r))
+	if err != nil {
+		if errors.Is(err, apperror.ErrSessionReused) {
+			// Drop the stolen tokens so the browser has to sign in again.
+			cookieSession.Values["refresh_token"] = ""
+			cookieSession.Values["access_token"] = ""
+			cookieSession.Save(r, w)
+		}
+		return nil, err
+	}
+	go m.refreshProfile(context.WithoutCancel(r.Context()), session.UserID, session)
+
+	cookieSession.Values["refresh_token"] = tokens.RefreshToken
+	cookieSession.Values["access_token"] = tokens.AccessToken
+	if err := cookieSession.Save(r, w); err != nil {
+		return nil, err
+	}
+	accessClaims, err = m.jwtMaker.VerfiyToken(tokens.AccessToken)
+	if err != nil {
+		return nil, apperror.ErrUnauthorized
+	}
+	return userPrincipal(accessClaims), nil
+}
+
+// checkSession accepts an access token whose session is still active. Access
+// tokens outlive a revocation, so their session is checked too. Tokens
+// issued to OAuth clients are only good for the OAuth endpoints.
+func (m *AuthMiddleware) checkSession(r *http.Request, accessClaims *token.UserClaims) (*principal.Principal, error) {
+	if accessClaims.SessionID == "" || accessClaims.ClientID != "" || accessClaims.PrincipalType != "" {
+		return nil, apperror.ErrUnauthorized
+	}
+	session, err := m.sessionUsecase.FindByID(r.Context(), accessClaims.SessionID)
+	if err != nil || session.IsRevoked || session.UserID != accessClaims.ID {
+		return nil, apperror.ErrUnauthorized
+	}
+	go m.sessionUsecase.Touch(context.WithoutCancel(r.Context()), session)
+	return userPrincipal(accessClaims), nil
+}
+
+func userPrincipal(accessClaims *token.UserClaims) *principal.Principal {
+	p := &principal.Principal{
+		Type:        principal.TypeUser,
+		ID:          accessClaims.ID,
+		SessionID:   accessClaims.SessionID,
+		Permissions: accessClaims.Permissions,
+	}
+	if accessClaims.Actor != nil {
+		p.ImpersonatorID = accessClaims.Actor.Subject
+	}
+	return p
+}
+
+// checkImpersonationCookie accepts the impersonation token a browser holds
+// next to the admin's own tokens. Once it has expired or been revoked it is
+// dropped, which puts the admin's own session back in use.
+func (m *AuthMiddleware) checkImpersonationCookie(w http.ResponseWriter, r *http.Request, cookieSession *sessions.Session) (*principal.Principal, bool) {
+	accessToken, _ := cookieSession.Values["impersonation_access_token"].(string)
+	if accessToken == "" {
+		return nil, false
+	}
+	if accessClaims, err := m.jwtMaker.VerfiyToken(accessToken); err == nil && accessClaims.Actor != nil {
+		if p, err := m.checkSession(r, accessClaims); err == nil {
+			return p, true
 		}
-		if err := m.sessionUsecase.Create(r.Context(), newSession); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	delete(cookieSession.Values, "impersonation_access_token")
+	cookieSession.Save(r, w)
+	return nil, false
+}
+
+// checkServiceAccount accepts a service account token whose account still
+// exists. The token's scopes are the permissions the account may use.
+func (m *AuthMiddleware) checkServiceAccount(r *http.Request, accessClaims *token.UserClaims) (*principal.Principal, error) {
+	account, err := m.serviceAccountUsecase.Verify(r.Context(), accessClaims)
+	if err != nil {
+		return nil, apperror.ErrUnauthorized
+	}
+	scopes := strings.Fields(accessClaims.Scope)
+	return &principal.Principal{Type: principal.TypeServiceAccount, ID: account.ID, Scopes: scopes, Permissions: scopes}, nil
+}
+
+// checkAPIKey accepts an unexpired personal API key of an enabled user. The
+// key acts as its user, limited to its scopes.
+func (m *AuthMiddleware) checkAPIKey(r *http.Request, key string) (*principal.Principal, error) {
+	apiKey, err := m.apiKeyUsecase.Authenticate(r.Context(), key)
+	if err != nil {
+		return nil, apperror.ErrUnauthorized
+	}
+	// Sessions of a disabled user are revoked, but keys are kept so they
+	// work again once the user is enabled.
+	if user, err := m.userUsecase.FindByID(r.Context(), apiKey.UserID); err != nil || user.Disabled {
+		return nil, apperror.ErrUnauthorized
+	}
+	go m.apiKeyUsecase.Touch(context.WithoutCancel(r.Context()), apiKey)
+	return &principal.Principal{Type: principal.TypeUser, ID: apiKey.UserID, APIKeyID: apiKey.ID, Scopes: apiKey.Scopes}, nil
+}
+
+// authorization returns the credentials of the Authorization header if it
+// uses scheme.
+func authorization(r *http.Request, scheme string) (string, bool) {
+	s, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(s, scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(credentials), true
+}
+
+// refreshProfile pulls the user's latest profile from the identity provider
+// the session was started with.
+func (m *AuthMiddleware) refreshProfile(ctx context.Context, userID string, session *entity.Session) {
+	provider, err := m.providers.Get(session.Provider)
+	if err != nil || session.ProviderRefreshToken == "" {
+		return
+	}
+	claims, err := provider.Refresh(ctx, session.ProviderRefreshToken)
+	if err != nil {
+		return
+	}
+	m.userUsecase.Update(ctx, userID, map[string]interface{}{
+		"first_name":  claims.GivenName,
+		"last_name":   claims.FamilyName,
+		"picture_url": claims.Picture,
+	})
+}
+
+func (m *AuthMiddleware) serve(w http.ResponseWriter, r *http.Request, next http.Handler, p *principal.Principal) {
+	if p.IsImpersonated() {
+		if err := m.checkImpersonation(r, p); err != nil {
+			http.Error(w, err.Error(), apperror.StatusCode(err))
 			return
 		}
-		cookieSession.Values["refresh_token"] = refreshToken
-		cookieSession.Values["access_token"] = accessToken
-		if err := cookieSession.Save(r, w); err != nil {
+	}
+	if p.IsUser() {
+		if err := m.checkEmailVerification(r, p.ID); err != nil {
 			http.Error(w, err.Error(), apperror.StatusCode(err))
 			return
 		}
-		ctx := context.WithValue(r.Context(), "userID", user.ID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	}
+	next.ServeHTTP(w, r.WithContext(principal.NewContext(r.Context(), p)))
+}
+
+// checkImpersonation records a request made while impersonating and refuses
+// it unless it is one of impersonationRoutes.
+func (m *AuthMiddleware) checkImpersonation(r *http.Request, p *principal.Principal) error {
+	blocked := !slices.Contains(impersonationRoutes[r.URL.Path], r.Method)
+	actor := &entity.Actor{ID: p.ImpersonatorID, Type: string(principal.TypeUser), IPAddress: ClientIP(r), UserAgent: r.UserAgent()}
+	m.userAdminUsecase.RecordImpersonatedRequest(r.Context(), actor, p.ID, p.SessionID, r.Method, r.URL.Path, blocked)
+	if blocked {
+		return apperror.ErrImpersonationReadOnly
+	}
+	return nil
+}
+
+// checkEmailVerification applies the email verification policy. Logging out is
+// always allowed, and in limit mode unverified users keep read-only access.
+func (m *AuthMiddleware) checkEmailVerification(r *http.Request, userID string) error {
+	switch m.emailVerificationPolicy {
+	case config.EmailVerificationBlock:
+	case config.EmailVerificationLimit:
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			return nil
+		}
+	default:
+		return nil
+	}
+	if strings.HasSuffix(r.URL.Path, "/auth/logout") {
+		return nil
+	}
+	user, err := m.userUsecase.FindByID(r.Context(), userID)
+	if err != nil || user == nil {
+		return apperror.ErrUnauthorized
+	}
+	if !user.EmailVerified {
+		return apperror.ErrEmailNotVerified
+	}
+	return nil
 }
@@ -0,0 +1,61 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/middleware"
+	"github.com/KimNattanan/go-user-service/internal/principal"
+)
+
+// serve runs guard in front of a handler answering 200 for a request made
+// as p, or anonymously when p is nil.
+func serve(guard func(http.Handler) http.Handler, p *principal.Principal) int {
+	r := httptest.NewRequest("GET", "/", nil)
+	if p != nil {
+		r = r.WithContext(principal.NewContext(context.Background(), p))
+	}
+	w := httptest.NewRecorder()
+	guard(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRequirePermission(t *testing.T) {
+	requireUsersRead := middleware.RequirePermission(entity.PermissionUsersRead)
+	for _, tc := range []struct {
+		name string
+		p    *principal.Principal
+		want int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"user without roles", &principal.Principal{Type: principal.TypeUser, ID: "user-1", SessionID: "session-1"}, http.StatusForbidden},
+		{"user with the permission", &principal.Principal{Type: principal.TypeUser, ID: "user-1", SessionID: "session-1", Permissions: []string{entity.PermissionUsersRead}}, http.StatusOK},
+		{"service account with another scope", &principal.Principal{Type: principal.TypeServiceAccount, ID: "account-1", Scopes: []string{entity.PermissionClientsManage}, Permissions: []string{entity.PermissionClientsManage}}, http.StatusForbidden},
+		{"service account with the scope", &principal.Principal{Type: principal.TypeServiceAccount, ID: "account-1", Scopes: []string{entity.PermissionUsersRead}, Permissions: []string{entity.PermissionUsersRead}}, http.StatusOK},
+	} {
+		if status := serve(requireUsersRead, tc.p); status != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, status)
+		}
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		p    *principal.Principal
+		want int
+	}{
+		{"anonymous", nil, http.StatusForbidden},
+		{"user", &principal.Principal{Type: principal.TypeUser, ID: "user-1", SessionID: "session-1"}, http.StatusOK},
+		{"API key", &principal.Principal{Type: principal.TypeUser, ID: "user-1", APIKeyID: "key-1", Scopes: []string{entity.ScopeProfileRead}}, http.StatusForbidden},
+		{"service account", &principal.Principal{Type: principal.TypeServiceAccount, ID: "account-1"}, http.StatusForbidden},
+		{"impersonating admin", &principal.Principal{Type: principal.TypeUser, ID: "user-1", SessionID: "session-1", ImpersonatorID: "admin-1"}, http.StatusForbidden},
+	} {
+		if status := serve(middleware.RequireUser, tc.p); status != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, status)
+		}
+	}
+}
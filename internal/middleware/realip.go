@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP replaces the request's remote address with the client address
+// reported by a reverse proxy. It must only be enabled when such a proxy
+// always sets the headers, since clients can send them too. The last
+// X-Forwarded-For entry is used because it is the one our proxy appended.
+func RealIP(trustProxyHeaders bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !trustProxyHeaders {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+				r.RemoteAddr = ip
+			} else if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+				hops := strings.Split(forwarded, ",")
+				r.RemoteAddr = strings.TrimSpace(hops[len(hops)-1])
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the address the request came from, without the port. Behind
+// a trusted proxy this is the address RealIP took from the proxy headers.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
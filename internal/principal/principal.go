@@ -0,0 +1,86 @@
+// Package principal describes who a request is authenticated as. The auth
+// middleware stores the principal in the request context, and handlers read
+// it from there.
+package principal
+
+import (
+	"context"
+	"slices"
+)
+
+type Type string
+
+const (
+	// TypeUser is a person signed in with a first-party session.
+	TypeUser Type = "user"
+	// TypeServiceAccount is a backend job using the client credentials grant.
+	TypeServiceAccount Type = "service_account"
+)
+
+type Principal struct {
+	Type           Type
+	ID             string   // user or service account ID
+	SessionID      string   // set for users signed in with a session
+	APIKeyID       string   // set for users authenticated with a personal API key
+	ImpersonatorID string   // set when an admin is acting as the user
+	Scopes         []string // granted to service accounts and API keys
+	Permissions    []string // from a user's roles, or a service account's scopes
+}
+
+func (p *Principal) IsUser() bool {
+	return p.Type == TypeUser
+}
+
+// HasSession reports whether the principal is a user signed in with a
+// session, rather than a service account or an API key.
+func (p *Principal) HasSession() bool {
+	return p.IsUser() && p.SessionID != ""
+}
+
+// IsImpersonated reports whether an admin is using the user's session
+// through impersonation, rather than the user themselves.
+func (p *Principal) IsImpersonated() bool {
+	return p.IsUser() && p.ImpersonatorID != ""
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+func (p *Principal) HasPermission(permission string) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+// Allows reports whether the principal may use an endpoint guarded by scope.
+// Signed-in users have their full access; everyone else needs the scope.
+func (p *Principal) Allows(scope string) bool {
+	return p.HasSession() || p.HasScope(scope)
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// UserID returns the ID of the signed-in user, or "" when the request is
+// anonymous or made by a service account.
+func UserID(ctx context.Context) string {
+	if p, ok := FromContext(ctx); ok && p.IsUser() {
+		return p.ID
+	}
+	return ""
+}
+
+// SessionID returns the session of the signed-in user, or "".
+func SessionID(ctx context.Context) string {
+	if p, ok := FromContext(ctx); ok && p.IsUser() {
+		return p.SessionID
+	}
+	return ""
+}
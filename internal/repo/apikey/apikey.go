@@ -0,0 +1,58 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepo struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepo(db *gorm.DB) *APIKeyRepo {
+	return &APIKeyRepo{db: db}
+}
+
+func (r *APIKeyRepo) Create(ctx context.Context, key *entity.APIKey) error {
+	db := r.db.WithContext(ctx)
+	return db.Create(key).Error
+}
+
+func (r *APIKeyRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.APIKey, error) {
+	db := r.db.WithContext(ctx)
+	var keys []*entity.APIKey
+	if err := db.Order("created_at").Find(&keys, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepo) FindByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error) {
+	db := r.db.WithContext(ctx)
+	var key entity.APIKey
+	if err := db.First(&key, "prefix = ?", prefix).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Touch records when the key was last used.
+func (r *APIKeyRepo) Touch(ctx context.Context, id string, lastUsedAt time.Time) error {
+	db := r.db.WithContext(ctx)
+	return db.Model(&entity.APIKey{}).Where("id = ?", id).Update("last_used_at", lastUsedAt).Error
+}
+
+func (r *APIKeyRepo) Delete(ctx context.Context, userID, id string) error {
+	db := r.db.WithContext(ctx)
+	result := db.Delete(&entity.APIKey{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
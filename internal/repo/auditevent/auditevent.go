@@ -0,0 +1,21 @@
+package auditevent
+
+import (
+	"context"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+)
+
+type AuditEventRepo struct {
+	db *gorm.DB
+}
+
+func NewAuditEventRepo(db *gorm.DB) *AuditEventRepo {
+	return &AuditEventRepo{db: db}
+}
+
+func (r *AuditEventRepo) Create(ctx context.Context, event *entity.AuditEvent) error {
+	db := r.db.WithContext(ctx)
+	return db.Create(event).Error
+}
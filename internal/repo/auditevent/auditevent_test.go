@@ -0,0 +1,75 @@
+package auditevent_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo/auditevent"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder keeps the last statement GORM would have sent.
+type sqlRecorder struct {
+	logger.Interface
+	sql string
+}
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	r.sql, _ = fc()
+}
+
+var insertPattern = regexp.MustCompile(`\((.*)\) VALUES \((.*)\)`)
+
+// insertedValues runs Create without a database and returns the inserted
+// values by column, as Postgres would receive them.
+func insertedValues(t *testing.T, event *entity.AuditEvent) map[string]string {
+	t.Helper()
+	recorder := &sqlRecorder{Interface: logger.Discard}
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 recorder,
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := auditevent.NewAuditEventRepo(db).Create(context.Background(), event); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	match := insertPattern.FindStringSubmatch(recorder.sql)
+	if match == nil {
+		t.Fatalf("expected an INSERT, got %q", recorder.sql)
+	}
+	columns, values := strings.Split(match[1], ","), strings.Split(match[2], ",")
+	if len(columns) != len(values) {
+		t.Fatalf("cannot match the columns to the values of %q", recorder.sql)
+	}
+	inserted := make(map[string]string, len(columns))
+	for i, column := range columns {
+		inserted[strings.Trim(column, `"`)] = values[i]
+	}
+	return inserted
+}
+
+func TestCreateWithoutActor(t *testing.T) {
+	// Events of the user's own doing, such as refresh token reuse, have no
+	// actor. Postgres rejects '' as a uuid, so it has to be NULL.
+	inserted := insertedValues(t, &entity.AuditEvent{UserID: uuid.NewString(), Type: entity.AuditEventRefreshTokenReuse})
+	if inserted["actor_id"] != "NULL" {
+		t.Errorf("expected actor_id NULL, got %s", inserted["actor_id"])
+	}
+
+	actorID := uuid.NewString()
+	inserted = insertedValues(t, &entity.AuditEvent{UserID: uuid.NewString(), ActorID: &actorID, ActorType: "user", Type: entity.AuditEventAdminUserViewed})
+	if inserted["actor_id"] != "'"+actorID+"'" {
+		t.Errorf("expected actor_id %s, got %s", actorID, inserted["actor_id"])
+	}
+}
@@ -0,0 +1,56 @@
+package identity
+
+import (
+	"context"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+)
+
+type IdentityRepo struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepo(db *gorm.DB) *IdentityRepo {
+	return &IdentityRepo{db: db}
+}
+
+func (r *IdentityRepo) Create(ctx context.Context, identity *entity.Identity) error {
+	db := r.db.WithContext(ctx)
+	return db.Create(identity).Error
+}
+
+func (r *IdentityRepo) FindByProviderSubject(ctx context.Context, provider, subject string) (*entity.Identity, error) {
+	db := r.db.WithContext(ctx)
+	var identity entity.Identity
+	if err := db.First(&identity, "provider = ? AND subject = ?", provider, subject).Error; err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *IdentityRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.Identity, error) {
+	db := r.db.WithContext(ctx)
+	var identities []*entity.Identity
+	if err := db.Order("linked_at").Find(&identities, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (r *IdentityRepo) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	db := r.db.WithContext(ctx)
+	return db.Model(&entity.Identity{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *IdentityRepo) Delete(ctx context.Context, userID, id string) error {
+	db := r.db.WithContext(ctx)
+	result := db.Delete(&entity.Identity{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
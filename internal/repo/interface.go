@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"github.com/KimNattanan/go-user-service/internal/entity"
 )
@@ -10,6 +11,7 @@ type (
 	UserRepo interface {
 		Create(ctx context.Context, user *entity.User) error
 		FindAll(ctx context.Context) ([]*entity.User, error)
+		Search(ctx context.Context, query string, offset, limit int) ([]*entity.User, int64, error)
 		FindByID(ctx context.Context, id string) (*entity.User, error)
 		FindByEmail(ctx context.Context, email string) (*entity.User, error)
 		Update(ctx context.Context, id string, fields map[string]interface{}) (*entity.User, error)
@@ -23,7 +25,83 @@ type (
 		Create(ctx context.Context, session *entity.Session) error
 		FindByID(ctx context.Context, id string) (*entity.Session, error)
 		FindByUserID(ctx context.Context, userID string) ([]*entity.Session, error)
+		Touch(ctx context.Context, id string, lastUsedAt time.Time) error
 		Revoke(ctx context.Context, id string) error
+		Rotate(ctx context.Context, id string, next *entity.Session, tokens *entity.TokenPair, grace time.Duration) (*entity.TokenPair, error)
+		RevokeFamily(ctx context.Context, userID, familyID string) error
+		RevokeByUserID(ctx context.Context, userID string, exceptIDs ...string) error
 		Delete(ctx context.Context, id string) error
 	}
+	OneTimeTokenRepo interface {
+		Create(ctx context.Context, token *entity.OneTimeToken) error
+		Find(ctx context.Context, purpose, hash string) (*entity.OneTimeToken, error)
+		IncrementAttempts(ctx context.Context, token *entity.OneTimeToken) (int, error)
+		Consume(ctx context.Context, purpose, hash string) (*entity.OneTimeToken, error)
+	}
+	LoginThrottleRepo interface {
+		Find(ctx context.Context, subject string) (*entity.LoginThrottle, error)
+		RecordFailure(ctx context.Context, subject string, window time.Duration) (int, error)
+		Block(ctx context.Context, subject string, nextAttemptAt, lockedUntil time.Time) error
+		Delete(ctx context.Context, subject string) error
+	}
+	PasswordHistoryRepo interface {
+		Add(ctx context.Context, entry *entity.PasswordHistory, keep int) error
+		FindRecent(ctx context.Context, userID string, limit int) ([]*entity.PasswordHistory, error)
+	}
+	AuditEventRepo interface {
+		Create(ctx context.Context, event *entity.AuditEvent) error
+	}
+	PasskeyRepo interface {
+		Create(ctx context.Context, credential *entity.PasskeyCredential) error
+		FindByUserID(ctx context.Context, userID string) ([]*entity.PasskeyCredential, error)
+		FindByCredentialID(ctx context.Context, credentialID []byte) (*entity.PasskeyCredential, error)
+		Update(ctx context.Context, userID, id string, fields map[string]interface{}) (*entity.PasskeyCredential, error)
+		Delete(ctx context.Context, userID, id string) error
+	}
+	APIKeyRepo interface {
+		Create(ctx context.Context, key *entity.APIKey) error
+		FindByUserID(ctx context.Context, userID string) ([]*entity.APIKey, error)
+		FindByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error)
+		Touch(ctx context.Context, id string, lastUsedAt time.Time) error
+		Delete(ctx context.Context, userID, id string) error
+	}
+	IdentityRepo interface {
+		Create(ctx context.Context, identity *entity.Identity) error
+		FindByProviderSubject(ctx context.Context, provider, subject string) (*entity.Identity, error)
+		FindByUserID(ctx context.Context, userID string) ([]*entity.Identity, error)
+		Update(ctx context.Context, id string, fields map[string]interface{}) error
+		Delete(ctx context.Context, userID, id string) error
+	}
+	OAuthClientRepo interface {
+		Create(ctx context.Context, client *entity.OAuthClient) error
+		FindAll(ctx context.Context) ([]*entity.OAuthClient, error)
+		FindByID(ctx context.Context, id string) (*entity.OAuthClient, error)
+		Delete(ctx context.Context, id string) error
+	}
+	OAuthConsentRepo interface {
+		Find(ctx context.Context, userID, clientID string) (*entity.OAuthConsent, error)
+		Save(ctx context.Context, consent *entity.OAuthConsent) error
+	}
+	ServiceAccountRepo interface {
+		Create(ctx context.Context, account *entity.ServiceAccount) error
+		FindAll(ctx context.Context) ([]*entity.ServiceAccount, error)
+		FindByID(ctx context.Context, id string) (*entity.ServiceAccount, error)
+		Delete(ctx context.Context, id string) error
+		AddSecret(ctx context.Context, secret *entity.ServiceAccountSecret, expireOthersAt time.Time) error
+	}
+	RoleRepo interface {
+		Save(ctx context.Context, role *entity.Role) error
+		FindAll(ctx context.Context) ([]*entity.Role, error)
+		FindByName(ctx context.Context, name string) (*entity.Role, error)
+		FindByUserID(ctx context.Context, userID string) ([]*entity.Role, error)
+		Delete(ctx context.Context, name string) error
+		Assign(ctx context.Context, userID, roleID string) error
+		Unassign(ctx context.Context, userID, roleID string) error
+		CountUsers(ctx context.Context, roleID string) (int64, error)
+	}
+	RecoveryCodeRepo interface {
+		Replace(ctx context.Context, userID string, codes []*entity.RecoveryCode) error
+		Use(ctx context.Context, userID, codeHash string) error
+		DeleteByUserID(ctx context.Context, userID string) error
+	}
 )
@@ -0,0 +1,84 @@
+package loginthrottle
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/redis/go-redis/v9"
+)
+
+type LoginThrottleRepo struct {
+	rdb *redis.Client
+}
+
+func NewLoginThrottleRepo(rdb *redis.Client) *LoginThrottleRepo {
+	return &LoginThrottleRepo{rdb: rdb}
+}
+
+func throttleKey(subject string) string {
+	return "login_throttle:" + subject
+}
+
+// Find returns the subject's throttle state. Subjects without recent failures
+// get a zero value rather than an error.
+func (r *LoginThrottleRepo) Find(ctx context.Context, subject string) (*entity.LoginThrottle, error) {
+	values, err := r.rdb.HGetAll(ctx, throttleKey(subject)).Result()
+	if err != nil {
+		return nil, err
+	}
+	throttle := &entity.LoginThrottle{}
+	throttle.Failures, _ = strconv.Atoi(values["failures"])
+	throttle.NextAttemptAt = unixMilli(values["next_attempt_at"])
+	throttle.LockedUntil = unixMilli(values["locked_until"])
+	return throttle, nil
+}
+
+// RecordFailure counts a failed attempt and returns the failures so far. The
+// window starts with the first failure and is not extended by later ones.
+func (r *LoginThrottleRepo) RecordFailure(ctx context.Context, subject string, window time.Duration) (int, error) {
+	key := throttleKey(subject)
+	pipe := r.rdb.TxPipeline()
+	incr := pipe.HIncrBy(ctx, key, "failures", 1)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// Block delays the subject's next attempt and, if lockedUntil is set, locks
+// it until then. The state is kept at least as long as the lock.
+func (r *LoginThrottleRepo) Block(ctx context.Context, subject string, nextAttemptAt, lockedUntil time.Time) error {
+	key := throttleKey(subject)
+	fields := map[string]interface{}{}
+	if !nextAttemptAt.IsZero() {
+		fields["next_attempt_at"] = nextAttemptAt.UnixMilli()
+	}
+	if !lockedUntil.IsZero() {
+		fields["locked_until"] = lockedUntil.UnixMilli()
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	pipe := r.rdb.TxPipeline()
+	pipe.HSet(ctx, key, fields)
+	if !lockedUntil.IsZero() {
+		pipe.ExpireGT(ctx, key, time.Until(lockedUntil))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *LoginThrottleRepo) Delete(ctx context.Context, subject string) error {
+	return r.rdb.Del(ctx, throttleKey(subject)).Err()
+}
+
+func unixMilli(value string) time.Time {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
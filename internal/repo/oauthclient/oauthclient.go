@@ -0,0 +1,51 @@
+package oauthclient
+
+import (
+	"context"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+)
+
+type OAuthClientRepo struct {
+	db *gorm.DB
+}
+
+func NewOAuthClientRepo(db *gorm.DB) *OAuthClientRepo {
+	return &OAuthClientRepo{db: db}
+}
+
+func (r *OAuthClientRepo) Create(ctx context.Context, client *entity.OAuthClient) error {
+	db := r.db.WithContext(ctx)
+	return db.Create(client).Error
+}
+
+func (r *OAuthClientRepo) FindAll(ctx context.Context) ([]*entity.OAuthClient, error) {
+	db := r.db.WithContext(ctx)
+	var clients []*entity.OAuthClient
+	if err := db.Order("created_at").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *OAuthClientRepo) FindByID(ctx context.Context, id string) (*entity.OAuthClient, error) {
+	db := r.db.WithContext(ctx)
+	var client entity.OAuthClient
+	if err := db.First(&client, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *OAuthClientRepo) Delete(ctx context.Context, id string) error {
+	db := r.db.WithContext(ctx)
+	result := db.Delete(&entity.OAuthClient{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package oauthconsent
+
+import (
+	"context"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OAuthConsentRepo struct {
+	db *gorm.DB
+}
+
+func NewOAuthConsentRepo(db *gorm.DB) *OAuthConsentRepo {
+	return &OAuthConsentRepo{db: db}
+}
+
+func (r *OAuthConsentRepo) Find(ctx context.Context, userID, clientID string) (*entity.OAuthConsent, error) {
+	db := r.db.WithContext(ctx)
+	var consent entity.OAuthConsent
+	if err := db.First(&consent, "user_id = ? AND client_id = ?", userID, clientID).Error; err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// Save records the consent, replacing the scopes of an earlier one.
+func (r *OAuthConsentRepo) Save(ctx context.Context, consent *entity.OAuthConsent) error {
+	db := r.db.WithContext(ctx)
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scopes", "updated_at"}),
+	}).Create(consent).Error
+}
@@ -0,0 +1,112 @@
+package onetimetoken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/redis/go-redis/v9"
+)
+
+type OneTimeTokenRepo struct {
+	rdb *redis.Client
+}
+
+func NewOneTimeTokenRepo(rdb *redis.Client) *OneTimeTokenRepo {
+	return &OneTimeTokenRepo{rdb: rdb}
+}
+
+func tokenKey(purpose, hash string) string {
+	return purpose + ":" + hash
+}
+
+func userKey(purpose, userID string) string {
+	return purpose + "_user:" + userID
+}
+
+func attemptsKey(purpose, hash string) string {
+	return purpose + "_attempts:" + hash
+}
+
+// Create stores the token and invalidates any token previously issued to the
+// same user for the same purpose. Tokens without a user are independent. A
+// token stored under the hash of an earlier one keeps its failed attempts.
+func (r *OneTimeTokenRepo) Create(ctx context.Context, token *entity.OneTimeToken) error {
+	ttl := time.Until(token.ExpiresAt)
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	var oldHash string
+	if token.UserID != "" {
+		oldHash, err = r.rdb.Get(ctx, userKey(token.Purpose, token.UserID)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+	}
+
+	pipe := r.rdb.TxPipeline()
+	if oldHash != "" {
+		pipe.Del(ctx, tokenKey(token.Purpose, oldHash))
+	}
+	pipe.Set(ctx, tokenKey(token.Purpose, token.Hash), data, ttl)
+	if token.UserID != "" {
+		pipe.Set(ctx, userKey(token.Purpose, token.UserID), token.Hash, ttl)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *OneTimeTokenRepo) Find(ctx context.Context, purpose, hash string) (*entity.OneTimeToken, error) {
+	data, err := r.rdb.Get(ctx, tokenKey(purpose, hash)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, apperror.ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token entity.OneTimeToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// IncrementAttempts counts a failed attempt against the token and returns the
+// number of failures so far. The counter expires together with the token.
+func (r *OneTimeTokenRepo) IncrementAttempts(ctx context.Context, token *entity.OneTimeToken) (int, error) {
+	key := attemptsKey(token.Purpose, token.Hash)
+	pipe := r.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireAt(ctx, key, token.ExpiresAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// Consume atomically fetches and deletes the token so it can only be used once.
+func (r *OneTimeTokenRepo) Consume(ctx context.Context, purpose, hash string) (*entity.OneTimeToken, error) {
+	data, err := r.rdb.GetDel(ctx, tokenKey(purpose, hash)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, apperror.ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token entity.OneTimeToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+	r.rdb.Del(ctx, userKey(purpose, token.UserID), attemptsKey(purpose, hash))
+
+	return &token, nil
+}
@@ -0,0 +1,67 @@
+package passkey
+
+import (
+	"context"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+)
+
+type PasskeyRepo struct {
+	db *gorm.DB
+}
+
+func NewPasskeyRepo(db *gorm.DB) *PasskeyRepo {
+	return &PasskeyRepo{db: db}
+}
+
+func (r *PasskeyRepo) Create(ctx context.Context, credential *entity.PasskeyCredential) error {
+	db := r.db.WithContext(ctx)
+	return db.Create(credential).Error
+}
+
+func (r *PasskeyRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.PasskeyCredential, error) {
+	db := r.db.WithContext(ctx)
+	var credentials []*entity.PasskeyCredential
+	if err := db.Order("created_at").Find(&credentials, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (r *PasskeyRepo) FindByCredentialID(ctx context.Context, credentialID []byte) (*entity.PasskeyCredential, error) {
+	db := r.db.WithContext(ctx)
+	var credential entity.PasskeyCredential
+	if err := db.First(&credential, "credential_id = ?", credentialID).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *PasskeyRepo) Update(ctx context.Context, userID, id string, fields map[string]interface{}) (*entity.PasskeyCredential, error) {
+	db := r.db.WithContext(ctx)
+	result := db.Model(&entity.PasskeyCredential{}).Where("id = ? AND user_id = ?", id, userID).Updates(fields)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var credential entity.PasskeyCredential
+	if err := db.First(&credential, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *PasskeyRepo) Delete(ctx context.Context, userID, id string) error {
+	db := r.db.WithContext(ctx)
+	result := db.Delete(&entity.PasskeyCredential{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
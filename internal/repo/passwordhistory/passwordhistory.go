@@ -0,0 +1,43 @@
+package passwordhistory
+
+import (
+	"context"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+)
+
+type PasswordHistoryRepo struct {
+	db *gorm.DB
+}
+
+func NewPasswordHistoryRepo(db *gorm.DB) *PasswordHistoryRepo {
+	return &PasswordHistoryRepo{db: db}
+}
+
+// Add records a newly set password and drops all but the keep most recent
+// entries of the user.
+func (r *PasswordHistoryRepo) Add(ctx context.Context, entry *entity.PasswordHistory, keep int) error {
+	db := r.db.WithContext(ctx)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		recent := tx.Model(&entity.PasswordHistory{}).
+			Select("id").
+			Where("user_id = ?", entry.UserID).
+			Order("created_at DESC").
+			Limit(keep)
+		return tx.Where("user_id = ? AND id NOT IN (?)", entry.UserID, recent).
+			Delete(&entity.PasswordHistory{}).Error
+	})
+}
+
+func (r *PasswordHistoryRepo) FindRecent(ctx context.Context, userID string, limit int) ([]*entity.PasswordHistory, error) {
+	db := r.db.WithContext(ctx)
+	var entries []*entity.PasswordHistory
+	if err := db.Order("created_at DESC").Limit(limit).Find(&entries, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,49 @@
+package recoverycode
+
+import (
+	"context"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeRepo struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepo(db *gorm.DB) *RecoveryCodeRepo {
+	return &RecoveryCodeRepo{db: db}
+}
+
+// Replace deletes every code of the user and stores the new set.
+func (r *RecoveryCodeRepo) Replace(ctx context.Context, userID string, codes []*entity.RecoveryCode) error {
+	db := r.db.WithContext(ctx)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&entity.RecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Create(codes).Error
+	})
+}
+
+// Use marks an unused code as used. It returns gorm.ErrRecordNotFound if no
+// unused code matches.
+func (r *RecoveryCodeRepo) Use(ctx context.Context, userID, codeHash string) error {
+	db := r.db.WithContext(ctx)
+	result := db.Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *RecoveryCodeRepo) DeleteByUserID(ctx context.Context, userID string) error {
+	db := r.db.WithContext(ctx)
+	return db.Delete(&entity.RecoveryCode{}, "user_id = ?", userID).Error
+}
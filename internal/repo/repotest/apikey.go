@@ -0,0 +1,103 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+// APIKeyRepo keeps keys in the order they were created and counts the
+// writes made by Touch.
+type APIKeyRepo struct {
+	mu      sync.Mutex
+	keys    []*entity.APIKey
+	touches int
+}
+
+func NewAPIKeyRepo() *APIKeyRepo {
+	return &APIKeyRepo{}
+}
+
+func (r *APIKeyRepo) Create(ctx context.Context, key *entity.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key.ID = uuid.NewString()
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	r.keys = append(r.keys, key)
+	return nil
+}
+
+// Key returns the stored key, for a test to inspect or change.
+func (r *APIKeyRepo) Key(id string) *entity.APIKey {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(id)
+}
+
+// find returns the stored key. The caller holds the lock.
+func (r *APIKeyRepo) find(id string) *entity.APIKey {
+	if i := slices.IndexFunc(r.keys, func(key *entity.APIKey) bool { return key.ID == id }); i >= 0 {
+		return r.keys[i]
+	}
+	return nil
+}
+
+func (r *APIKeyRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := []*entity.APIKey{}
+	for _, key := range r.keys {
+		if key.UserID == userID {
+			found := *key
+			keys = append(keys, &found)
+		}
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepo) FindByPrefix(ctx context.Context, prefix string) (*entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			found := *key
+			return &found, nil
+		}
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *APIKeyRepo) Touch(ctx context.Context, id string, lastUsedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.touches++
+	if key := r.find(id); key != nil {
+		key.LastUsedAt = &lastUsedAt
+	}
+	return nil
+}
+
+// Touches returns how often Touch was called.
+func (r *APIKeyRepo) Touches() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.touches
+}
+
+func (r *APIKeyRepo) Delete(ctx context.Context, userID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.keys, func(key *entity.APIKey) bool { return key.ID == id && key.UserID == userID })
+	if i < 0 {
+		return apperror.ErrRecordNotFound
+	}
+	r.keys = slices.Delete(r.keys, i, i+1)
+	return nil
+}
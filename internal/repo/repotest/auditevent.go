@@ -0,0 +1,47 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/google/uuid"
+)
+
+// AuditEventRepo records events in the order they were created.
+type AuditEventRepo struct {
+	mu     sync.Mutex
+	events []*entity.AuditEvent
+}
+
+func NewAuditEventRepo() *AuditEventRepo {
+	return &AuditEventRepo{}
+}
+
+func (r *AuditEventRepo) Create(ctx context.Context, event *entity.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event.ID = uuid.NewString()
+	r.events = append(r.events, event)
+	return nil
+}
+
+// Events returns every recorded event.
+func (r *AuditEventRepo) Events() []*entity.AuditEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*entity.AuditEvent{}, r.events...)
+}
+
+// OfType returns the recorded events of the given type.
+func (r *AuditEventRepo) OfType(eventType string) []*entity.AuditEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []*entity.AuditEvent
+	for _, event := range r.events {
+		if event.Type == eventType {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,92 @@
+package repotest
+
+import (
+	"context"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+// IdentityRepo stores identities on the users of a UserRepo, so identities
+// created together with a user are found too.
+type IdentityRepo struct {
+	users *UserRepo
+}
+
+func NewIdentityRepo(users *UserRepo) *IdentityRepo {
+	return &IdentityRepo{users: users}
+}
+
+// all returns every identity. The caller holds the users' lock.
+func (r *IdentityRepo) all() []*entity.Identity {
+	var identities []*entity.Identity
+	for _, user := range r.users.Users {
+		for i := range user.Identities {
+			identities = append(identities, &user.Identities[i])
+		}
+	}
+	return identities
+}
+
+func (r *IdentityRepo) Create(ctx context.Context, identity *entity.Identity) error {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	user, ok := r.users.Users[identity.UserID]
+	if !ok {
+		return apperror.ErrRecordNotFound
+	}
+	identity.ID = uuid.NewString()
+	user.Identities = append(user.Identities, *identity)
+	return nil
+}
+
+func (r *IdentityRepo) FindByProviderSubject(ctx context.Context, provider, subject string) (*entity.Identity, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	for _, identity := range r.all() {
+		if identity.Provider == provider && identity.Subject == subject {
+			found := *identity
+			return &found, nil
+		}
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *IdentityRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.Identity, error) {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	identities := []*entity.Identity{}
+	for _, identity := range r.all() {
+		if identity.UserID == userID {
+			found := *identity
+			identities = append(identities, &found)
+		}
+	}
+	return identities, nil
+}
+
+func (r *IdentityRepo) Update(ctx context.Context, id string, fields map[string]interface{}) error {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	for _, identity := range r.all() {
+		if identity.ID == id {
+			return update(identity, fields)
+		}
+	}
+	return nil
+}
+
+func (r *IdentityRepo) Delete(ctx context.Context, userID, id string) error {
+	r.users.mu.Lock()
+	defer r.users.mu.Unlock()
+	if user, ok := r.users.Users[userID]; ok {
+		for i, identity := range user.Identities {
+			if identity.ID == id {
+				user.Identities = append(user.Identities[:i], user.Identities[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return apperror.ErrRecordNotFound
+}
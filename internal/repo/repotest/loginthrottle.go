@@ -0,0 +1,66 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+)
+
+// LoginThrottleRepo keeps failure counters by subject. Unlike the Redis
+// repo, counters do not expire at the end of the window.
+type LoginThrottleRepo struct {
+	mu        sync.Mutex
+	throttles map[string]*entity.LoginThrottle
+}
+
+func NewLoginThrottleRepo() *LoginThrottleRepo {
+	return &LoginThrottleRepo{throttles: map[string]*entity.LoginThrottle{}}
+}
+
+func (r *LoginThrottleRepo) Find(ctx context.Context, subject string) (*entity.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if throttle, ok := r.throttles[subject]; ok {
+		found := *throttle
+		return &found, nil
+	}
+	return &entity.LoginThrottle{}, nil
+}
+
+func (r *LoginThrottleRepo) RecordFailure(ctx context.Context, subject string, window time.Duration) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	throttle, ok := r.throttles[subject]
+	if !ok {
+		throttle = &entity.LoginThrottle{}
+		r.throttles[subject] = throttle
+	}
+	throttle.Failures++
+	return throttle.Failures, nil
+}
+
+func (r *LoginThrottleRepo) Block(ctx context.Context, subject string, nextAttemptAt, lockedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	throttle, ok := r.throttles[subject]
+	if !ok {
+		throttle = &entity.LoginThrottle{}
+		r.throttles[subject] = throttle
+	}
+	if !nextAttemptAt.IsZero() {
+		throttle.NextAttemptAt = nextAttemptAt
+	}
+	if !lockedUntil.IsZero() {
+		throttle.LockedUntil = lockedUntil
+	}
+	return nil
+}
+
+func (r *LoginThrottleRepo) Delete(ctx context.Context, subject string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.throttles, subject)
+	return nil
+}
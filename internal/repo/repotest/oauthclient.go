@@ -0,0 +1,59 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+// OAuthClientRepo keeps clients in the order they were registered.
+type OAuthClientRepo struct {
+	mu      sync.Mutex
+	clients []*entity.OAuthClient
+}
+
+func NewOAuthClientRepo() *OAuthClientRepo {
+	return &OAuthClientRepo{}
+}
+
+func (r *OAuthClientRepo) Create(ctx context.Context, client *entity.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	client.ID = uuid.NewString()
+	if client.CreatedAt.IsZero() {
+		client.CreatedAt = time.Now()
+	}
+	r.clients = append(r.clients, client)
+	return nil
+}
+
+func (r *OAuthClientRepo) FindAll(ctx context.Context) ([]*entity.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.clients), nil
+}
+
+func (r *OAuthClientRepo) FindByID(ctx context.Context, id string) (*entity.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := slices.IndexFunc(r.clients, func(client *entity.OAuthClient) bool { return client.ID == id }); i >= 0 {
+		return r.clients[i], nil
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *OAuthClientRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.clients, func(client *entity.OAuthClient) bool { return client.ID == id })
+	if i < 0 {
+		return apperror.ErrRecordNotFound
+	}
+	r.clients = slices.Delete(r.clients, i, i+1)
+	return nil
+}
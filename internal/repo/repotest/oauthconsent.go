@@ -0,0 +1,42 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+// OAuthConsentRepo keeps one consent per user and client.
+type OAuthConsentRepo struct {
+	mu       sync.Mutex
+	consents map[[2]string]*entity.OAuthConsent // user ID, client ID
+}
+
+func NewOAuthConsentRepo() *OAuthConsentRepo {
+	return &OAuthConsentRepo{consents: map[[2]string]*entity.OAuthConsent{}}
+}
+
+func (r *OAuthConsentRepo) Find(ctx context.Context, userID, clientID string) (*entity.OAuthConsent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if consent, ok := r.consents[[2]string{userID, clientID}]; ok {
+		return consent, nil
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *OAuthConsentRepo) Save(ctx context.Context, consent *entity.OAuthConsent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := [2]string{consent.UserID, consent.ClientID}
+	if existing, ok := r.consents[key]; ok {
+		consent.ID = existing.ID
+	} else {
+		consent.ID = uuid.NewString()
+	}
+	r.consents[key] = consent
+	return nil
+}
@@ -0,0 +1,87 @@
+package repotest
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+)
+
+// OneTimeTokenRepo follows the Redis repo: a user has one token per
+// purpose, failed attempts outlive a token replaced under the same hash, and
+// tokens disappear once they expire.
+type OneTimeTokenRepo struct {
+	mu       sync.Mutex
+	tokens   map[string]*entity.OneTimeToken // by purpose and hash
+	users    map[string]string               // purpose and user ID -> hash
+	attempts map[string]int                  // by purpose and hash
+}
+
+func NewOneTimeTokenRepo() *OneTimeTokenRepo {
+	return &OneTimeTokenRepo{
+		tokens:   map[string]*entity.OneTimeToken{},
+		users:    map[string]string{},
+		attempts: map[string]int{},
+	}
+}
+
+func (r *OneTimeTokenRepo) Create(ctx context.Context, token *entity.OneTimeToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if token.UserID != "" {
+		if oldHash, ok := r.users[token.Purpose+":"+token.UserID]; ok {
+			delete(r.tokens, token.Purpose+":"+oldHash)
+		}
+		r.users[token.Purpose+":"+token.UserID] = token.Hash
+	}
+	stored := *token
+	stored.Data = maps.Clone(token.Data)
+	r.tokens[token.Purpose+":"+token.Hash] = &stored
+	return nil
+}
+
+// find returns a copy of the token, as Redis would decode it. The caller
+// holds the lock.
+func (r *OneTimeTokenRepo) find(purpose, hash string) (*entity.OneTimeToken, error) {
+	token, ok := r.tokens[purpose+":"+hash]
+	if ok && !token.ExpiresAt.IsZero() && !time.Now().Before(token.ExpiresAt) {
+		delete(r.tokens, purpose+":"+hash)
+		delete(r.attempts, purpose+":"+hash)
+		ok = false
+	}
+	if !ok {
+		return nil, apperror.ErrRecordNotFound
+	}
+	found := *token
+	found.Data = maps.Clone(token.Data)
+	return &found, nil
+}
+
+func (r *OneTimeTokenRepo) Find(ctx context.Context, purpose, hash string) (*entity.OneTimeToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.find(purpose, hash)
+}
+
+func (r *OneTimeTokenRepo) IncrementAttempts(ctx context.Context, token *entity.OneTimeToken) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[token.Purpose+":"+token.Hash]++
+	return r.attempts[token.Purpose+":"+token.Hash], nil
+}
+
+func (r *OneTimeTokenRepo) Consume(ctx context.Context, purpose, hash string) (*entity.OneTimeToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	token, err := r.find(purpose, hash)
+	if err != nil {
+		return nil, err
+	}
+	delete(r.tokens, purpose+":"+hash)
+	delete(r.users, purpose+":"+token.UserID)
+	delete(r.attempts, purpose+":"+hash)
+	return token, nil
+}
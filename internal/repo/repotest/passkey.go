@@ -0,0 +1,85 @@
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+// PasskeyRepo keeps credentials in the order they were registered.
+// Finders return the stored credential.
+type PasskeyRepo struct {
+	mu          sync.Mutex
+	credentials []*entity.PasskeyCredential
+}
+
+func NewPasskeyRepo() *PasskeyRepo {
+	return &PasskeyRepo{}
+}
+
+func (r *PasskeyRepo) Create(ctx context.Context, credential *entity.PasskeyCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credential.ID = uuid.NewString()
+	if credential.CreatedAt.IsZero() {
+		credential.CreatedAt = time.Now()
+	}
+	r.credentials = append(r.credentials, credential)
+	return nil
+}
+
+func (r *PasskeyRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.PasskeyCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credentials := []*entity.PasskeyCredential{}
+	for _, credential := range r.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *PasskeyRepo) FindByCredentialID(ctx context.Context, credentialID []byte) (*entity.PasskeyCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, credential := range r.credentials {
+		if bytes.Equal(credential.CredentialID, credentialID) {
+			return credential, nil
+		}
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *PasskeyRepo) Update(ctx context.Context, userID, id string, fields map[string]interface{}) (*entity.PasskeyCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, credential := range r.credentials {
+		if credential.ID == id && credential.UserID == userID {
+			if err := update(credential, fields); err != nil {
+				return nil, err
+			}
+			return credential, nil
+		}
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *PasskeyRepo) Delete(ctx context.Context, userID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.credentials, func(credential *entity.PasskeyCredential) bool {
+		return credential.ID == id && credential.UserID == userID
+	})
+	if i < 0 {
+		return apperror.ErrRecordNotFound
+	}
+	r.credentials = slices.Delete(r.credentials, i, i+1)
+	return nil
+}
@@ -0,0 +1,39 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/google/uuid"
+)
+
+// PasswordHistoryRepo keeps each user's entries, newest first.
+type PasswordHistoryRepo struct {
+	mu      sync.Mutex
+	entries map[string][]*entity.PasswordHistory // by user ID
+}
+
+func NewPasswordHistoryRepo() *PasswordHistoryRepo {
+	return &PasswordHistoryRepo{entries: map[string][]*entity.PasswordHistory{}}
+}
+
+func (r *PasswordHistoryRepo) Add(ctx context.Context, entry *entity.PasswordHistory, keep int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.ID = uuid.NewString()
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	entries := append([]*entity.PasswordHistory{entry}, r.entries[entry.UserID]...)
+	r.entries[entry.UserID] = entries[:min(keep, len(entries))]
+	return nil
+}
+
+func (r *PasswordHistoryRepo) FindRecent(ctx context.Context, userID string, limit int) ([]*entity.PasswordHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := r.entries[userID]
+	return append([]*entity.PasswordHistory{}, entries[:min(limit, len(entries))]...), nil
+}
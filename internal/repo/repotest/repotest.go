@@ -0,0 +1,37 @@
+// Package repotest provides in-memory implementations of the repositories in
+// package repo for tests. They are safe for concurrent use and behave like
+// the Postgres and Redis implementations where the usecases depend on it:
+// IDs are assigned on create, missing records are apperror.ErrRecordNotFound
+// and one-time tokens expire and can only be consumed once.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+var schemas sync.Map
+
+// update sets the columns in fields on model, a pointer to an entity, the
+// way GORM's Updates does with a map.
+func update(model interface{}, fields map[string]interface{}) error {
+	s, err := schema.Parse(model, &schemas, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(model).Elem()
+	for column, v := range fields {
+		field := s.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("repotest: %s has no column %q", s.Name, column)
+		}
+		if err := field.Set(context.Background(), value, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+// RoleRepo keeps roles by name. Saving a role under an existing name
+// replaces it and keeps its ID.
+type RoleRepo struct {
+	mu          sync.Mutex
+	roles       map[string]*entity.Role // by name
+	assignments map[[2]string]bool      // user ID, role ID
+}
+
+func NewRoleRepo() *RoleRepo {
+	return &RoleRepo{roles: map[string]*entity.Role{}, assignments: map[[2]string]bool{}}
+}
+
+func (r *RoleRepo) Save(ctx context.Context, role *entity.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.roles[role.Name]; ok {
+		role.ID = existing.ID
+	} else {
+		role.ID = uuid.NewString()
+	}
+	r.roles[role.Name] = role
+	return nil
+}
+
+func (r *RoleRepo) FindAll(ctx context.Context) ([]*entity.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sorted(func(*entity.Role) bool { return true }), nil
+}
+
+func (r *RoleRepo) FindByName(ctx context.Context, name string) (*entity.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if role, ok := r.roles[name]; ok {
+		return role, nil
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *RoleRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.Role, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sorted(func(role *entity.Role) bool { return r.assignments[[2]string{userID, role.ID}] }), nil
+}
+
+// sorted returns the roles matching keep, ordered by name. The caller holds
+// the lock.
+func (r *RoleRepo) sorted(keep func(*entity.Role) bool) []*entity.Role {
+	roles := []*entity.Role{}
+	for _, role := range r.roles {
+		if keep(role) {
+			roles = append(roles, role)
+		}
+	}
+	slices.SortFunc(roles, func(a, b *entity.Role) int { return strings.Compare(a.Name, b.Name) })
+	return roles
+}
+
+func (r *RoleRepo) Delete(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role, ok := r.roles[name]
+	if !ok {
+		return apperror.ErrRecordNotFound
+	}
+	for assignment := range r.assignments {
+		if assignment[1] == role.ID {
+			delete(r.assignments, assignment)
+		}
+	}
+	delete(r.roles, name)
+	return nil
+}
+
+func (r *RoleRepo) Assign(ctx context.Context, userID, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.assignments[[2]string{userID, roleID}] = true
+	return nil
+}
+
+func (r *RoleRepo) Unassign(ctx context.Context, userID, roleID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.assignments[[2]string{userID, roleID}] {
+		return apperror.ErrRecordNotFound
+	}
+	delete(r.assignments, [2]string{userID, roleID})
+	return nil
+}
+
+func (r *RoleRepo) CountUsers(ctx context.Context, roleID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var count int64
+	for assignment := range r.assignments {
+		if assignment[1] == roleID {
+			count++
+		}
+	}
+	return count, nil
+}
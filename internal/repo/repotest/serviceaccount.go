@@ -0,0 +1,93 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+// ServiceAccountRepo keeps accounts, with their secrets, in the order they
+// were created. Finders return the stored account.
+type ServiceAccountRepo struct {
+	mu       sync.Mutex
+	accounts []*entity.ServiceAccount
+}
+
+func NewServiceAccountRepo() *ServiceAccountRepo {
+	return &ServiceAccountRepo{}
+}
+
+func (r *ServiceAccountRepo) Create(ctx context.Context, account *entity.ServiceAccount) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	account.ID = uuid.NewString()
+	if account.CreatedAt.IsZero() {
+		account.CreatedAt = time.Now()
+	}
+	for i := range account.Secrets {
+		account.Secrets[i].ID = uuid.NewString()
+		account.Secrets[i].ServiceAccountID = account.ID
+	}
+	r.accounts = append(r.accounts, account)
+	return nil
+}
+
+func (r *ServiceAccountRepo) FindAll(ctx context.Context) ([]*entity.ServiceAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.accounts), nil
+}
+
+func (r *ServiceAccountRepo) FindByID(ctx context.Context, id string) (*entity.ServiceAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if account := r.find(id); account != nil {
+		return account, nil
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+// find returns the stored account. The caller holds the lock.
+func (r *ServiceAccountRepo) find(id string) *entity.ServiceAccount {
+	if i := slices.IndexFunc(r.accounts, func(account *entity.ServiceAccount) bool { return account.ID == id }); i >= 0 {
+		return r.accounts[i]
+	}
+	return nil
+}
+
+func (r *ServiceAccountRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.accounts, func(account *entity.ServiceAccount) bool { return account.ID == id })
+	if i < 0 {
+		return apperror.ErrRecordNotFound
+	}
+	r.accounts = slices.Delete(r.accounts, i, i+1)
+	return nil
+}
+
+// AddSecret drops the account's expired secrets, has the others expire at
+// expireOthersAt at the latest and adds secret.
+func (r *ServiceAccountRepo) AddSecret(ctx context.Context, secret *entity.ServiceAccountSecret, expireOthersAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	account := r.find(secret.ServiceAccountID)
+	if account == nil {
+		return apperror.ErrRecordNotFound
+	}
+	now := time.Now()
+	account.Secrets = slices.DeleteFunc(account.Secrets, func(s entity.ServiceAccountSecret) bool { return !s.Active(now) })
+	for i := range account.Secrets {
+		if expiresAt := account.Secrets[i].ExpiresAt; expiresAt == nil || expiresAt.After(expireOthersAt) {
+			account.Secrets[i].ExpiresAt = &expireOthersAt
+		}
+	}
+	secret.ID = uuid.NewString()
+	account.Secrets = append(account.Secrets, *secret)
+	return nil
+}
@@ -0,0 +1,159 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+)
+
+// SessionRepo keeps sessions by ID, including revoked ones, like the Redis
+// repo keeps them until they expire. Rotating within the grace period
+// returns the tokens issued the first time.
+type SessionRepo struct {
+	mu         sync.Mutex
+	Sessions   map[string]*entity.Session
+	successors map[string]successor
+	touched    []string
+}
+
+// successor is the token pair issued when a session was rotated, which is
+// handed out again until the grace period ends.
+type successor struct {
+	tokens *entity.TokenPair
+	until  time.Time
+}
+
+// NewSessionRepo returns a repo holding sessions.
+func NewSessionRepo(sessions ...*entity.Session) *SessionRepo {
+	r := &SessionRepo{Sessions: map[string]*entity.Session{}, successors: map[string]successor{}}
+	for _, session := range sessions {
+		r.Sessions[session.ID] = session
+	}
+	return r
+}
+
+func (r *SessionRepo) Create(ctx context.Context, session *entity.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Sessions[session.ID] = session
+	return nil
+}
+
+func (r *SessionRepo) FindByID(ctx context.Context, id string) (*entity.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.Sessions[id]
+	if !ok {
+		return nil, apperror.ErrRecordNotFound
+	}
+	found := *session
+	return &found, nil
+}
+
+// FindByUserID returns the user's sessions that are neither revoked nor
+// expired. Sessions without an expiry do not expire.
+func (r *SessionRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.active(userID), nil
+}
+
+// active returns the user's live sessions. The caller holds the lock.
+func (r *SessionRepo) active(userID string) []*entity.Session {
+	now := time.Now()
+	sessions := []*entity.Session{}
+	for _, session := range r.Sessions {
+		if session.UserID == userID && !session.IsRevoked && (session.ExpiresAt.IsZero() || session.ExpiresAt.After(now)) {
+			found := *session
+			sessions = append(sessions, &found)
+		}
+	}
+	return sessions
+}
+
+func (r *SessionRepo) Touch(ctx context.Context, id string, lastUsedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.Sessions[id]
+	if !ok {
+		return apperror.ErrRecordNotFound
+	}
+	r.touched = append(r.touched, id)
+	session.LastUsedAt = lastUsedAt
+	return nil
+}
+
+// Touched returns the IDs of the sessions touched so far, in order.
+func (r *SessionRepo) Touched() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.touched)
+}
+
+func (r *SessionRepo) Revoke(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.Sessions[id]
+	if !ok {
+		return apperror.ErrRecordNotFound
+	}
+	session.IsRevoked = true
+	return nil
+}
+
+func (r *SessionRepo) Rotate(ctx context.Context, id string, next *entity.Session, tokens *entity.TokenPair, grace time.Duration) (*entity.TokenPair, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.Sessions[id]
+	switch {
+	case !ok:
+		return nil, apperror.ErrRecordNotFound
+	case session.ReplacedBy != "":
+		if issued, ok := r.successors[id]; ok && time.Now().Before(issued.until) && !r.Sessions[session.ReplacedBy].IsRevoked {
+			return issued.tokens, nil
+		}
+		return nil, apperror.ErrSessionReused
+	case session.IsRevoked:
+		return nil, apperror.ErrUnauthorized
+	}
+	session.IsRevoked = true
+	session.ReplacedBy = next.ID
+	r.Sessions[next.ID] = next
+	if grace > 0 {
+		r.successors[id] = successor{tokens: tokens, until: time.Now().Add(grace)}
+	}
+	return tokens, nil
+}
+
+func (r *SessionRepo) RevokeFamily(ctx context.Context, userID, familyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, session := range r.active(userID) {
+		if session.Family() == familyID {
+			r.Sessions[session.ID].IsRevoked = true
+		}
+	}
+	return nil
+}
+
+func (r *SessionRepo) RevokeByUserID(ctx context.Context, userID string, exceptIDs ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, session := range r.active(userID) {
+		if !slices.Contains(exceptIDs, session.ID) {
+			r.Sessions[session.ID].IsRevoked = true
+		}
+	}
+	return nil
+}
+
+func (r *SessionRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.Sessions, id)
+	return nil
+}
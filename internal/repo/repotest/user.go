@@ -0,0 +1,119 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+// UserRepo keeps users by ID. Finders return the stored user, so a test can
+// change it directly. Identities created along with a user are stored with
+// it, as the database does through the association, and IdentityRepo reads
+// them from there.
+type UserRepo struct {
+	mu    sync.Mutex
+	Users map[string]*entity.User
+}
+
+// NewUserRepo returns a repo holding users, which keep their IDs.
+func NewUserRepo(users ...*entity.User) *UserRepo {
+	r := &UserRepo{Users: map[string]*entity.User{}}
+	for _, user := range users {
+		r.Users[user.ID] = user
+	}
+	return r
+}
+
+func (r *UserRepo) Create(ctx context.Context, user *entity.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.ID = uuid.NewString()
+	for i := range user.Identities {
+		user.Identities[i].ID = uuid.NewString()
+		user.Identities[i].UserID = user.ID
+	}
+	r.Users[user.ID] = user
+	return nil
+}
+
+func (r *UserRepo) FindAll(ctx context.Context) ([]*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sorted(func(*entity.User) bool { return true }), nil
+}
+
+// Search matches query against the email and names without regard to case,
+// like the ILIKE of the real repo.
+func (r *UserRepo) Search(ctx context.Context, query string, offset, limit int) ([]*entity.User, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	query = strings.ToLower(query)
+	users := r.sorted(func(user *entity.User) bool {
+		return slices.ContainsFunc([]string{user.Email, user.Name, user.FirstName, user.LastName}, func(s string) bool {
+			return strings.Contains(strings.ToLower(s), query)
+		})
+	})
+	total := int64(len(users))
+	users = users[min(offset, len(users)):]
+	return users[:min(limit, len(users))], total, nil
+}
+
+// sorted returns the users matching keep, ordered by email.
+func (r *UserRepo) sorted(keep func(*entity.User) bool) []*entity.User {
+	users := []*entity.User{}
+	for _, user := range r.Users {
+		if keep(user) {
+			users = append(users, user)
+		}
+	}
+	slices.SortFunc(users, func(a, b *entity.User) int { return strings.Compare(a.Email, b.Email) })
+	return users
+}
+
+func (r *UserRepo) FindByID(ctx context.Context, id string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if user, ok := r.Users[id]; ok {
+		return user, nil
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *UserRepo) FindByEmail(ctx context.Context, email string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.Users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, apperror.ErrRecordNotFound
+}
+
+func (r *UserRepo) Update(ctx context.Context, id string, fields map[string]interface{}) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.Users[id]
+	if !ok {
+		return nil, apperror.ErrRecordNotFound
+	}
+	if err := update(user, fields); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *UserRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.Users[id]; !ok {
+		return apperror.ErrRecordNotFound
+	}
+	delete(r.Users, id)
+	return nil
+}
@@ -0,0 +1,110 @@
+package role
+
+import (
+	"context"
+	"errors"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RoleRepo struct {
+	db *gorm.DB
+}
+
+func NewRoleRepo(db *gorm.DB) *RoleRepo {
+	return &RoleRepo{db: db}
+}
+
+// Save creates the role or, when one with its name exists, replaces its
+// description and permissions. role is filled in with the stored record.
+func (r *RoleRepo) Save(ctx context.Context, role *entity.Role) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing entity.Role
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&existing, "name = ?", role.Name).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(role).Error
+		}
+		if err != nil {
+			return err
+		}
+		existing.Description = role.Description
+		existing.Permissions = role.Permissions
+		if err := tx.Save(&existing).Error; err != nil {
+			return err
+		}
+		*role = existing
+		return nil
+	})
+}
+
+func (r *RoleRepo) FindAll(ctx context.Context) ([]*entity.Role, error) {
+	db := r.db.WithContext(ctx)
+	var roles []*entity.Role
+	if err := db.Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *RoleRepo) FindByName(ctx context.Context, name string) (*entity.Role, error) {
+	db := r.db.WithContext(ctx)
+	var role entity.Role
+	if err := db.First(&role, "name = ?", name).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *RoleRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.Role, error) {
+	db := r.db.WithContext(ctx)
+	var roles []*entity.Role
+	if err := db.Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// Delete removes the role along with its assignments.
+func (r *RoleRepo) Delete(ctx context.Context, name string) error {
+	db := r.db.WithContext(ctx)
+	result := db.Delete(&entity.Role{}, "name = ?", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Assign gives the user the role. Assigning a role twice is not an error.
+func (r *RoleRepo) Assign(ctx context.Context, userID, roleID string) error {
+	db := r.db.WithContext(ctx)
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.UserRole{UserID: userID, RoleID: roleID}).Error
+}
+
+func (r *RoleRepo) Unassign(ctx context.Context, userID, roleID string) error {
+	db := r.db.WithContext(ctx)
+	result := db.Delete(&entity.UserRole{}, "user_id = ? AND role_id = ?", userID, roleID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *RoleRepo) CountUsers(ctx context.Context, roleID string) (int64, error) {
+	db := r.db.WithContext(ctx)
+	var count int64
+	if err := db.Model(&entity.UserRole{}).Where("role_id = ?", roleID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,72 @@
+package serviceaccount
+
+import (
+	"context"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"gorm.io/gorm"
+)
+
+type ServiceAccountRepo struct {
+	db *gorm.DB
+}
+
+func NewServiceAccountRepo(db *gorm.DB) *ServiceAccountRepo {
+	return &ServiceAccountRepo{db: db}
+}
+
+// Create stores the account together with its first secret.
+func (r *ServiceAccountRepo) Create(ctx context.Context, account *entity.ServiceAccount) error {
+	db := r.db.WithContext(ctx)
+	return db.Create(account).Error
+}
+
+func (r *ServiceAccountRepo) FindAll(ctx context.Context) ([]*entity.ServiceAccount, error) {
+	db := r.db.WithContext(ctx)
+	var accounts []*entity.ServiceAccount
+	if err := db.Preload("Secrets").Order("created_at").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (r *ServiceAccountRepo) FindByID(ctx context.Context, id string) (*entity.ServiceAccount, error) {
+	db := r.db.WithContext(ctx)
+	var account entity.ServiceAccount
+	if err := db.Preload("Secrets").First(&account, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (r *ServiceAccountRepo) Delete(ctx context.Context, id string) error {
+	db := r.db.WithContext(ctx)
+	result := db.Delete(&entity.ServiceAccount{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddSecret adds a secret and has the account's other secrets expire at
+// expireOthersAt, unless they expire sooner already. Secrets that have
+// expired are deleted.
+func (r *ServiceAccountRepo) AddSecret(ctx context.Context, secret *entity.ServiceAccountSecret, expireOthersAt time.Time) error {
+	db := r.db.WithContext(ctx)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_account_id = ? AND expires_at <= ?", secret.ServiceAccountID, time.Now()).
+			Delete(&entity.ServiceAccountSecret{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.ServiceAccountSecret{}).
+			Where("service_account_id = ? AND (expires_at IS NULL OR expires_at > ?)", secret.ServiceAccountID, expireOthersAt).
+			Update("expires_at", expireOthersAt).Error; err != nil {
+			return err
+		}
+		return tx.Create(secret).Error
+	})
+}
@@ -3,9 +3,12 @@ package session
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"slices"
 	"time"
 
 	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -40,6 +43,9 @@ func (r *SessionRepo) FindByID(ctx context.Context, id string) (*entity.Session,
 	key := "session:" + id
 
 	data, err := r.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, apperror.ErrRecordNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +57,8 @@ func (r *SessionRepo) FindByID(ctx context.Context, id string) (*entity.Session,
 	return &session, nil
 }
 
+// FindByUserID returns the user's active sessions. IDs of sessions that have
+// expired or were revoked are pruned from the user's set along the way.
 func (r *SessionRepo) FindByUserID(ctx context.Context, userID string) ([]*entity.Session, error) {
 	userSessionsKey := "user_sessions:" + userID
 	sessionIDs, err := r.rdb.SMembers(ctx, userSessionsKey).Result()
@@ -66,12 +74,12 @@ func (r *SessionRepo) FindByUserID(ctx context.Context, userID string) ([]*entit
 	for i, id := range sessionIDs {
 		cmds[i] = pipe.Get(ctx, "session:"+id)
 	}
-	_, err = pipe.Exec(ctx)
-	if err != nil {
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
 		return []*entity.Session{}, err
 	}
 
-	var sessions []*entity.Session
+	now := time.Now()
+	sessions := []*entity.Session{}
 	var staleIDs []string
 	for i, cmd := range cmds {
 		s := &entity.Session{}
@@ -79,43 +87,171 @@ func (r *SessionRepo) FindByUserID(ctx context.Context, userID string) ([]*entit
 		if err == nil {
 			err = json.Unmarshal(data, &s)
 		}
-		if err != nil || s.ID == "" {
+		if err != nil || s.ID == "" || s.IsRevoked || !s.ExpiresAt.After(now) {
 			staleIDs = append(staleIDs, sessionIDs[i])
 		} else {
 			sessions = append(sessions, s)
 		}
 	}
 	if len(staleIDs) > 0 {
-		go r.rdb.SRem(ctx, userSessionsKey, staleIDs)
+		if err := r.rdb.SRem(ctx, userSessionsKey, staleIDs).Err(); err != nil {
+			return nil, err
+		}
 	}
 
 	return sessions, nil
 }
 
-func (r *SessionRepo) Revoke(ctx context.Context, id string) error {
-	key := "session:" + id
+// patchScript merges ARGV[1] into the stored session, keeping its TTL, and
+// returns the session's user ID. Doing this in one script keeps concurrent
+// updates from overwriting each other.
+var patchScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return false
+end
+local session = cjson.decode(data)
+for field, value in pairs(cjson.decode(ARGV[1])) do
+	session[field] = value
+end
+redis.call('SET', KEYS[1], cjson.encode(session), 'KEEPTTL')
+return session.user_id
+`)
 
-	data, err := r.rdb.Get(ctx, key).Bytes()
+// rotateScript replaces the session in KEYS[1] with the one in ARGV[1]
+// (KEYS[2]) unless it was already rotated. The successor's tokens are kept in
+// KEYS[4] for the grace period, during which presenting the old token again
+// returns them instead of failing.
+var rotateScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return {'missing'}
+end
+local session = cjson.decode(data)
+if session.replaced_by and session.replaced_by ~= '' then
+	local tokens = redis.call('GET', KEYS[4])
+	local successor = redis.call('GET', 'session:' .. session.replaced_by)
+	if tokens and successor and not cjson.decode(successor).is_revoked then
+		return {'grace', tokens}
+	end
+	return {'reused'}
+end
+if session.is_revoked then
+	return {'revoked'}
+end
+session.is_revoked = true
+session.replaced_by = ARGV[2]
+redis.call('SET', KEYS[1], cjson.encode(session), 'KEEPTTL')
+redis.call('SET', KEYS[2], ARGV[1], 'PX', ARGV[3])
+redis.call('SREM', KEYS[3], session.id)
+redis.call('SADD', KEYS[3], ARGV[2])
+if tonumber(ARGV[5]) > 0 then
+	redis.call('SET', KEYS[4], ARGV[4], 'PX', ARGV[5])
+end
+return {'rotated'}
+`)
+
+// Touch records when the session was last used.
+func (r *SessionRepo) Touch(ctx context.Context, id string, lastUsedAt time.Time) error {
+	_, err := r.patch(ctx, id, map[string]interface{}{"last_used_at": lastUsedAt})
+	return err
+}
+
+// Revoke marks the session as revoked and drops it from the user's set. The
+// record itself is kept until it expires so a reused token is recognised.
+func (r *SessionRepo) Revoke(ctx context.Context, id string) error {
+	userID, err := r.patch(ctx, id, map[string]interface{}{"is_revoked": true})
 	if err != nil {
 		return err
 	}
-	ttl, err := r.rdb.TTL(ctx, key).Result()
+	return r.rdb.SRem(ctx, "user_sessions:"+userID, id).Err()
+}
+
+// Rotate atomically replaces the session with next and keeps tokens, the
+// pair issued for next, for the grace period. If the session was rotated
+// within the grace period, the pair issued back then is returned and next is
+// discarded. A session rotated earlier yields ErrSessionReused, a revoked one
+// ErrUnauthorized.
+func (r *SessionRepo) Rotate(ctx context.Context, id string, next *entity.Session, tokens *entity.TokenPair, grace time.Duration) (*entity.TokenPair, error) {
+	sessionData, err := json.Marshal(next)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	tokenData, err := json.Marshal(tokens)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{"session:" + id, "session:" + next.ID, "user_sessions:" + next.UserID, "session_successor:" + id}
+	result, err := rotateScript.Run(ctx, r.rdb, keys,
+		sessionData, next.ID, time.Until(next.ExpiresAt).Milliseconds(), tokenData, grace.Milliseconds(),
+	).StringSlice()
+	if err != nil {
+		return nil, err
 	}
 
-	var session entity.Session
-	if err := json.Unmarshal(data, &session); err != nil {
-		return err
+	switch result[0] {
+	case "rotated":
+		return tokens, nil
+	case "grace":
+		var issued entity.TokenPair
+		if err := json.Unmarshal([]byte(result[1]), &issued); err != nil {
+			return nil, err
+		}
+		return &issued, nil
+	case "reused":
+		return nil, apperror.ErrSessionReused
+	case "missing":
+		return nil, apperror.ErrRecordNotFound
+	default:
+		return nil, apperror.ErrUnauthorized
 	}
-	session.IsRevoked = true
-	newData, err := json.Marshal(&session)
+}
+
+// RevokeFamily revokes every active session of the user that belongs to the
+// family.
+func (r *SessionRepo) RevokeFamily(ctx context.Context, userID, familyID string) error {
+	sessions, err := r.FindByUserID(ctx, userID)
 	if err != nil {
 		return err
 	}
-	if err := r.rdb.Set(ctx, key, newData, ttl).Err(); err != nil {
+	for _, session := range sessions {
+		if session.Family() != familyID {
+			continue
+		}
+		if err := r.Revoke(ctx, session.ID); err != nil && !errors.Is(err, apperror.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// patch updates fields of the stored session and returns its user ID.
+func (r *SessionRepo) patch(ctx context.Context, id string, fields map[string]interface{}) (string, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	userID, err := patchScript.Run(ctx, r.rdb, []string{"session:" + id}, data).Text()
+	if errors.Is(err, redis.Nil) {
+		return "", apperror.ErrRecordNotFound
+	}
+	return userID, err
+}
+
+// RevokeByUserID revokes every session of the user except the given ones.
+func (r *SessionRepo) RevokeByUserID(ctx context.Context, userID string, exceptIDs ...string) error {
+	sessions, err := r.FindByUserID(ctx, userID)
+	if err != nil {
 		return err
 	}
+	for _, session := range sessions {
+		if session.IsRevoked || slices.Contains(exceptIDs, session.ID) {
+			continue
+		}
+		if err := r.Revoke(ctx, session.ID); err != nil && !errors.Is(err, apperror.ErrRecordNotFound) {
+			return err
+		}
+	}
 	return nil
 }
 
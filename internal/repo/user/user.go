@@ -2,6 +2,7 @@ package user
 
 import (
 	"context"
+	"strings"
 
 	"github.com/KimNattanan/go-user-service/internal/entity"
 	"gorm.io/gorm"
@@ -33,6 +34,34 @@ func (r *UserRepo) FindAll(ctx context.Context) ([]*entity.User, error) {
 	return users, nil
 }
 
+// Search pages through users whose email or name contains query, ordered by
+// email. It also returns the number of matches.
+func (r *UserRepo) Search(ctx context.Context, query string, offset, limit int) ([]*entity.User, int64, error) {
+	db := r.db.WithContext(ctx).Model(&entity.User{})
+	if query != "" {
+		pattern := "%" + escapeLike(query) + "%"
+		db = db.Where("email ILIKE ? OR name ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?", pattern, pattern, pattern, pattern)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var userValues []entity.User
+	if err := db.Preload("Preference").Order("email").Offset(offset).Limit(limit).Find(&userValues).Error; err != nil {
+		return nil, 0, err
+	}
+	users := make([]*entity.User, len(userValues))
+	for i := range users {
+		users[i] = &userValues[i]
+	}
+	return users, total, nil
+}
+
+// escapeLike makes the LIKE wildcards in s match literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func (r *UserRepo) FindByID(ctx context.Context, id string) (*entity.User, error) {
 	db := r.db.WithContext(ctx)
 	var user entity.User
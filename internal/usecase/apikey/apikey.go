@@ -0,0 +1,114 @@
+package apikey
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/securetoken"
+	"github.com/google/uuid"
+)
+
+const (
+	// Keys look like usk_<prefix>_<secret>. The prefix has a fixed length, so
+	// the key is split by position rather than on the separator, which may
+	// also appear in the base64url parts.
+	keyTag       = "usk_"
+	prefixBytes  = 6 // 8 base64url characters
+	prefixLength = 8
+	secretBytes  = 32
+
+	// lastUsedResolution limits how often a key's last use is written back.
+	lastUsedResolution = time.Minute
+)
+
+type APIKeyUsecase struct {
+	repo repo.APIKeyRepo
+}
+
+func NewAPIKeyUsecase(repo repo.APIKeyRepo) *APIKeyUsecase {
+	return &APIKeyUsecase{repo: repo}
+}
+
+// Create issues a key for the user and returns it in full. Only its hash is
+// stored, so this is the only time the key can be seen.
+func (u *APIKeyUsecase) Create(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (*entity.APIKey, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", apperror.ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(entity.APIKeyScopes, scope) {
+			return nil, "", apperror.ErrInvalidScope
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", apperror.ErrInvalidData
+	}
+	prefix, err := securetoken.Generate(prefixBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := securetoken.Generate(secretBytes)
+	if err != nil {
+		return nil, "", err
+	}
+	key := keyTag + prefix + "_" + secret
+	apiKey := &entity.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      securetoken.Hash(key),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(scopes))),
+		ExpiresAt: expiresAt,
+	}
+	if err := u.repo.Create(ctx, apiKey); err != nil {
+		return nil, "", err
+	}
+	return apiKey, key, nil
+}
+
+func (u *APIKeyUsecase) FindByUserID(ctx context.Context, userID string) ([]*entity.APIKey, error) {
+	return u.repo.FindByUserID(ctx, userID)
+}
+
+// Revoke deletes one of the user's keys. It stops working right away, since
+// the auth middleware looks the key up on every request.
+func (u *APIKeyUsecase) Revoke(ctx context.Context, userID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return apperror.ErrRecordNotFound
+	}
+	return u.repo.Delete(ctx, userID, id)
+}
+
+// Authenticate returns the unexpired key matching key.
+func (u *APIKeyUsecase) Authenticate(ctx context.Context, key string) (*entity.APIKey, error) {
+	if len(key) <= len(keyTag)+prefixLength+1 || !strings.HasPrefix(key, keyTag) || key[len(keyTag)+prefixLength] != '_' {
+		return nil, apperror.ErrUnauthorized
+	}
+	apiKey, err := u.repo.FindByPrefix(ctx, key[len(keyTag):len(keyTag)+prefixLength])
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(securetoken.Hash(key)), []byte(apiKey.Hash)) != 1 || apiKey.Expired(time.Now()) {
+		return nil, apperror.ErrUnauthorized
+	}
+	return apiKey, nil
+}
+
+// Touch records that the key was used. Writes are skipped while the stored
+// time is within lastUsedResolution.
+func (u *APIKeyUsecase) Touch(ctx context.Context, apiKey *entity.APIKey) error {
+	if apiKey.LastUsedAt != nil && time.Since(*apiKey.LastUsedAt) < lastUsedResolution {
+		return nil
+	}
+	return u.repo.Touch(ctx, apiKey.ID, time.Now())
+}
@@ -0,0 +1,92 @@
+package apikey_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	apiKeyUsecase "github.com/KimNattanan/go-user-service/internal/usecase/apikey"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+)
+
+func setup() (*apiKeyUsecase.APIKeyUsecase, *repotest.APIKeyRepo) {
+	repo := repotest.NewAPIKeyRepo()
+	return apiKeyUsecase.NewAPIKeyUsecase(repo), repo
+}
+
+func TestCreateRejectsUnknownScopes(t *testing.T) {
+	u, _ := setup()
+	for _, scopes := range [][]string{nil, {entity.PermissionUsersRead}} {
+		if _, _, err := u.Create(context.Background(), "user", "script", scopes, nil); !errors.Is(err, apperror.ErrInvalidScope) {
+			t.Errorf("expected %v for scopes %v, got %v", apperror.ErrInvalidScope, scopes, err)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	u, repo := setup()
+	ctx := context.Background()
+
+	apiKey, key, err := u.Create(ctx, "user", "script", []string{entity.ScopeProfileRead}, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if apiKey.Hash == key || apiKey.Hash == "" {
+		t.Fatal("expected only a hash of the key to be stored")
+	}
+	found, err := u.Authenticate(ctx, key)
+	if err != nil || found.ID != apiKey.ID {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	for _, bad := range []string{"", "usk_", key[:len(key)-1], key + "x", "usk_" + apiKey.Prefix + "_guess"} {
+		if _, err := u.Authenticate(ctx, bad); !errors.Is(err, apperror.ErrUnauthorized) {
+			t.Errorf("expected %v for %q, got %v", apperror.ErrUnauthorized, bad, err)
+		}
+	}
+
+	past := time.Now().Add(-time.Second)
+	repo.Key(apiKey.ID).ExpiresAt = &past
+	if _, err := u.Authenticate(ctx, key); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected expired key to be rejected, got %v", err)
+	}
+
+	repo.Key(apiKey.ID).ExpiresAt = nil
+	if err := u.Revoke(ctx, "someone-else", apiKey.ID); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected other users' keys to be left alone, got %v", err)
+	}
+	if err := u.Revoke(ctx, "user", apiKey.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := u.Authenticate(ctx, key); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected revoked key to be rejected, got %v", err)
+	}
+}
+
+func TestTouchIsThrottled(t *testing.T) {
+	u, repo := setup()
+	ctx := context.Background()
+
+	apiKey, _, err := u.Create(ctx, "user", "script", []string{entity.ScopeProfileRead}, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for range 3 {
+		if err := u.Touch(ctx, apiKey); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+	}
+	if repo.Touches() != 1 {
+		t.Errorf("expected 1 write, got %d", repo.Touches())
+	}
+
+	stale := time.Now().Add(-2 * time.Minute)
+	apiKey.LastUsedAt = &stale
+	u.Touch(ctx, apiKey)
+	if repo.Touches() != 2 {
+		t.Errorf("expected a stale last use to be written, got %d writes", repo.Touches())
+	}
+}
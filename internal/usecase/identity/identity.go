@@ -0,0 +1,319 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/identity"
+	"github.com/KimNattanan/go-user-service/pkg/securetoken"
+)
+
+// authorizationTTL bounds how long a user may take at the provider's login
+// page before the state expires.
+const authorizationTTL = 10 * time.Minute
+
+type IdentityUsecase struct {
+	userRepo         repo.UserRepo
+	identityRepo     repo.IdentityRepo
+	passkeyRepo      repo.PasskeyRepo
+	tokenRepo        repo.OneTimeTokenRepo
+	providers        identity.Registry
+	redirectAllow    []*url.URL
+	registrationOpen bool
+}
+
+func NewIdentityUsecase(userRepo repo.UserRepo, identityRepo repo.IdentityRepo, passkeyRepo repo.PasskeyRepo, tokenRepo repo.OneTimeTokenRepo, providers identity.Registry, cfg *config.Config) *IdentityUsecase {
+	return &IdentityUsecase{
+		userRepo:         userRepo,
+		identityRepo:     identityRepo,
+		passkeyRepo:      passkeyRepo,
+		tokenRepo:        tokenRepo,
+		providers:        providers,
+		redirectAllow:    parseAllowlist(cfg.LoginRedirectAllowlist),
+		registrationOpen: cfg.RegistrationOpen,
+	}
+}
+
+func parseAllowlist(entries []string) []*url.URL {
+	allowlist := make([]*url.URL, 0, len(entries))
+	for _, entry := range entries {
+		allowed, err := url.Parse(entry)
+		if err != nil || allowed.Host == "" {
+			log.Printf("ignoring invalid login redirect allowlist entry %q", entry)
+			continue
+		}
+		allowlist = append(allowlist, allowed)
+	}
+	return allowlist
+}
+
+// redirectAllowed reports whether returnTo is an absolute http(s) URL on an
+// allowlisted origin and, if the entry has a path, at or below that path.
+// Dot segments are resolved first, as the browser would.
+func (u *IdentityUsecase) redirectAllowed(returnTo string) bool {
+	target, err := url.Parse(returnTo)
+	if err != nil || target.User != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https") {
+		return false
+	}
+	targetPath := path.Clean("/" + target.Path)
+	for _, allowed := range u.redirectAllow {
+		if !strings.EqualFold(target.Scheme, allowed.Scheme) || !strings.EqualFold(target.Host, allowed.Host) {
+			continue
+		}
+		prefix := strings.TrimSuffix(allowed.Path, "/")
+		if prefix == "" || targetPath == prefix || strings.HasPrefix(targetPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// BeginAuthorization starts an authorization code flow with PKCE and, for
+// OIDC providers, a nonce. The verifier and nonce never leave the server:
+// they are stored under the state, which the caller has to bind to the
+// browser and hand back to CompleteAuthorization. An optional returnTo must
+// pass the redirect allowlist.
+func (u *IdentityUsecase) BeginAuthorization(ctx context.Context, providerName, linkUserID, returnTo string) (string, string, error) {
+	provider, err := u.providers.Get(providerName)
+	if err != nil {
+		return "", "", err
+	}
+	if returnTo != "" && !u.redirectAllowed(returnTo) {
+		return "", "", apperror.ErrInvalidRedirect
+	}
+	req := identity.NewAuthRequest()
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	if err != nil {
+		log.Printf("identity provider %s: %v", providerName, err)
+		return "", "", fmt.Errorf("%w: identity provider unavailable", apperror.ErrDependencyFail)
+	}
+
+	now := time.Now()
+	if err := u.tokenRepo.Create(ctx, &entity.OneTimeToken{
+		Hash:    securetoken.Hash(req.State),
+		Purpose: entity.TokenPurposeOAuthState,
+		Data: map[string]string{
+			"provider":      provider.Name(),
+			"code_verifier": req.CodeVerifier,
+			"nonce":         req.Nonce,
+			"link_user_id":  linkUserID,
+			"return_to":     returnTo,
+		},
+		CreatedAt: now,
+		ExpiresAt: now.Add(authorizationTTL),
+	}); err != nil {
+		return "", "", err
+	}
+	return authURL, req.State, nil
+}
+
+// CompleteAuthorization redeems the state exactly once, so a replayed
+// callback fails even if the code has not been used yet, then exchanges the
+// code with the stored PKCE verifier and checks the ID token nonce.
+func (u *IdentityUsecase) CompleteAuthorization(ctx context.Context, providerName, state, code string) (*usecase.Authorization, error) {
+	if state == "" {
+		return nil, apperror.ErrInvalidOAuthState
+	}
+	stored, err := u.tokenRepo.Consume(ctx, entity.TokenPurposeOAuthState, securetoken.Hash(state))
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidOAuthState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.Data["provider"] != providerName {
+		return nil, apperror.ErrInvalidOAuthState
+	}
+	provider, err := u.providers.Get(providerName)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return nil, apperror.ErrInvalidData
+	}
+
+	claims, token, err := provider.Exchange(ctx, code, &identity.AuthRequest{
+		State:        state,
+		CodeVerifier: stored.Data["code_verifier"],
+		Nonce:        stored.Data["nonce"],
+	})
+	if err != nil {
+		log.Printf("identity provider %s: %v", providerName, err)
+		return nil, apperror.ErrUnauthorized
+	}
+	return &usecase.Authorization{
+		Claims:               claims,
+		ProviderRefreshToken: token.RefreshToken,
+		LinkUserID:           stored.Data["link_user_id"],
+		ReturnTo:             stored.Data["return_to"],
+	}, nil
+}
+
+// LoginOrRegister signs in the user linked to the external account. Unknown
+// accounts create a new user, unless the email already belongs to someone:
+// that user has to sign in and link the identity explicitly.
+func (u *IdentityUsecase) LoginOrRegister(ctx context.Context, claims *identity.Claims) (*entity.User, error) {
+	now := time.Now()
+	linked, err := u.identityRepo.FindByProviderSubject(ctx, claims.Provider, claims.Subject)
+	if err == nil {
+		if err := u.identityRepo.Update(ctx, linked.ID, map[string]interface{}{
+			"email":         claims.Email,
+			"last_login_at": now,
+		}); err != nil {
+			return nil, err
+		}
+		return u.userRepo.Update(ctx, linked.UserID, profileFields(claims))
+	}
+	if !errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Subject == "" || claims.Email == "" {
+		return nil, apperror.ErrInvalidData
+	}
+	if !claims.EmailVerified {
+		return nil, apperror.ErrEmailNotVerified
+	}
+	newIdentity := entity.Identity{
+		Provider:    claims.Provider,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}
+
+	user, err := u.userRepo.FindByEmail(ctx, claims.Email)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		if !u.registrationOpen {
+			return nil, apperror.ErrRegistrationClosed
+		}
+		user = &entity.User{
+			Email:           claims.Email,
+			Name:            claims.Name,
+			FirstName:       claims.GivenName,
+			LastName:        claims.FamilyName,
+			PictureURL:      claims.Picture,
+			EmailVerified:   true,
+			EmailVerifiedAt: &now,
+			Identities:      []entity.Identity{newIdentity},
+		}
+		if err := u.userRepo.Create(ctx, user); err != nil {
+			return nil, err
+		}
+		return u.userRepo.FindByID(ctx, user.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	adopt, err := u.isUnlinkedGoogleAccount(ctx, user, claims)
+	if err != nil {
+		return nil, err
+	}
+	if !adopt {
+		return nil, apperror.ErrIdentityNotLinked
+	}
+	newIdentity.UserID = user.ID
+	if err := u.identityRepo.Create(ctx, &newIdentity); err != nil {
+		return nil, err
+	}
+	fields := profileFields(claims)
+	if !user.EmailVerified {
+		fields["email_verified"] = true
+		fields["email_verified_at"] = now
+	}
+	return u.userRepo.Update(ctx, user.ID, fields)
+}
+
+// isUnlinkedGoogleAccount reports whether user looks like it was created by
+// Google sign-in before identities were recorded: no password and no linked
+// identity. Such accounts are adopted on their next Google login instead of
+// being locked out.
+func (u *IdentityUsecase) isUnlinkedGoogleAccount(ctx context.Context, user *entity.User, claims *identity.Claims) (bool, error) {
+	if claims.Provider != config.IdentityProviderGoogle || user.Password != "" {
+		return false, nil
+	}
+	identities, err := u.identityRepo.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return len(identities) == 0, nil
+}
+
+// Link attaches the external account to an already authenticated user.
+func (u *IdentityUsecase) Link(ctx context.Context, userID string, claims *identity.Claims) (*entity.Identity, error) {
+	if claims.Subject == "" {
+		return nil, apperror.ErrInvalidData
+	}
+	linked, err := u.identityRepo.FindByProviderSubject(ctx, claims.Provider, claims.Subject)
+	if err == nil {
+		if linked.UserID != userID {
+			return nil, apperror.ErrIdentityInUse
+		}
+		return linked, nil
+	}
+	if !errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, err
+	}
+	newIdentity := &entity.Identity{
+		UserID:   userID,
+		Provider: claims.Provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	if err := u.identityRepo.Create(ctx, newIdentity); err != nil {
+		return nil, err
+	}
+	return newIdentity, nil
+}
+
+func (u *IdentityUsecase) FindByUserID(ctx context.Context, userID string) ([]*entity.Identity, error) {
+	return u.identityRepo.FindByUserID(ctx, userID)
+}
+
+// Unlink removes a linked identity as long as the user keeps another way to
+// sign in: a password, a passkey or another identity.
+func (u *IdentityUsecase) Unlink(ctx context.Context, userID, id string) error {
+	identities, err := u.identityRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, identity := range identities {
+		found = found || identity.ID == id
+	}
+	if !found {
+		return apperror.ErrRecordNotFound
+	}
+
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	passkeys, err := u.passkeyRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" && len(passkeys) == 0 && len(identities) == 1 {
+		return apperror.ErrLastLoginMethod
+	}
+	return u.identityRepo.Delete(ctx, userID, id)
+}
+
+func profileFields(claims *identity.Claims) map[string]interface{} {
+	return map[string]interface{}{
+		"first_name":  claims.GivenName,
+		"last_name":   claims.FamilyName,
+		"picture_url": claims.Picture,
+	}
+}
@@ -2,10 +2,38 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/pkg/identity"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+	"github.com/go-webauthn/webauthn/protocol"
 )
 
+// Authorization is a completed external login together with what the flow
+// was started with.
+type Authorization struct {
+	Claims               *identity.Claims
+	ProviderRefreshToken string
+	LinkUserID           string // set when an authenticated user is linking the identity
+	ReturnTo             string // validated return_to, empty for API clients
+}
+
+// UserPage is one page of a user search.
+type UserPage struct {
+	Users    []*entity.User
+	Total    int64 // matches across all pages
+	Page     int
+	PageSize int
+}
+
+// UserDetails is a user as support staff see them.
+type UserDetails struct {
+	User       *entity.User
+	Identities []*entity.Identity
+	Sessions   []*entity.Session // active sessions, most recently used first
+}
+
 type (
 	UserUsecase interface {
 		FindAll(ctx context.Context) ([]*entity.User, error)
@@ -13,19 +41,119 @@ type (
 		FindByEmail(ctx context.Context, email string) (*entity.User, error)
 		Update(ctx context.Context, id string, fields map[string]interface{}) (*entity.User, error)
 		Delete(ctx context.Context, id string) error
-		LoginOrRegisterWithGoogle(ctx context.Context, userInfo map[string]interface{}) (*entity.User, error)
 		Register(ctx context.Context, user *entity.User) (*entity.User, error)
 		Login(ctx context.Context, email, password string) (*entity.User, error)
+		ResendVerification(ctx context.Context, email string) error
+		VerifyEmail(ctx context.Context, token string) (*entity.User, error)
+		ForgotPassword(ctx context.Context, email string) error
+		ResetPassword(ctx context.Context, token, password string) error
+		ChangePassword(ctx context.Context, userID, sessionID, currentPassword, newPassword string) error
+		StartEmailLogin(ctx context.Context, email, method string) error
+		CompleteEmailLogin(ctx context.Context, email, secret string) (*entity.User, error)
+	}
+	UserAdminUsecase interface {
+		Search(ctx context.Context, query string, page, pageSize int) (*UserPage, error)
+		FindByID(ctx context.Context, actor *entity.Actor, id string) (*UserDetails, error)
+		Update(ctx context.Context, actor *entity.Actor, id string, fields map[string]interface{}) (*entity.User, error)
+		Disable(ctx context.Context, actor *entity.Actor, id string) (*entity.User, error)
+		Enable(ctx context.Context, actor *entity.Actor, id string) (*entity.User, error)
+		RequirePasswordReset(ctx context.Context, actor *entity.Actor, id string) (*entity.User, error)
+		RevokeSessions(ctx context.Context, actor *entity.Actor, id string) error
+		Unlock(ctx context.Context, actor *entity.Actor, id string) error
+		AssignRole(ctx context.Context, actor *entity.Actor, id, role string) error
+		UnassignRole(ctx context.Context, actor *entity.Actor, id, role string) error
+		Delete(ctx context.Context, actor *entity.Actor, id string) error
+		Impersonate(ctx context.Context, actor *entity.Actor, id string) (*entity.TokenPair, error)
+		EndImpersonation(ctx context.Context, actor *entity.Actor, userID, sessionID string) error
+		RecordImpersonatedRequest(ctx context.Context, actor *entity.Actor, userID, sessionID, method, path string, blocked bool) error
+	}
+	IdentityUsecase interface {
+		BeginAuthorization(ctx context.Context, providerName, linkUserID, returnTo string) (authURL string, state string, err error)
+		CompleteAuthorization(ctx context.Context, providerName, state, code string) (*Authorization, error)
+		LoginOrRegister(ctx context.Context, claims *identity.Claims) (*entity.User, error)
+		Link(ctx context.Context, userID string, claims *identity.Claims) (*entity.Identity, error)
+		FindByUserID(ctx context.Context, userID string) ([]*entity.Identity, error)
+		Unlink(ctx context.Context, userID, id string) error
+	}
+	MFAUsecase interface {
+		EnrollTOTP(ctx context.Context, userID string) (secret string, uri string, err error)
+		ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error)
+		DisableTOTP(ctx context.Context, userID, code string) error
+		RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error)
+		CreateChallenge(ctx context.Context, user *entity.User, provider, providerRefreshToken string) (string, error)
+		FindChallenge(ctx context.Context, challengeToken string) (*entity.OneTimeToken, error)
+		VerifyChallenge(ctx context.Context, challengeToken, code string) (user *entity.User, provider string, providerRefreshToken string, err error)
+	}
+	LoginThrottleUsecase interface {
+		Check(ctx context.Context, email, ip string) (retryAfter time.Duration, err error)
+		RecordFailure(ctx context.Context, email, ip string) error
+		Reset(ctx context.Context, email string) error
+		Status(ctx context.Context, email string) (*entity.LoginThrottle, error)
+	}
+	APIKeyUsecase interface {
+		Create(ctx context.Context, userID, name string, scopes []string, expiresAt *time.Time) (*entity.APIKey, string, error)
+		FindByUserID(ctx context.Context, userID string) ([]*entity.APIKey, error)
+		Revoke(ctx context.Context, userID, id string) error
+		Authenticate(ctx context.Context, key string) (*entity.APIKey, error)
+		Touch(ctx context.Context, apiKey *entity.APIKey) error
+	}
+	PasskeyUsecase interface {
+		BeginRegistration(ctx context.Context, userID string) (string, *protocol.CredentialCreation, error)
+		FinishRegistration(ctx context.Context, userID, ceremonyID, name string, response []byte) (*entity.PasskeyCredential, error)
+		FindByUserID(ctx context.Context, userID string) ([]*entity.PasskeyCredential, error)
+		Rename(ctx context.Context, userID, id, name string) (*entity.PasskeyCredential, error)
+		Delete(ctx context.Context, userID, id string) error
+		BeginLogin(ctx context.Context) (string, *protocol.CredentialAssertion, error)
+		FinishLogin(ctx context.Context, ceremonyID string, response []byte) (*entity.User, error)
 	}
 	PreferenceUsecase interface {
 		FindByUserID(ctx context.Context, userID string) (*entity.Preference, error)
 		Update(ctx context.Context, userID string, fields map[string]interface{}) (*entity.Preference, error)
 	}
+	OAuthUsecase interface {
+		CreateClient(ctx context.Context, client *entity.OAuthClient, confidential bool) (string, error)
+		FindClients(ctx context.Context) ([]*entity.OAuthClient, error)
+		DeleteClient(ctx context.Context, id string) error
+		ValidateClient(ctx context.Context, req *entity.AuthorizationRequest) (*entity.OAuthClient, error)
+		Authorize(ctx context.Context, userID string, client *entity.OAuthClient, req *entity.AuthorizationRequest) (string, string, error)
+		FindConsentRequest(ctx context.Context, userID, id string) (*entity.ConsentRequest, error)
+		DecideConsent(ctx context.Context, userID, id string, allow bool) (*entity.AuthorizationRequest, string, error)
+		Exchange(ctx context.Context, req *entity.TokenRequest) (*entity.OAuthTokens, error)
+		UserInfo(ctx context.Context, accessToken string) (*entity.UserInfo, error)
+	}
+	RoleUsecase interface {
+		Seed(ctx context.Context) error
+		FindAll(ctx context.Context) ([]*entity.Role, error)
+		Save(ctx context.Context, role *entity.Role) error
+		Delete(ctx context.Context, name string) error
+		FindByUserID(ctx context.Context, userID string) ([]*entity.Role, error)
+		Assign(ctx context.Context, userID, name string) error
+		Unassign(ctx context.Context, userID, name string) error
+		Permissions(ctx context.Context, user *entity.User) ([]string, error)
+	}
+	ServiceAccountUsecase interface {
+		Create(ctx context.Context, account *entity.ServiceAccount) (string, error)
+		FindAll(ctx context.Context) ([]*entity.ServiceAccount, error)
+		FindByID(ctx context.Context, id string) (*entity.ServiceAccount, error)
+		Delete(ctx context.Context, id string) error
+		RotateSecret(ctx context.Context, id string, overlap *time.Duration) (string, error)
+		IssueToken(ctx context.Context, clientID, clientSecret, scope string) (*entity.ServiceAccountToken, error)
+		Verify(ctx context.Context, claims *token.UserClaims) (*entity.ServiceAccount, error)
+		Introspect(ctx context.Context, token string) (*entity.TokenIntrospection, error)
+	}
 	SessionUsecase interface {
-		Create(ctx context.Context, session *entity.Session) error
+		Start(ctx context.Context, userID, provider, providerRefreshToken, userAgent, ipAddress string) (*entity.TokenPair, error)
+		StartForClient(ctx context.Context, userID, clientID, scope, userAgent, ipAddress string) (*entity.TokenPair, error)
+		Impersonate(ctx context.Context, impersonatorID, userID, userAgent, ipAddress string) (*entity.TokenPair, error)
+		Refresh(ctx context.Context, refreshToken, clientID, userAgent, ipAddress string) (*entity.Session, *entity.TokenPair, error)
 		FindByID(ctx context.Context, id string) (*entity.Session, error)
 		FindByUserID(ctx context.Context, userID string) ([]*entity.Session, error)
+		Touch(ctx context.Context, session *entity.Session) error
 		Revoke(ctx context.Context, id string) error
+		RevokeForUser(ctx context.Context, userID, id string) error
+		RevokeByUserID(ctx context.Context, userID string, exceptIDs ...string) error
+		Introspect(ctx context.Context, token string) (*entity.TokenIntrospection, error)
+		RevokeToken(ctx context.Context, token string) error
 		Delete(ctx context.Context, id string) error
 	}
 )
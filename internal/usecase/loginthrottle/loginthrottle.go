@@ -0,0 +1,120 @@
+package loginthrottle
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+)
+
+type LoginThrottleUsecase struct {
+	repo            repo.LoginThrottleRepo
+	maxFailures     int
+	delayAfter      int
+	maxDelay        time.Duration
+	failureWindow   time.Duration
+	lockoutDuration time.Duration
+	ipMaxFailures   int
+}
+
+func NewLoginThrottleUsecase(repo repo.LoginThrottleRepo, cfg *config.Config) *LoginThrottleUsecase {
+	return &LoginThrottleUsecase{
+		repo:            repo,
+		maxFailures:     cfg.LoginMaxFailures,
+		delayAfter:      cfg.LoginDelayAfter,
+		maxDelay:        time.Duration(cfg.LoginMaxDelay) * time.Second,
+		failureWindow:   time.Duration(cfg.LoginFailureWindow) * time.Second,
+		lockoutDuration: time.Duration(cfg.LoginLockoutDuration) * time.Second,
+		ipMaxFailures:   cfg.LoginIPMaxFailures,
+	}
+}
+
+func emailSubject(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// Check is called before the password is compared. It returns how long the
+// caller has to wait along with ErrAccountLocked for a locked account, or
+// ErrTooManyAttempts while a progressive delay or the IP limit applies.
+func (u *LoginThrottleUsecase) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := time.Now()
+	throttle, err := u.repo.Find(ctx, emailSubject(email))
+	if err != nil {
+		return 0, err
+	}
+	if throttle.LockedUntil.After(now) {
+		return throttle.LockedUntil.Sub(now), apperror.ErrAccountLocked
+	}
+	if throttle.NextAttemptAt.After(now) {
+		return throttle.NextAttemptAt.Sub(now), apperror.ErrTooManyAttempts
+	}
+
+	if ip == "" {
+		return 0, nil
+	}
+	throttle, err = u.repo.Find(ctx, ipSubject(ip))
+	if err != nil {
+		return 0, err
+	}
+	if throttle.LockedUntil.After(now) {
+		return throttle.LockedUntil.Sub(now), apperror.ErrTooManyAttempts
+	}
+	return 0, nil
+}
+
+// RecordFailure counts a failed password against the email and the IP. From
+// delayAfter failures on, each attempt has to wait twice as long as the one
+// before, up to maxDelay; at maxFailures the account is locked.
+func (u *LoginThrottleUsecase) RecordFailure(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	failures, err := u.repo.RecordFailure(ctx, emailSubject(email), u.failureWindow)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.maxFailures > 0 && failures >= u.maxFailures:
+		if err := u.repo.Block(ctx, emailSubject(email), time.Time{}, now.Add(u.lockoutDuration)); err != nil {
+			return err
+		}
+	case u.delayAfter > 0 && failures >= u.delayAfter:
+		delay := u.maxDelay
+		if shift := failures - u.delayAfter; shift < 16 {
+			delay = min(time.Second<<shift, u.maxDelay)
+		}
+		if err := u.repo.Block(ctx, emailSubject(email), now.Add(delay), time.Time{}); err != nil {
+			return err
+		}
+	}
+
+	if ip == "" || u.ipMaxFailures <= 0 {
+		return nil
+	}
+	failures, err = u.repo.RecordFailure(ctx, ipSubject(ip), u.failureWindow)
+	if err != nil {
+		return err
+	}
+	if failures >= u.ipMaxFailures {
+		return u.repo.Block(ctx, ipSubject(ip), time.Time{}, now.Add(u.failureWindow))
+	}
+	return nil
+}
+
+// Reset clears the email's failures and lock, after a successful login or
+// when an admin unlocks the account. The IP counter is left alone, otherwise
+// signing in to one's own account would reset a credential stuffing run from
+// the same address.
+func (u *LoginThrottleUsecase) Reset(ctx context.Context, email string) error {
+	return u.repo.Delete(ctx, emailSubject(email))
+}
+
+func (u *LoginThrottleUsecase) Status(ctx context.Context, email string) (*entity.LoginThrottle, error) {
+	return u.repo.Find(ctx, emailSubject(email))
+}
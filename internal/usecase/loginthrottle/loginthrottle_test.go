@@ -0,0 +1,81 @@
+package loginthrottle_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	loginThrottleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/loginthrottle"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+)
+
+func setup() (*loginThrottleUsecase.LoginThrottleUsecase, *repotest.LoginThrottleRepo) {
+	repo := repotest.NewLoginThrottleRepo()
+	u := loginThrottleUsecase.NewLoginThrottleUsecase(repo, &config.Config{
+		LoginMaxFailures:     5,
+		LoginDelayAfter:      3,
+		LoginMaxDelay:        30,
+		LoginFailureWindow:   900,
+		LoginLockoutDuration: 900,
+		LoginIPMaxFailures:   8,
+	})
+	return u, repo
+}
+
+func TestProgressiveDelayAndLockout(t *testing.T) {
+	ctx := context.Background()
+	u, repo := setup()
+
+	for i := 0; i < 2; i++ {
+		u.RecordFailure(ctx, "User@Example.com", "10.0.0.1")
+	}
+	if _, err := u.Check(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("expected no delay below the threshold, got %v", err)
+	}
+
+	u.RecordFailure(ctx, "user@example.com", "10.0.0.1")
+	retryAfter, err := u.Check(ctx, "user@example.com", "10.0.0.1")
+	if !errors.Is(err, apperror.ErrTooManyAttempts) || retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("third failure: expected a 1s delay, got %v %v", retryAfter, err)
+	}
+	u.RecordFailure(ctx, "user@example.com", "10.0.0.1")
+	if retryAfter, _ := u.Check(ctx, "user@example.com", "10.0.0.1"); retryAfter <= time.Second || retryAfter > 2*time.Second {
+		t.Errorf("fourth failure: expected the delay to double, got %v", retryAfter)
+	}
+
+	u.RecordFailure(ctx, "user@example.com", "10.0.0.1")
+	retryAfter, err = u.Check(ctx, "user@example.com", "10.0.0.2")
+	if !errors.Is(err, apperror.ErrAccountLocked) || retryAfter < 14*time.Minute {
+		t.Errorf("fifth failure: expected a lock, got %v %v", retryAfter, err)
+	}
+
+	status, _ := u.Status(ctx, "user@example.com")
+	if status.Failures != 5 {
+		t.Errorf("expected 5 failures, got %d", status.Failures)
+	}
+	u.Reset(ctx, "user@example.com")
+	if _, err := u.Check(ctx, "user@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("expected the lock to be cleared, got %v", err)
+	}
+	if throttle, _ := repo.Find(ctx, "ip:10.0.0.1"); throttle.Failures != 5 {
+		t.Errorf("expected the IP counter to survive a reset")
+	}
+}
+
+func TestIPThrottle(t *testing.T) {
+	ctx := context.Background()
+	u, _ := setup()
+
+	for i := 0; i < 8; i++ {
+		u.RecordFailure(ctx, "victim"+string(rune('a'+i))+"@example.com", "10.0.0.9")
+	}
+	if _, err := u.Check(ctx, "fresh@example.com", "10.0.0.9"); !errors.Is(err, apperror.ErrTooManyAttempts) {
+		t.Errorf("expected the IP to be throttled, got %v", err)
+	}
+	if _, err := u.Check(ctx, "fresh@example.com", "10.0.0.10"); err != nil {
+		t.Errorf("expected other IPs to be unaffected, got %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package mfa
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/securetoken"
+	"github.com/KimNattanan/go-user-service/pkg/totp"
+)
+
+const (
+	recoveryCodeCount    = 10
+	maxChallengeAttempts = 5
+	totpSkew             = 1
+)
+
+type MFAUsecase struct {
+	userRepo         repo.UserRepo
+	recoveryCodeRepo repo.RecoveryCodeRepo
+	tokenRepo        repo.OneTimeTokenRepo
+	issuer           string
+	challengeTTL     time.Duration
+}
+
+func NewMFAUsecase(userRepo repo.UserRepo, recoveryCodeRepo repo.RecoveryCodeRepo, tokenRepo repo.OneTimeTokenRepo, cfg *config.Config) *MFAUsecase {
+	return &MFAUsecase{
+		userRepo:         userRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		tokenRepo:        tokenRepo,
+		issuer:           cfg.MFAIssuer,
+		challengeTTL:     time.Duration(cfg.MFAChallengeTTL) * time.Second,
+	}
+}
+
+// EnrollTOTP stores a new pending secret and returns it with its otpauth URI.
+// The secret only becomes active once ConfirmTOTP sees a valid code.
+func (u *MFAUsecase) EnrollTOTP(ctx context.Context, userID string) (string, string, error) {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled {
+		return "", "", apperror.ErrAlreadyExists
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := u.userRepo.Update(ctx, user.ID, map[string]interface{}{
+		"totp_secret":         secret,
+		"totp_last_used_step": 0,
+	}); err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(u.issuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP activates the pending secret and returns a fresh set of recovery codes.
+func (u *MFAUsecase) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, apperror.ErrAlreadyExists
+	}
+	if user.TOTPSecret == "" {
+		return nil, apperror.ErrInvalidData
+	}
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, apperror.ErrInvalidCode
+	}
+	if _, err := u.userRepo.Update(ctx, user.ID, map[string]interface{}{
+		"totp_enabled":        true,
+		"totp_last_used_step": step,
+	}); err != nil {
+		return nil, err
+	}
+	return u.generateRecoveryCodes(ctx, user.ID)
+}
+
+// DisableTOTP turns off the second factor after checking a TOTP or recovery code.
+func (u *MFAUsecase) DisableTOTP(ctx context.Context, userID, code string) error {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return apperror.ErrInvalidData
+	}
+	if err := u.verifyCode(ctx, user, code); err != nil {
+		return err
+	}
+	if _, err := u.userRepo.Update(ctx, user.ID, map[string]interface{}{
+		"totp_secret":         "",
+		"totp_enabled":        false,
+		"totp_last_used_step": 0,
+	}); err != nil {
+		return err
+	}
+	return u.recoveryCodeRepo.DeleteByUserID(ctx, user.ID)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user.
+func (u *MFAUsecase) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, apperror.ErrInvalidData
+	}
+	if err := u.verifyCode(ctx, user, code); err != nil {
+		return nil, err
+	}
+	return u.generateRecoveryCodes(ctx, user.ID)
+}
+
+// CreateChallenge returns a short-lived token that stands in for the session
+// until the second factor is verified. Data from the first factor that the
+// session needs later (e.g. the provider refresh token) rides along with it.
+func (u *MFAUsecase) CreateChallenge(ctx context.Context, user *entity.User, provider, providerRefreshToken string) (string, error) {
+	rawToken, err := securetoken.Generate(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token := &entity.OneTimeToken{
+		Hash:    securetoken.Hash(rawToken),
+		Purpose: entity.TokenPurposeMFAChallenge,
+		UserID:  user.ID,
+		Email:   user.Email,
+		Data: map[string]string{
+			"provider":               provider,
+			"provider_refresh_token": providerRefreshToken,
+		},
+		CreatedAt: now,
+		ExpiresAt: now.Add(u.challengeTTL),
+	}
+	if err := u.tokenRepo.Create(ctx, token); err != nil {
+		return "", err
+	}
+	return rawToken, nil
+}
+
+// FindChallenge returns a pending challenge without using it, so the caller
+// can throttle by the address that signed in.
+func (u *MFAUsecase) FindChallenge(ctx context.Context, challengeToken string) (*entity.OneTimeToken, error) {
+	token, err := u.tokenRepo.Find(ctx, entity.TokenPurposeMFAChallenge, securetoken.Hash(challengeToken))
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidToken
+	}
+	return token, err
+}
+
+// VerifyChallenge checks the second factor for a challenge and, on success,
+// consumes it and returns the user with the provider data it carried.
+// The challenge is burned after too many wrong codes.
+func (u *MFAUsecase) VerifyChallenge(ctx context.Context, challengeToken, code string) (*entity.User, string, string, error) {
+	hash := securetoken.Hash(challengeToken)
+	token, err := u.FindChallenge(ctx, challengeToken)
+	if err != nil {
+		return nil, "", "", err
+	}
+	user, err := u.userRepo.FindByID(ctx, token.UserID)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	if err := u.verifyCode(ctx, user, code); err != nil {
+		attempts, incrErr := u.tokenRepo.IncrementAttempts(ctx, token)
+		if incrErr == nil && attempts >= maxChallengeAttempts {
+			u.tokenRepo.Consume(ctx, entity.TokenPurposeMFAChallenge, hash)
+		}
+		return nil, "", "", err
+	}
+	if _, err := u.tokenRepo.Consume(ctx, entity.TokenPurposeMFAChallenge, hash); err != nil {
+		return nil, "", "", apperror.ErrInvalidToken
+	}
+	return user, token.Data["provider"], token.Data["provider_refresh_token"], nil
+}
+
+// verifyCode accepts either a current TOTP code or an unused recovery code.
+// TOTP codes are rejected if their time step was already used.
+func (u *MFAUsecase) verifyCode(ctx context.Context, user *entity.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew)
+		if !ok || step <= user.TOTPLastUsedStep {
+			return apperror.ErrInvalidCode
+		}
+		_, err := u.userRepo.Update(ctx, user.ID, map[string]interface{}{
+			"totp_last_used_step": step,
+		})
+		return err
+	}
+
+	err := u.recoveryCodeRepo.Use(ctx, user.ID, securetoken.Hash(normalizeRecoveryCode(code)))
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return apperror.ErrInvalidCode
+	}
+	return err
+}
+
+func (u *MFAUsecase) generateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]*entity.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := base32.StdEncoding.EncodeToString(b)[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		records[i] = &entity.RecoveryCode{
+			UserID:   userID,
+			CodeHash: securetoken.Hash(raw),
+		}
+	}
+	if err := u.recoveryCodeRepo.Replace(ctx, userID, records); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
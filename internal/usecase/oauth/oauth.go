@@ -0,0 +1,447 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/securetoken"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+	"github.com/google/uuid"
+)
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeRefreshToken      = "refresh_token"
+	responseTypeCode           = "code"
+	codeChallengeMethodS256    = "S256"
+
+	// authorizationCodeTTL is how long a client has to redeem a code.
+	authorizationCodeTTL = time.Minute
+	// consentRequestTTL is how long the user may take on the consent screen.
+	consentRequestTTL = 10 * time.Minute
+	idTokenDuration   = time.Hour
+
+	clientSecretBytes = 32
+	codeBytes         = 32
+)
+
+type OAuthUsecase struct {
+	clientRepo     repo.OAuthClientRepo
+	consentRepo    repo.OAuthConsentRepo
+	tokenRepo      repo.OneTimeTokenRepo
+	userRepo       repo.UserRepo
+	sessionUsecase usecase.SessionUsecase
+	jwtMaker       *token.JWTMaker
+}
+
+func NewOAuthUsecase(clientRepo repo.OAuthClientRepo, consentRepo repo.OAuthConsentRepo, tokenRepo repo.OneTimeTokenRepo, userRepo repo.UserRepo, sessionUsecase usecase.SessionUsecase, jwtMaker *token.JWTMaker) *OAuthUsecase {
+	return &OAuthUsecase{
+		clientRepo:     clientRepo,
+		consentRepo:    consentRepo,
+		tokenRepo:      tokenRepo,
+		userRepo:       userRepo,
+		sessionUsecase: sessionUsecase,
+		jwtMaker:       jwtMaker,
+	}
+}
+
+// CreateClient registers a client. Confidential clients get a secret, which
+// is returned once and only stored hashed; public clients get none.
+func (u *OAuthUsecase) CreateClient(ctx context.Context, client *entity.OAuthClient, confidential bool) (string, error) {
+	if len(client.RedirectURIs) == 0 {
+		return "", apperror.ErrInvalidRedirect
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		if !validRedirectURI(redirectURI) {
+			return "", apperror.ErrInvalidRedirect
+		}
+	}
+	if len(client.Scopes) == 0 {
+		client.Scopes = slices.Clone(entity.SupportedScopes)
+	}
+	for _, scope := range client.Scopes {
+		if !slices.Contains(entity.SupportedScopes, scope) {
+			return "", apperror.ErrInvalidScope
+		}
+	}
+
+	secret := ""
+	client.SecretHash = ""
+	if confidential {
+		var err error
+		if secret, err = securetoken.Generate(clientSecretBytes); err != nil {
+			return "", err
+		}
+		client.SecretHash = securetoken.Hash(secret)
+	}
+	if err := u.clientRepo.Create(ctx, client); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// validRedirectURI accepts absolute URLs without a fragment, as RFC 6749
+// requires. Custom schemes are allowed for native apps.
+func validRedirectURI(redirectURI string) bool {
+	parsed, err := url.Parse(redirectURI)
+	return err == nil && parsed.Scheme != "" && (parsed.Host != "" || parsed.Opaque != "" || parsed.Path != "") && parsed.Fragment == ""
+}
+
+func (u *OAuthUsecase) FindClients(ctx context.Context) ([]*entity.OAuthClient, error) {
+	return u.clientRepo.FindAll(ctx)
+}
+
+// DeleteClient removes a client and its consents. Its refresh tokens can no
+// longer be redeemed; access tokens already issued run out within the hour.
+func (u *OAuthUsecase) DeleteClient(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return apperror.ErrRecordNotFound
+	}
+	return u.clientRepo.Delete(ctx, id)
+}
+
+// ValidateClient checks the client and redirect URI of an authorization
+// request. Until they are known to be valid, errors must not be redirected.
+// An omitted redirect URI defaults to the client's only one.
+func (u *OAuthUsecase) ValidateClient(ctx context.Context, req *entity.AuthorizationRequest) (*entity.OAuthClient, error) {
+	client, err := u.findClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if req.RedirectURI == "" && len(client.RedirectURIs) == 1 {
+		req.RedirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, apperror.ErrInvalidRedirect
+	}
+	return client, nil
+}
+
+func (u *OAuthUsecase) findClient(ctx context.Context, id string) (*entity.OAuthClient, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, apperror.ErrInvalidClient
+	}
+	client, err := u.clientRepo.FindByID(ctx, id)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Authorize handles an authorization request of a signed-in user for a client
+// returned by ValidateClient. It returns an authorization code, or the ID of
+// a consent request when the user has not yet allowed the client the
+// requested scopes. First-party clients never ask for consent.
+func (u *OAuthUsecase) Authorize(ctx context.Context, userID string, client *entity.OAuthClient, req *entity.AuthorizationRequest) (string, string, error) {
+	if req.ResponseType != responseTypeCode {
+		return "", "", apperror.ErrUnsupportedResponseType
+	}
+	// PKCE is required of every client, confidential ones included.
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != codeChallengeMethodS256 {
+		return "", "", apperror.ErrInvalidData
+	}
+	scopes := req.Scopes()
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return "", "", apperror.ErrInvalidScope
+		}
+	}
+	req.Scope = strings.Join(scopes, " ")
+
+	if !client.FirstParty {
+		consent, err := u.consentRepo.Find(ctx, userID, client.ID)
+		if err != nil && !errors.Is(err, apperror.ErrRecordNotFound) {
+			return "", "", err
+		}
+		if consent == nil || !consent.Covers(scopes) {
+			consentID, err := u.storeRequest(ctx, entity.TokenPurposeOAuthConsent, userID, req, consentRequestTTL)
+			if err != nil {
+				return "", "", err
+			}
+			return "", consentID, nil
+		}
+	}
+
+	code, err := u.storeRequest(ctx, entity.TokenPurposeOAuthCode, userID, req, authorizationCodeTTL)
+	if err != nil {
+		return "", "", err
+	}
+	return code, "", nil
+}
+
+// storeRequest keeps the authorization request under a random ID: the
+// authorization code, or the consent request ID. The token has no UserID,
+// so a user can authorize several clients at once.
+func (u *OAuthUsecase) storeRequest(ctx context.Context, purpose, userID string, req *entity.AuthorizationRequest, ttl time.Duration) (string, error) {
+	id, err := securetoken.Generate(codeBytes)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := u.tokenRepo.Create(ctx, &entity.OneTimeToken{
+		Hash:    securetoken.Hash(id),
+		Purpose: purpose,
+		Data: map[string]string{
+			"user_id":        userID,
+			"client_id":      req.ClientID,
+			"redirect_uri":   req.RedirectURI,
+			"scope":          req.Scope,
+			"state":          req.State,
+			"nonce":          req.Nonce,
+			"code_challenge": req.CodeChallenge,
+		},
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func requestFromToken(stored *entity.OneTimeToken) *entity.AuthorizationRequest {
+	return &entity.AuthorizationRequest{
+		ClientID:            stored.Data["client_id"],
+		RedirectURI:         stored.Data["redirect_uri"],
+		ResponseType:        responseTypeCode,
+		Scope:               stored.Data["scope"],
+		State:               stored.Data["state"],
+		Nonce:               stored.Data["nonce"],
+		CodeChallenge:       stored.Data["code_challenge"],
+		CodeChallengeMethod: codeChallengeMethodS256,
+	}
+}
+
+// FindConsentRequest returns what the consent screen shows. Other users'
+// requests are reported as not found.
+func (u *OAuthUsecase) FindConsentRequest(ctx context.Context, userID, id string) (*entity.ConsentRequest, error) {
+	stored, err := u.tokenRepo.Find(ctx, entity.TokenPurposeOAuthConsent, securetoken.Hash(id))
+	if err != nil {
+		return nil, err
+	}
+	if stored.Data["user_id"] != userID {
+		return nil, apperror.ErrRecordNotFound
+	}
+	req := requestFromToken(stored)
+	client, err := u.findClient(ctx, req.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.ConsentRequest{ID: id, Client: client, Scopes: req.Scopes()}, nil
+}
+
+// DecideConsent records the user's answer to a consent request and returns
+// the authorization request with, if the user allowed it, its code.
+func (u *OAuthUsecase) DecideConsent(ctx context.Context, userID, id string, allow bool) (*entity.AuthorizationRequest, string, error) {
+	if _, err := u.FindConsentRequest(ctx, userID, id); err != nil {
+		return nil, "", err
+	}
+	stored, err := u.tokenRepo.Consume(ctx, entity.TokenPurposeOAuthConsent, securetoken.Hash(id))
+	if err != nil {
+		return nil, "", err
+	}
+	req := requestFromToken(stored)
+	if !allow {
+		return req, "", nil
+	}
+
+	scopes := req.Scopes()
+	consent, err := u.consentRepo.Find(ctx, userID, req.ClientID)
+	if err != nil && !errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, "", err
+	}
+	if consent != nil {
+		for _, scope := range consent.Scopes {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	if err := u.consentRepo.Save(ctx, &entity.OAuthConsent{UserID: userID, ClientID: req.ClientID, Scopes: scopes}); err != nil {
+		return nil, "", err
+	}
+
+	code, err := u.storeRequest(ctx, entity.TokenPurposeOAuthCode, userID, req, authorizationCodeTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	return req, code, nil
+}
+
+// Exchange handles a token request: it redeems an authorization code or a
+// refresh token of the authenticated client.
+func (u *OAuthUsecase) Exchange(ctx context.Context, req *entity.TokenRequest) (*entity.OAuthTokens, error) {
+	client, err := u.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	switch req.GrantType {
+	case grantTypeAuthorizationCode:
+		return u.exchangeCode(ctx, client, req)
+	case grantTypeRefreshToken:
+		return u.exchangeRefreshToken(ctx, client, req)
+	}
+	return nil, apperror.ErrUnsupportedGrantType
+}
+
+// authenticateClient checks a confidential client's secret. Public clients
+// have none and rely on PKCE.
+func (u *OAuthUsecase) authenticateClient(ctx context.Context, clientID, clientSecret string) (*entity.OAuthClient, error) {
+	client, err := u.findClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Public() {
+		if clientSecret != "" {
+			return nil, apperror.ErrInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(securetoken.Hash(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, apperror.ErrInvalidClient
+	}
+	return client, nil
+}
+
+func (u *OAuthUsecase) exchangeCode(ctx context.Context, client *entity.OAuthClient, req *entity.TokenRequest) (*entity.OAuthTokens, error) {
+	hash := securetoken.Hash(req.Code)
+	stored, err := u.tokenRepo.Find(ctx, entity.TokenPurposeOAuthCode, hash)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	authorization := requestFromToken(stored)
+	if authorization.ClientID != client.ID {
+		return nil, apperror.ErrInvalidGrant
+	}
+	// RFC 6749 section 4.1.3: the redirect URI of the authorization has to be
+	// repeated, even when the client left it out there and only has one.
+	if authorization.RedirectURI != "" && req.RedirectURI != authorization.RedirectURI {
+		return nil, apperror.ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(req.CodeVerifier, authorization.CodeChallenge) {
+		return nil, apperror.ErrInvalidGrant
+	}
+	// Only consume the code once the request is known to come from the
+	// client it was issued to, so another client cannot burn it.
+	stored, err = u.tokenRepo.Consume(ctx, entity.TokenPurposeOAuthCode, hash)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := u.userRepo.FindByID(ctx, stored.Data["user_id"])
+	if err != nil {
+		return nil, apperror.ErrInvalidGrant
+	}
+
+	tokens, err := u.sessionUsecase.StartForClient(ctx, user.ID, client.ID, authorization.Scope, req.UserAgent, req.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+	return u.withIDToken(user, client, tokens, authorization.Scope, authorization.Nonce)
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against its S256
+// challenge (RFC 7636).
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func (u *OAuthUsecase) exchangeRefreshToken(ctx context.Context, client *entity.OAuthClient, req *entity.TokenRequest) (*entity.OAuthTokens, error) {
+	session, tokens, err := u.sessionUsecase.Refresh(ctx, req.RefreshToken, client.ID, req.UserAgent, req.IPAddress)
+	if errors.Is(err, apperror.ErrUnauthorized) || errors.Is(err, apperror.ErrSessionReused) {
+		return nil, apperror.ErrInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := u.userRepo.FindByID(ctx, session.UserID)
+	if err != nil {
+		return nil, apperror.ErrInvalidGrant
+	}
+	return u.withIDToken(user, client, tokens, session.Scope, "")
+}
+
+// withIDToken adds an ID token when the openid scope was granted.
+func (u *OAuthUsecase) withIDToken(user *entity.User, client *entity.OAuthClient, tokens *entity.TokenPair, scope, nonce string) (*entity.OAuthTokens, error) {
+	result := &entity.OAuthTokens{TokenPair: tokens, Scope: scope}
+	scopes := strings.Fields(scope)
+	if !slices.Contains(scopes, entity.ScopeOpenID) {
+		return result, nil
+	}
+	info := userInfo(user, scopes)
+	idToken, err := u.jwtMaker.CreateIDToken(user.ID, client.ID, idTokenDuration, &token.IDTokenClaims{
+		Nonce:         nonce,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Name:          info.Name,
+		GivenName:     info.GivenName,
+		FamilyName:    info.FamilyName,
+		Picture:       info.Picture,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.IDToken = idToken
+	return result, nil
+}
+
+// UserInfo returns the claims an access token's scopes reveal about its
+// user. Only tokens issued to a client with the openid scope qualify.
+func (u *OAuthUsecase) UserInfo(ctx context.Context, accessToken string) (*entity.UserInfo, error) {
+	introspection, err := u.sessionUsecase.Introspect(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	scopes := strings.Fields(introspection.Scope)
+	if !introspection.Active || introspection.TokenType != entity.TokenTypeAccess || introspection.ClientID == "" ||
+		!slices.Contains(scopes, entity.ScopeOpenID) {
+		return nil, apperror.ErrUnauthorized
+	}
+	user, err := u.userRepo.FindByID(ctx, introspection.Subject)
+	if err != nil {
+		return nil, apperror.ErrUnauthorized
+	}
+	return userInfo(user, scopes), nil
+}
+
+func userInfo(user *entity.User, scopes []string) *entity.UserInfo {
+	info := &entity.UserInfo{Subject: user.ID}
+	if slices.Contains(scopes, entity.ScopeEmail) {
+		emailVerified := user.EmailVerified
+		info.Email = user.Email
+		info.EmailVerified = &emailVerified
+	}
+	if slices.Contains(scopes, entity.ScopeProfile) {
+		info.Name = user.Name
+		info.GivenName = user.FirstName
+		info.FamilyName = user.LastName
+		info.Picture = user.PictureURL
+	}
+	return info
+}
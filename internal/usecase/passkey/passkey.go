@@ -0,0 +1,252 @@
+package passkey
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/securetoken"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+type PasskeyUsecase struct {
+	userRepo     repo.UserRepo
+	passkeyRepo  repo.PasskeyRepo
+	tokenRepo    repo.OneTimeTokenRepo
+	webAuthn     *webauthn.WebAuthn
+	challengeTTL time.Duration
+}
+
+func NewPasskeyUsecase(userRepo repo.UserRepo, passkeyRepo repo.PasskeyRepo, tokenRepo repo.OneTimeTokenRepo, cfg *config.Config) (*PasskeyUsecase, error) {
+	challengeTTL := time.Duration(cfg.WebAuthnChallengeTTL) * time.Second
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnRPOrigins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: challengeTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: challengeTTL},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &PasskeyUsecase{
+		userRepo:     userRepo,
+		passkeyRepo:  passkeyRepo,
+		tokenRepo:    tokenRepo,
+		webAuthn:     webAuthn,
+		challengeTTL: challengeTTL,
+	}, nil
+}
+
+// webAuthnUser adapts a user and their stored credentials to webauthn.User.
+type webAuthnUser struct {
+	user        *entity.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte                         { return []byte(u.user.ID) }
+func (u *webAuthnUser) WebAuthnName() string                       { return u.user.Email }
+func (u *webAuthnUser) WebAuthnDisplayName() string                { return u.user.Name }
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// BeginRegistration starts a registration ceremony for the user. The returned
+// ceremony ID must be sent back with the authenticator response.
+func (u *PasskeyUsecase) BeginRegistration(ctx context.Context, userID string) (string, *protocol.CredentialCreation, error) {
+	user, _, err := u.loadUser(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	creation, session, err := u.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	ceremonyID, err := u.saveCeremony(ctx, entity.TokenPurposePasskeyRegister, userID, session)
+	if err != nil {
+		return "", nil, err
+	}
+	return ceremonyID, creation, nil
+}
+
+func (u *PasskeyUsecase) FinishRegistration(ctx context.Context, userID, ceremonyID, name string, response []byte) (*entity.PasskeyCredential, error) {
+	session, err := u.takeCeremony(ctx, entity.TokenPurposePasskeyRegister, ceremonyID, userID)
+	if err != nil {
+		return nil, err
+	}
+	user, _, err := u.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, apperror.ErrInvalidData
+	}
+	credential, err := u.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, apperror.ErrInvalidData
+	}
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = "Passkey"
+	}
+	record := &entity.PasskeyCredential{
+		UserID:       userID,
+		Name:         name,
+		CredentialID: credential.ID,
+		Credential:   data,
+	}
+	if err := u.passkeyRepo.Create(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (u *PasskeyUsecase) FindByUserID(ctx context.Context, userID string) ([]*entity.PasskeyCredential, error) {
+	return u.passkeyRepo.FindByUserID(ctx, userID)
+}
+
+func (u *PasskeyUsecase) Rename(ctx context.Context, userID, id, name string) (*entity.PasskeyCredential, error) {
+	return u.passkeyRepo.Update(ctx, userID, id, map[string]interface{}{"name": name})
+}
+
+func (u *PasskeyUsecase) Delete(ctx context.Context, userID, id string) error {
+	return u.passkeyRepo.Delete(ctx, userID, id)
+}
+
+// BeginLogin starts a discoverable-credential login, so no user is needed up front.
+func (u *PasskeyUsecase) BeginLogin(ctx context.Context) (string, *protocol.CredentialAssertion, error) {
+	assertion, session, err := u.webAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		return "", nil, err
+	}
+	ceremonyID, err := u.saveCeremony(ctx, entity.TokenPurposePasskeyLogin, "", session)
+	if err != nil {
+		return "", nil, err
+	}
+	return ceremonyID, assertion, nil
+}
+
+// FinishLogin verifies the assertion and returns the user that owns the credential.
+func (u *PasskeyUsecase) FinishLogin(ctx context.Context, ceremonyID string, response []byte) (*entity.User, error) {
+	session, err := u.takeCeremony(ctx, entity.TokenPurposePasskeyLogin, ceremonyID, "")
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, apperror.ErrInvalidData
+	}
+
+	var owner *webAuthnUser
+	var record *entity.PasskeyCredential
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		record, err = u.passkeyRepo.FindByCredentialID(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal([]byte(record.UserID), userHandle) {
+			return nil, apperror.ErrUnauthorized
+		}
+		owner, _, err = u.loadUser(ctx, record.UserID)
+		return owner, err
+	}
+	credential, err := u.webAuthn.ValidateDiscoverableLogin(handler, *session, parsed)
+	if err != nil {
+		return nil, apperror.ErrUnauthorized
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, apperror.ErrUnauthorized
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := u.passkeyRepo.Update(ctx, record.UserID, record.ID, map[string]interface{}{
+		"credential":   data,
+		"last_used_at": time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	return owner.user, nil
+}
+
+func (u *PasskeyUsecase) loadUser(ctx context.Context, userID string) (*webAuthnUser, []*entity.PasskeyCredential, error) {
+	user, err := u.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := u.passkeyRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	credentials := make([]webauthn.Credential, 0, len(records))
+	for _, record := range records {
+		var credential webauthn.Credential
+		if err := json.Unmarshal(record.Credential, &credential); err != nil {
+			return nil, nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+	return &webAuthnUser{user: user, credentials: credentials}, records, nil
+}
+
+// saveCeremony keeps the WebAuthn session data in Redis until the ceremony finishes.
+func (u *PasskeyUsecase) saveCeremony(ctx context.Context, purpose, userID string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	ceremonyID, err := securetoken.Generate(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token := &entity.OneTimeToken{
+		Hash:      securetoken.Hash(ceremonyID),
+		Purpose:   purpose,
+		UserID:    userID,
+		Data:      map[string]string{"session": string(data)},
+		CreatedAt: now,
+		ExpiresAt: now.Add(u.challengeTTL),
+	}
+	if err := u.tokenRepo.Create(ctx, token); err != nil {
+		return "", err
+	}
+	return ceremonyID, nil
+}
+
+func (u *PasskeyUsecase) takeCeremony(ctx context.Context, purpose, ceremonyID, userID string) (*webauthn.SessionData, error) {
+	token, err := u.tokenRepo.Consume(ctx, purpose, securetoken.Hash(ceremonyID))
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.UserID != userID {
+		return nil, apperror.ErrInvalidToken
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(token.Data["session"]), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,190 @@
+package passkey_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	"github.com/KimNattanan/go-user-service/internal/usecase/passkey"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/google/uuid"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// softAuthenticator is a minimal platform authenticator holding one ES256
+// credential and producing "none" attestations.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+func (a *softAuthenticator) authData(flags byte, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		publicKey, _ := webauthncbor.Marshal(&webauthncose.EC2PublicKeyData{
+			PublicKeyData: webauthncose.PublicKeyData{
+				KeyType:   int64(webauthncose.EllipticKey),
+				Algorithm: int64(webauthncose.AlgES256),
+			},
+			Curve:  1, // P-256
+			XCoord: a.key.X.FillBytes(make([]byte, 32)),
+			YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+		})
+		data = append(data, make([]byte, 16)...) // zero AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, publicKey...)
+	}
+	return data
+}
+
+func clientData(t *testing.T, ceremony, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func (a *softAuthenticator) create(t *testing.T, challenge string) []byte {
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(0x45, true), // UP | UV | AT
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.response(t, map[string]string{
+		"clientDataJSON":    b64(clientData(t, "webauthn.create", challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+func (a *softAuthenticator) get(t *testing.T, challenge, userID string) []byte {
+	a.signCount++
+	authData := a.authData(0x05, false) // UP | UV
+	clientDataJSON := clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.response(t, map[string]string{
+		"clientDataJSON":    b64(clientDataJSON),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64([]byte(userID)),
+	})
+}
+
+func (a *softAuthenticator) response(t *testing.T, response map[string]string) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.New().String(), Email: "test@gmail.com", Name: "user name"}
+	passkeyRepo := repotest.NewPasskeyRepo()
+	u, err := passkey.NewPasskeyUsecase(
+		repotest.NewUserRepo(user),
+		passkeyRepo,
+		repotest.NewOneTimeTokenRepo(),
+		&config.Config{
+			WebAuthnRPID:         testRPID,
+			WebAuthnRPName:       "Test",
+			WebAuthnRPOrigins:    []string{testOrigin},
+			WebAuthnChallengeTTL: 300,
+		},
+	)
+	if err != nil {
+		t.Fatalf("NewPasskeyUsecase: %v", err)
+	}
+	authenticator := newSoftAuthenticator(t)
+
+	ceremonyID, creation, err := u.BeginRegistration(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	registered, err := u.FinishRegistration(ctx, user.ID, ceremonyID, "laptop", authenticator.create(t, creation.Response.Challenge.String()))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if registered.Name != "laptop" || registered.UserID != user.ID {
+		t.Errorf("unexpected credential %+v", registered)
+	}
+	if _, err := u.FinishRegistration(ctx, user.ID, ceremonyID, "laptop", authenticator.create(t, creation.Response.Challenge.String())); !errors.Is(err, apperror.ErrInvalidToken) {
+		t.Errorf("reused registration ceremony: expected %v, got %v", apperror.ErrInvalidToken, err)
+	}
+
+	ceremonyID, assertion, err := u.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	loggedIn, err := u.FinishLogin(ctx, ceremonyID, authenticator.get(t, assertion.Response.Challenge.String(), user.ID))
+	if err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if loggedIn.ID != user.ID {
+		t.Errorf("expected user %s, got %s", user.ID, loggedIn.ID)
+	}
+	if registered.LastUsedAt == nil {
+		t.Error("expected last_used_at to be set")
+	}
+
+	ceremonyID, _, err = u.BeginLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	if _, err := u.FinishLogin(ctx, ceremonyID, authenticator.get(t, "wrong-challenge", user.ID)); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("wrong challenge: expected %v, got %v", apperror.ErrUnauthorized, err)
+	}
+}
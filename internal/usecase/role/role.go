@@ -0,0 +1,157 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/google/uuid"
+)
+
+type RoleUsecase struct {
+	repo                repo.RoleRepo
+	userRepo            repo.UserRepo
+	bootstrapAdminEmail string
+}
+
+func NewRoleUsecase(repo repo.RoleRepo, userRepo repo.UserRepo, cfg *config.Config) *RoleUsecase {
+	return &RoleUsecase{
+		repo:                repo,
+		userRepo:            userRepo,
+		bootstrapAdminEmail: strings.TrimSpace(cfg.BootstrapAdminEmail),
+	}
+}
+
+// Seed creates the built-in admin role, or brings its permissions up to
+// date with entity.Permissions.
+func (u *RoleUsecase) Seed(ctx context.Context) error {
+	return u.repo.Save(ctx, &entity.Role{
+		Name:        entity.RoleAdmin,
+		Description: "Full access to the admin API",
+		Permissions: entity.Permissions,
+	})
+}
+
+func (u *RoleUsecase) FindAll(ctx context.Context) ([]*entity.Role, error) {
+	return u.repo.FindAll(ctx)
+}
+
+// Save creates or replaces a custom role.
+func (u *RoleUsecase) Save(ctx context.Context, role *entity.Role) error {
+	if role.Name == entity.RoleAdmin {
+		return apperror.ErrBuiltInRole
+	}
+	for _, permission := range role.Permissions {
+		if !slices.Contains(entity.Permissions, permission) {
+			return apperror.ErrInvalidPermission
+		}
+	}
+	role.Permissions = slices.Compact(slices.Sorted(slices.Values(role.Permissions)))
+	return u.repo.Save(ctx, role)
+}
+
+func (u *RoleUsecase) Delete(ctx context.Context, name string) error {
+	if name == entity.RoleAdmin {
+		return apperror.ErrBuiltInRole
+	}
+	return u.repo.Delete(ctx, name)
+}
+
+func (u *RoleUsecase) FindByUserID(ctx context.Context, userID string) ([]*entity.Role, error) {
+	if _, err := u.findUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return u.repo.FindByUserID(ctx, userID)
+}
+
+// Assign gives the user the role. It takes effect when their access token
+// is next refreshed.
+func (u *RoleUsecase) Assign(ctx context.Context, userID, name string) error {
+	if _, err := u.findUser(ctx, userID); err != nil {
+		return err
+	}
+	role, err := u.repo.FindByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	return u.repo.Assign(ctx, userID, role.ID)
+}
+
+// Unassign takes the role away from the user. The last admin keeps the
+// admin role, so the admin API cannot be locked out.
+func (u *RoleUsecase) Unassign(ctx context.Context, userID, name string) error {
+	if _, err := u.findUser(ctx, userID); err != nil {
+		return err
+	}
+	role, err := u.repo.FindByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	if role.Name == entity.RoleAdmin {
+		count, err := u.repo.CountUsers(ctx, role.ID)
+		if err != nil {
+			return err
+		}
+		if count <= 1 {
+			return apperror.ErrLastAdmin
+		}
+	}
+	return u.repo.Unassign(ctx, userID, role.ID)
+}
+
+func (u *RoleUsecase) findUser(ctx context.Context, userID string) (*entity.User, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, apperror.ErrRecordNotFound
+	}
+	return u.userRepo.FindByID(ctx, userID)
+}
+
+// Permissions returns the union of the permissions of the user's roles, to
+// be embedded in their access tokens. It also makes the user the first admin
+// when their verified email is BOOTSTRAP_ADMIN_EMAIL and nobody holds the
+// admin role yet.
+func (u *RoleUsecase) Permissions(ctx context.Context, user *entity.User) ([]string, error) {
+	if err := u.bootstrap(ctx, user); err != nil {
+		return nil, err
+	}
+	roles, err := u.repo.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	var permissions []string
+	for _, role := range roles {
+		permissions = append(permissions, role.Permissions...)
+	}
+	return slices.Compact(slices.Sorted(slices.Values(permissions))), nil
+}
+
+func (u *RoleUsecase) bootstrap(ctx context.Context, user *entity.User) error {
+	if u.bootstrapAdminEmail == "" || !user.EmailVerified || !strings.EqualFold(user.Email, u.bootstrapAdminEmail) {
+		return nil
+	}
+	admin, err := u.repo.FindByName(ctx, entity.RoleAdmin)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		if err := u.Seed(ctx); err != nil {
+			return err
+		}
+		admin, err = u.repo.FindByName(ctx, entity.RoleAdmin)
+	}
+	if err != nil {
+		return err
+	}
+	count, err := u.repo.CountUsers(ctx, admin.ID)
+	if err != nil || count > 0 {
+		return err
+	}
+	if err := u.repo.Assign(ctx, user.ID, admin.ID); err != nil {
+		return err
+	}
+	log.Printf("granted the %s role to the bootstrap admin %s", entity.RoleAdmin, user.Email)
+	return nil
+}
@@ -0,0 +1,102 @@
+package role_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	roleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/role"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/google/uuid"
+)
+
+func setup(t *testing.T, users ...*entity.User) *roleUsecase.RoleUsecase {
+	t.Helper()
+	u := roleUsecase.NewRoleUsecase(repotest.NewRoleRepo(), repotest.NewUserRepo(users...), &config.Config{BootstrapAdminEmail: "Owner@example.com"})
+	if err := u.Seed(context.Background()); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	return u
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	unverified := &entity.User{ID: uuid.NewString(), Email: "owner@example.com"}
+	owner := &entity.User{ID: uuid.NewString(), Email: "owner@example.com", EmailVerified: true}
+	other := &entity.User{ID: uuid.NewString(), Email: "other@example.com", EmailVerified: true}
+	u := setup(t, unverified, owner, other)
+
+	if permissions, err := u.Permissions(ctx, unverified); err != nil || len(permissions) != 0 {
+		t.Errorf("expected an unverified email not to be made admin, got %v, %v", permissions, err)
+	}
+	if permissions, err := u.Permissions(ctx, other); err != nil || len(permissions) != 0 {
+		t.Errorf("expected another email not to be made admin, got %v, %v", permissions, err)
+	}
+	permissions, err := u.Permissions(ctx, owner)
+	if err != nil {
+		t.Fatalf("Permissions: %v", err)
+	}
+	if !slices.Equal(permissions, slices.Sorted(slices.Values(entity.Permissions))) {
+		t.Errorf("expected the bootstrap admin to get every permission, got %v", permissions)
+	}
+
+	// Once somebody is admin, the bootstrap email has no further effect.
+	if err := u.Assign(ctx, other.ID, entity.RoleAdmin); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	if err := u.Unassign(ctx, owner.ID, entity.RoleAdmin); err != nil {
+		t.Fatalf("Unassign: %v", err)
+	}
+	if permissions, err := u.Permissions(ctx, owner); err != nil || len(permissions) != 0 {
+		t.Errorf("expected the bootstrap email to stop granting admin, got %v, %v", permissions, err)
+	}
+	if err := u.Unassign(ctx, other.ID, entity.RoleAdmin); !errors.Is(err, apperror.ErrLastAdmin) {
+		t.Errorf("expected %v when removing the last admin, got %v", apperror.ErrLastAdmin, err)
+	}
+}
+
+func TestCustomRoles(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "support@example.com"}
+	u := setup(t, user)
+
+	if err := u.Save(ctx, &entity.Role{Name: entity.RoleAdmin}); !errors.Is(err, apperror.ErrBuiltInRole) {
+		t.Errorf("expected %v when changing the admin role, got %v", apperror.ErrBuiltInRole, err)
+	}
+	if err := u.Delete(ctx, entity.RoleAdmin); !errors.Is(err, apperror.ErrBuiltInRole) {
+		t.Errorf("expected %v when deleting the admin role, got %v", apperror.ErrBuiltInRole, err)
+	}
+	if err := u.Save(ctx, &entity.Role{Name: "support", Permissions: []string{"everything"}}); !errors.Is(err, apperror.ErrInvalidPermission) {
+		t.Errorf("expected %v for an unknown permission, got %v", apperror.ErrInvalidPermission, err)
+	}
+
+	for _, role := range []*entity.Role{
+		{Name: "support", Permissions: []string{entity.PermissionUsersWrite, entity.PermissionUsersRead}},
+		{Name: "auditor", Permissions: []string{entity.PermissionUsersRead}},
+	} {
+		if err := u.Save(ctx, role); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if err := u.Assign(ctx, user.ID, role.Name); err != nil {
+			t.Fatalf("Assign: %v", err)
+		}
+	}
+	if err := u.Assign(ctx, user.ID, "missing"); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for an unknown role, got %v", apperror.ErrRecordNotFound, err)
+	}
+	if err := u.Assign(ctx, uuid.NewString(), "support"); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for an unknown user, got %v", apperror.ErrRecordNotFound, err)
+	}
+
+	permissions, err := u.Permissions(ctx, user)
+	if err != nil {
+		t.Fatalf("Permissions: %v", err)
+	}
+	if want := []string{entity.PermissionUsersRead, entity.PermissionUsersWrite}; !slices.Equal(permissions, want) {
+		t.Errorf("expected %v, got %v", want, permissions)
+	}
+}
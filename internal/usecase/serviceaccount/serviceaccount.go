@@ -0,0 +1,197 @@
+package serviceaccount
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/securetoken"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+	"github.com/google/uuid"
+)
+
+const secretBytes = 32
+
+type ServiceAccountUsecase struct {
+	repo          repo.ServiceAccountRepo
+	jwtMaker      *token.JWTMaker
+	tokenDuration time.Duration
+	secretOverlap time.Duration
+}
+
+func NewServiceAccountUsecase(repo repo.ServiceAccountRepo, jwtMaker *token.JWTMaker, cfg *config.Config) *ServiceAccountUsecase {
+	return &ServiceAccountUsecase{
+		repo:          repo,
+		jwtMaker:      jwtMaker,
+		tokenDuration: time.Duration(cfg.ServiceAccountTokenExpiration) * time.Second,
+		secretOverlap: time.Duration(cfg.ServiceAccountSecretOverlap) * time.Second,
+	}
+}
+
+// Create registers a service account and returns its client secret, which
+// is only stored hashed.
+func (u *ServiceAccountUsecase) Create(ctx context.Context, account *entity.ServiceAccount) (string, error) {
+	if len(account.Scopes) == 0 {
+		return "", apperror.ErrInvalidScope
+	}
+	for _, scope := range account.Scopes {
+		if !slices.Contains(entity.ServiceAccountScopes, scope) {
+			return "", apperror.ErrInvalidScope
+		}
+	}
+	secret, err := securetoken.Generate(secretBytes)
+	if err != nil {
+		return "", err
+	}
+	account.Secrets = []entity.ServiceAccountSecret{{Hash: securetoken.Hash(secret)}}
+	if err := u.repo.Create(ctx, account); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (u *ServiceAccountUsecase) FindAll(ctx context.Context) ([]*entity.ServiceAccount, error) {
+	return u.repo.FindAll(ctx)
+}
+
+func (u *ServiceAccountUsecase) FindByID(ctx context.Context, id string) (*entity.ServiceAccount, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, apperror.ErrRecordNotFound
+	}
+	return u.repo.FindByID(ctx, id)
+}
+
+// Delete removes the account. Its tokens stop working right away, since the
+// auth middleware looks the account up on every request.
+func (u *ServiceAccountUsecase) Delete(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return apperror.ErrRecordNotFound
+	}
+	return u.repo.Delete(ctx, id)
+}
+
+// RotateSecret issues a new secret. The current ones keep working for the
+// overlap, SERVICE_ACCOUNT_SECRET_OVERLAP unless overlap is given; an
+// overlap of 0 retires them at once, for leaked secrets.
+func (u *ServiceAccountUsecase) RotateSecret(ctx context.Context, id string, overlap *time.Duration) (string, error) {
+	account, err := u.FindByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	expireOthersAt := time.Now().Add(u.secretOverlap)
+	if overlap != nil {
+		if *overlap < 0 {
+			return "", apperror.ErrInvalidData
+		}
+		expireOthersAt = time.Now().Add(*overlap)
+	}
+	secret, err := securetoken.Generate(secretBytes)
+	if err != nil {
+		return "", err
+	}
+	if err := u.repo.AddSecret(ctx, &entity.ServiceAccountSecret{
+		ServiceAccountID: account.ID,
+		Hash:             securetoken.Hash(secret),
+	}, expireOthersAt); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// IssueToken handles the client credentials grant. The token carries the
+// requested scopes, or all of the account's when scope is empty.
+func (u *ServiceAccountUsecase) IssueToken(ctx context.Context, clientID, clientSecret, scope string) (*entity.ServiceAccountToken, error) {
+	account, err := u.authenticate(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = account.Scopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(account.Scopes, scope) {
+			return nil, apperror.ErrInvalidScope
+		}
+	}
+	scope = strings.Join(scopes, " ")
+
+	accessToken, claims, err := u.jwtMaker.CreateServiceAccountToken(account.ID, scope, u.tokenDuration)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.ServiceAccountToken{
+		AccessToken: accessToken,
+		ExpiresAt:   claims.ExpiresAt.Time,
+		Scope:       scope,
+	}, nil
+}
+
+func (u *ServiceAccountUsecase) authenticate(ctx context.Context, clientID, clientSecret string) (*entity.ServiceAccount, error) {
+	account, err := u.FindByID(ctx, clientID)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+	if clientSecret == "" {
+		return nil, apperror.ErrInvalidClient
+	}
+	hash := []byte(securetoken.Hash(clientSecret))
+	now := time.Now()
+	for _, secret := range account.Secrets {
+		if secret.Active(now) && subtle.ConstantTimeCompare(hash, []byte(secret.Hash)) == 1 {
+			return account, nil
+		}
+	}
+	return nil, apperror.ErrInvalidClient
+}
+
+// Verify checks that a verified service account token still belongs to an
+// existing account.
+func (u *ServiceAccountUsecase) Verify(ctx context.Context, claims *token.UserClaims) (*entity.ServiceAccount, error) {
+	if claims.PrincipalType != token.PrincipalTypeServiceAccount {
+		return nil, apperror.ErrUnauthorized
+	}
+	account, err := u.FindByID(ctx, claims.ID)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// Introspect reports whether a token is an active service account token.
+func (u *ServiceAccountUsecase) Introspect(ctx context.Context, tokenStr string) (*entity.TokenIntrospection, error) {
+	claims, err := u.jwtMaker.VerfiyToken(tokenStr)
+	if err != nil {
+		return &entity.TokenIntrospection{Active: false}, nil
+	}
+	if _, err := u.Verify(ctx, claims); err != nil {
+		if errors.Is(err, apperror.ErrUnauthorized) {
+			return &entity.TokenIntrospection{Active: false}, nil
+		}
+		return nil, err
+	}
+	return &entity.TokenIntrospection{
+		Active:    true,
+		TokenType: entity.TokenTypeAccess,
+		Subject:   claims.Subject,
+		ClientID:  claims.ClientID,
+		Scope:     claims.Scope,
+		Issuer:    claims.Issuer,
+		TokenID:   claims.RegisteredClaims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
@@ -0,0 +1,125 @@
+package serviceaccount_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	serviceAccountUsecase "github.com/KimNattanan/go-user-service/internal/usecase/serviceaccount"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+	"github.com/google/uuid"
+)
+
+func setup(t *testing.T) (*serviceAccountUsecase.ServiceAccountUsecase, *token.JWTMaker) {
+	t.Helper()
+	cfg := &config.Config{
+		JWTAlgorithm:                  token.AlgorithmEdDSA,
+		JWTExpiration:                 3600,
+		ServiceAccountTokenExpiration: 300,
+		ServiceAccountSecretOverlap:   3600,
+	}
+	keyring, err := token.NewKeyring(cfg)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	jwtMaker := token.NewJWTMaker(keyring, "test")
+	return serviceAccountUsecase.NewServiceAccountUsecase(repotest.NewServiceAccountRepo(), jwtMaker, cfg), jwtMaker
+}
+
+func TestCreateRejectsUnknownScopes(t *testing.T) {
+	u, _ := setup(t)
+	for _, scopes := range [][]string{nil, {"openid"}} {
+		account := &entity.ServiceAccount{Name: "job", Scopes: scopes}
+		if _, err := u.Create(context.Background(), account); !errors.Is(err, apperror.ErrInvalidScope) {
+			t.Errorf("expected %v for scopes %v, got %v", apperror.ErrInvalidScope, scopes, err)
+		}
+	}
+}
+
+func TestIssueToken(t *testing.T) {
+	ctx := context.Background()
+	u, jwtMaker := setup(t)
+	account := &entity.ServiceAccount{Name: "job", Scopes: []string{entity.PermissionClientsManage}}
+	secret, err := u.Create(ctx, account)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	issued, err := u.IssueToken(ctx, account.ID, secret, "")
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	claims, err := jwtMaker.VerfiyToken(issued.AccessToken)
+	if err != nil {
+		t.Fatalf("VerfiyToken: %v", err)
+	}
+	if claims.PrincipalType != token.PrincipalTypeServiceAccount || claims.ID != account.ID || claims.Scope != entity.PermissionClientsManage || claims.SessionID != "" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if lifetime := time.Until(issued.ExpiresAt); lifetime > 5*time.Minute {
+		t.Errorf("expected a short-lived token, got %v", lifetime)
+	}
+	if _, err := u.Verify(ctx, claims); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	if _, err := u.IssueToken(ctx, account.ID, secret, "admin openid"); !errors.Is(err, apperror.ErrInvalidScope) {
+		t.Errorf("expected %v, got %v", apperror.ErrInvalidScope, err)
+	}
+	for _, clientID := range []string{account.ID, uuid.NewString(), "not-a-uuid"} {
+		if _, err := u.IssueToken(ctx, clientID, "wrong", ""); !errors.Is(err, apperror.ErrInvalidClient) {
+			t.Errorf("expected %v for client %q, got %v", apperror.ErrInvalidClient, clientID, err)
+		}
+	}
+}
+
+func TestRotateSecretKeepsTheOldOneDuringTheOverlap(t *testing.T) {
+	ctx := context.Background()
+	u, _ := setup(t)
+	account := &entity.ServiceAccount{Name: "job", Scopes: []string{entity.PermissionClientsManage}}
+	first, err := u.Create(ctx, account)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	second, err := u.RotateSecret(ctx, account.ID, nil)
+	if err != nil {
+		t.Fatalf("RotateSecret: %v", err)
+	}
+	for _, secret := range []string{first, second} {
+		if _, err := u.IssueToken(ctx, account.ID, secret, ""); err != nil {
+			t.Errorf("expected both secrets to work during the overlap: %v", err)
+		}
+	}
+
+	noOverlap := time.Duration(0)
+	third, err := u.RotateSecret(ctx, account.ID, &noOverlap)
+	if err != nil {
+		t.Fatalf("RotateSecret: %v", err)
+	}
+	for _, secret := range []string{first, second} {
+		if _, err := u.IssueToken(ctx, account.ID, secret, ""); !errors.Is(err, apperror.ErrInvalidClient) {
+			t.Errorf("expected a retired secret to be rejected, got %v", err)
+		}
+	}
+	if _, err := u.IssueToken(ctx, account.ID, third, ""); err != nil {
+		t.Errorf("expected the new secret to work: %v", err)
+	}
+}
+
+func TestUserTokensAreNotServiceAccountTokens(t *testing.T) {
+	u, jwtMaker := setup(t)
+	tokenStr, _, err := jwtMaker.CreateAccessToken(uuid.NewString(), "session-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateAccessToken: %v", err)
+	}
+	introspection, err := u.Introspect(context.Background(), tokenStr)
+	if err != nil || introspection.Active {
+		t.Errorf("expected a user token to be inactive, got %+v, %v", introspection, err)
+	}
+}
@@ -2,35 +2,389 @@ package session
 
 import (
 	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
 
 	"github.com/KimNattanan/go-user-service/internal/entity"
 	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+)
+
+const (
+	accessTokenDuration = time.Hour
+	// lastUsedResolution limits how often a session's last use is written back.
+	lastUsedResolution = time.Minute
 )
 
 type SessionUsecase struct {
-	repo repo.SessionRepo
+	repo                  repo.SessionRepo
+	userRepo              repo.UserRepo
+	auditEventRepo        repo.AuditEventRepo
+	roleUsecase           usecase.RoleUsecase
+	jwtMaker              *token.JWTMaker
+	refreshTokenDuration  time.Duration
+	rotationGracePeriod   time.Duration
+	impersonationDuration time.Duration
 }
 
-func NewSessionUsecase(repo repo.SessionRepo) *SessionUsecase {
-	return &SessionUsecase{repo: repo}
+func NewSessionUsecase(repo repo.SessionRepo, userRepo repo.UserRepo, auditEventRepo repo.AuditEventRepo, roleUsecase usecase.RoleUsecase, jwtMaker *token.JWTMaker, cfg *config.Config) *SessionUsecase {
+	return &SessionUsecase{
+		repo:                  repo,
+		userRepo:              userRepo,
+		auditEventRepo:        auditEventRepo,
+		roleUsecase:           roleUsecase,
+		jwtMaker:              jwtMaker,
+		refreshTokenDuration:  time.Duration(cfg.JWTExpiration) * time.Second,
+		rotationGracePeriod:   time.Duration(cfg.SessionRotationGracePeriod) * time.Second,
+		impersonationDuration: time.Duration(cfg.ImpersonationExpiration) * time.Second,
+	}
 }
 
-func (u *SessionUsecase) Create(ctx context.Context, session *entity.Session) error {
-	return u.repo.Create(ctx, session)
+// Start signs the user in: it issues a refresh/access token pair and records
+// the session as the first of a new family.
+func (u *SessionUsecase) Start(ctx context.Context, userID, provider, providerRefreshToken, userAgent, ipAddress string) (*entity.TokenPair, error) {
+	return u.start(ctx, &entity.Session{
+		UserID:               userID,
+		Provider:             provider,
+		ProviderRefreshToken: providerRefreshToken,
+		UserAgent:            userAgent,
+		IPAddress:            ipAddress,
+	})
+}
+
+// StartForClient starts a session on behalf of an OAuth client. Its tokens
+// carry the client ID and the granted scope, and only the client can refresh
+// them.
+func (u *SessionUsecase) StartForClient(ctx context.Context, userID, clientID, scope, userAgent, ipAddress string) (*entity.TokenPair, error) {
+	return u.start(ctx, &entity.Session{
+		UserID:    userID,
+		ClientID:  clientID,
+		Scope:     scope,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+	})
+}
+
+// Impersonate starts a session in which an admin acts as the user. Its tokens
+// carry the admin in the act claim and no permissions, and both expire at the
+// end of the impersonation period, since they cannot be refreshed.
+func (u *SessionUsecase) Impersonate(ctx context.Context, impersonatorID, userID, userAgent, ipAddress string) (*entity.TokenPair, error) {
+	if impersonatorID == userID {
+		return nil, apperror.ErrOperationDenied
+	}
+	return u.start(ctx, &entity.Session{
+		UserID:         userID,
+		ImpersonatorID: impersonatorID,
+		UserAgent:      userAgent,
+		IPAddress:      ipAddress,
+	})
+}
+
+func (u *SessionUsecase) start(ctx context.Context, session *entity.Session) (*entity.TokenPair, error) {
+	user, err := u.userRepo.FindByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, apperror.ErrAccountDisabled
+	}
+	tokens, err := u.issueTokens(ctx, user, session.ClientID, session.Scope, session.ImpersonatorID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session.ID = tokens.SessionID
+	session.FamilyID = tokens.SessionID
+	session.IsRevoked = false
+	session.CreatedAt = now
+	session.LastUsedAt = now
+	session.ExpiresAt = tokens.RefreshTokenExpiresAt
+	if err := u.repo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Refresh redeems a refresh token for a new token pair, see Rotate. It
+// returns the session the refresh token belonged to. clientID is the OAuth
+// client redeeming the token, or empty for first-party clients.
+func (u *SessionUsecase) Refresh(ctx context.Context, refreshToken, clientID, userAgent, ipAddress string) (*entity.Session, *entity.TokenPair, error) {
+	claims, err := u.jwtMaker.VerfiyToken(refreshToken)
+	if err != nil || claims.SessionID != "" || claims.PrincipalType != "" || claims.Actor != nil {
+		// Access tokens carry a session ID and cannot be used to refresh,
+		// service account tokens have no session at all, and impersonation
+		// ends when its tokens expire.
+		return nil, nil, apperror.ErrUnauthorized
+	}
+	if claims.ClientID != clientID {
+		return nil, nil, apperror.ErrUnauthorized
+	}
+	user, err := u.userRepo.FindByID(ctx, claims.ID)
+	if err != nil || user.Disabled {
+		return nil, nil, apperror.ErrUnauthorized
+	}
+	tokens, err := u.issueTokens(ctx, user, claims.ClientID, claims.Scope, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	next := &entity.Session{
+		ID:         tokens.SessionID,
+		UserID:     user.ID,
+		IsRevoked:  false,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		LastUsedAt: time.Now(),
+		ExpiresAt:  tokens.RefreshTokenExpiresAt,
+	}
+	return u.Rotate(ctx, claims.RegisteredClaims.ID, next, tokens)
+}
+
+// issueTokens creates a refresh token, whose ID becomes the session ID, and
+// an access token bound to it. First-party access tokens carry the user's
+// permissions, so a role change shows up at the next refresh. Impersonation
+// tokens name the admin instead and never carry permissions.
+func (u *SessionUsecase) issueTokens(ctx context.Context, user *entity.User, clientID, scope, impersonatorID string) (*entity.TokenPair, error) {
+	refreshDuration, accessDuration := u.refreshTokenDuration, accessTokenDuration
+	var (
+		permissions []string
+		actor       *token.ActorClaim
+	)
+	if impersonatorID != "" {
+		refreshDuration, accessDuration = u.impersonationDuration, u.impersonationDuration
+		actor = &token.ActorClaim{Subject: impersonatorID}
+	} else if clientID == "" {
+		var err error
+		if permissions, err = u.roleUsecase.Permissions(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	refreshClaims, err := token.NewUserClaims(user.ID, refreshDuration)
+	if err != nil {
+		return nil, err
+	}
+	refreshClaims.ClientID = clientID
+	refreshClaims.Scope = scope
+	refreshClaims.Actor = actor
+	refreshToken, refreshClaims, err := u.jwtMaker.Sign(refreshClaims)
+	if err != nil {
+		return nil, err
+	}
+	accessClaims, err := token.NewUserClaims(user.ID, accessDuration)
+	if err != nil {
+		return nil, err
+	}
+	accessClaims.SessionID = refreshClaims.RegisteredClaims.ID
+	accessClaims.ClientID = clientID
+	accessClaims.Scope = scope
+	accessClaims.Permissions = permissions
+	accessClaims.Actor = actor
+	accessToken, accessClaims, err := u.jwtMaker.Sign(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.TokenPair{
+		SessionID:             refreshClaims.RegisteredClaims.ID,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshClaims.RegisteredClaims.ExpiresAt.Time,
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessClaims.RegisteredClaims.ExpiresAt.Time,
+	}, nil
 }
 
 func (u *SessionUsecase) FindByID(ctx context.Context, id string) (*entity.Session, error) {
 	return u.repo.FindByID(ctx, id)
 }
 
+// FindByUserID returns the user's active sessions, most recently used first.
 func (u *SessionUsecase) FindByUserID(ctx context.Context, userID string) ([]*entity.Session, error) {
-	return u.repo.FindByUserID(ctx, userID)
+	sessions, err := u.repo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(sessions, func(a, b *entity.Session) int {
+		return lastUsed(b).Compare(lastUsed(a))
+	})
+	return sessions, nil
+}
+
+func lastUsed(session *entity.Session) time.Time {
+	if session.LastUsedAt.IsZero() {
+		return session.CreatedAt
+	}
+	return session.LastUsedAt
+}
+
+// Touch records that the session was just used, at most once per
+// lastUsedResolution.
+func (u *SessionUsecase) Touch(ctx context.Context, session *entity.Session) error {
+	if time.Since(session.LastUsedAt) < lastUsedResolution {
+		return nil
+	}
+	return u.repo.Touch(ctx, session.ID, time.Now())
+}
+
+// Rotate replaces the session whose refresh token was presented with next,
+// which joins its family, and returns the replaced session together with the
+// tokens to hand out. Concurrent refreshes within the grace period all get
+// the tokens of the first one. A refresh token that was rotated before that
+// is treated as stolen: the whole family is revoked and ErrSessionReused is
+// returned.
+func (u *SessionUsecase) Rotate(ctx context.Context, id string, next *entity.Session, tokens *entity.TokenPair) (*entity.Session, *entity.TokenPair, error) {
+	session, err := u.repo.FindByID(ctx, id)
+	if err != nil || session.UserID != next.UserID {
+		return nil, nil, apperror.ErrUnauthorized
+	}
+	if session.IsRevoked && session.ReplacedBy == "" {
+		return nil, nil, apperror.ErrUnauthorized
+	}
+
+	next.FamilyID = session.Family()
+	next.ParentID = session.ID
+	next.Provider = session.Provider
+	next.ProviderRefreshToken = session.ProviderRefreshToken
+	next.ClientID = session.ClientID
+	next.Scope = session.Scope
+	next.CreatedAt = session.CreatedAt
+	issued, err := u.repo.Rotate(ctx, session.ID, next, tokens, u.rotationGracePeriod)
+	switch {
+	case errors.Is(err, apperror.ErrSessionReused):
+		if err := u.revokeReusedFamily(ctx, session, next); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, apperror.ErrSessionReused
+	case errors.Is(err, apperror.ErrRecordNotFound):
+		return nil, nil, apperror.ErrUnauthorized
+	case err != nil:
+		return nil, nil, err
+	}
+	return session, issued, nil
+}
+
+// revokeReusedFamily signs out every session descending from the same login
+// and records the reuse. presented describes who presented the old token.
+func (u *SessionUsecase) revokeReusedFamily(ctx context.Context, session, presented *entity.Session) error {
+	log.Printf("refresh token reuse detected for user %s, revoking session family %s", session.UserID, session.Family())
+	if err := u.repo.RevokeFamily(ctx, session.UserID, session.Family()); err != nil {
+		return err
+	}
+	if err := u.auditEventRepo.Create(ctx, &entity.AuditEvent{
+		UserID:    session.UserID,
+		Type:      entity.AuditEventRefreshTokenReuse,
+		IPAddress: presented.IPAddress,
+		UserAgent: presented.UserAgent,
+		Details: map[string]string{
+			"family_id":  session.Family(),
+			"session_id": session.ID,
+		},
+	}); err != nil {
+		log.Printf("failed to record audit event for user %s: %v", session.UserID, err)
+	}
+	return nil
+}
+
+// Introspect reports whether a token issued by this service is still valid:
+// its signature and expiry check out and the session it belongs to, which
+// for a refresh token is the session it identifies, has not been revoked or
+// rotated.
+func (u *SessionUsecase) Introspect(ctx context.Context, tokenStr string) (*entity.TokenIntrospection, error) {
+	claims, sessionID, tokenType, ok := u.parse(tokenStr)
+	if !ok {
+		return &entity.TokenIntrospection{Active: false}, nil
+	}
+	session, err := u.repo.FindByID(ctx, sessionID)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return &entity.TokenIntrospection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.IsRevoked || session.UserID != claims.ID {
+		return &entity.TokenIntrospection{Active: false}, nil
+	}
+	return &entity.TokenIntrospection{
+		Active:    true,
+		TokenType: tokenType,
+		Subject:   claims.Subject,
+		SessionID: sessionID,
+		ClientID:  claims.ClientID,
+		Scope:     claims.Scope,
+		Actor:     actor(claims),
+		Issuer:    claims.Issuer,
+		TokenID:   claims.RegisteredClaims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}, nil
+}
+
+// RevokeToken revokes the session a token belongs to, which invalidates both
+// its refresh and access tokens. Invalid tokens are ignored, as RFC 7009
+// asks.
+func (u *SessionUsecase) RevokeToken(ctx context.Context, tokenStr string) error {
+	claims, sessionID, _, ok := u.parse(tokenStr)
+	if !ok {
+		return nil
+	}
+	session, err := u.repo.FindByID(ctx, sessionID)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if session.IsRevoked || session.UserID != claims.ID {
+		return nil
+	}
+	return u.repo.Revoke(ctx, session.ID)
+}
+
+// parse verifies a token and tells which session it belongs to. Access
+// tokens name their session; a refresh token's ID is the session ID.
+// Service account tokens belong to no session and are not accepted.
+func (u *SessionUsecase) parse(tokenStr string) (*token.UserClaims, string, string, bool) {
+	claims, err := u.jwtMaker.VerfiyToken(tokenStr)
+	if err != nil || claims.PrincipalType != "" {
+		return nil, "", "", false
+	}
+	if claims.SessionID != "" {
+		return claims, claims.SessionID, entity.TokenTypeAccess, true
+	}
+	return claims, claims.RegisteredClaims.ID, entity.TokenTypeRefresh, true
+}
+
+// actor returns who is impersonating the subject of claims, if anyone.
+func actor(claims *token.UserClaims) string {
+	if claims.Actor == nil {
+		return ""
+	}
+	return claims.Actor.Subject
 }
 
 func (u *SessionUsecase) Revoke(ctx context.Context, id string) error {
 	return u.repo.Revoke(ctx, id)
 }
 
+// RevokeForUser revokes one of the user's active sessions. Sessions of other
+// users are reported as not found.
+func (u *SessionUsecase) RevokeForUser(ctx context.Context, userID, id string) error {
+	session, err := u.repo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID || session.IsRevoked {
+		return apperror.ErrRecordNotFound
+	}
+	return u.repo.Revoke(ctx, id)
+}
+
+func (u *SessionUsecase) RevokeByUserID(ctx context.Context, userID string, exceptIDs ...string) error {
+	return u.repo.RevokeByUserID(ctx, userID, exceptIDs...)
+}
+
 func (u *SessionUsecase) Delete(ctx context.Context, id string) error {
 	return u.repo.Delete(ctx, id)
 }
@@ -0,0 +1,403 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	sessionUsecase "github.com/KimNattanan/go-user-service/internal/usecase/session"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeRoleUsecase grants every user the same permissions.
+type fakeRoleUsecase struct {
+	usecase.RoleUsecase
+	permissions []string
+}
+
+func (u *fakeRoleUsecase) Permissions(ctx context.Context, user *entity.User) ([]string, error) {
+	return u.permissions, nil
+}
+
+func setup() (*sessionUsecase.SessionUsecase, *repotest.SessionRepo) {
+	u, repo, _ := setupWithAudit(0)
+	return u, repo
+}
+
+func setupWithAudit(gracePeriod int) (*sessionUsecase.SessionUsecase, *repotest.SessionRepo, *repotest.AuditEventRepo) {
+	u, repo, auditEventRepo, _ := setupWithUsers(gracePeriod)
+	return u, repo, auditEventRepo
+}
+
+func setupWithUsers(gracePeriod int) (*sessionUsecase.SessionUsecase, *repotest.SessionRepo, *repotest.AuditEventRepo, *repotest.UserRepo) {
+	now := time.Now()
+	repo := repotest.NewSessionRepo(
+		&entity.Session{ID: "old", UserID: "user-1", CreatedAt: now.Add(-time.Hour)},
+		&entity.Session{ID: "new", UserID: "user-1", CreatedAt: now.Add(-2 * time.Hour), LastUsedAt: now.Add(-time.Second)},
+		&entity.Session{ID: "other", UserID: "user-2", CreatedAt: now},
+	)
+	auditEventRepo := repotest.NewAuditEventRepo()
+	users := repotest.NewUserRepo(&entity.User{ID: "user-1"})
+	cfg := &config.Config{
+		JWTAlgorithm:               token.AlgorithmEdDSA,
+		JWTExpiration:              3600,
+		SessionRotationGracePeriod: gracePeriod,
+		ImpersonationExpiration:    900,
+	}
+	keyring, err := token.NewKeyring(cfg)
+	if err != nil {
+		panic(err)
+	}
+	roles := &fakeRoleUsecase{permissions: []string{entity.PermissionUsersRead}}
+	u := sessionUsecase.NewSessionUsecase(repo, users, auditEventRepo, roles, token.NewJWTMaker(keyring, "test"), cfg)
+	return u, repo, auditEventRepo, users
+}
+
+func TestFindByUserIDOrdersByLastUse(t *testing.T) {
+	u, _ := setup()
+	sessions, err := u.FindByUserID(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("FindByUserID: %v", err)
+	}
+	var ids []string
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	if !slices.Equal(ids, []string{"new", "old"}) {
+		t.Errorf("expected [new old], got %v", ids)
+	}
+}
+
+func TestRevokeForUser(t *testing.T) {
+	ctx := context.Background()
+	u, repo := setup()
+
+	if err := u.RevokeForUser(ctx, "user-1", "other"); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for another user's session, got %v", apperror.ErrRecordNotFound, err)
+	}
+	if repo.Sessions["other"].IsRevoked {
+		t.Error("expected another user's session to stay active")
+	}
+	if err := u.RevokeForUser(ctx, "user-1", "missing"); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for an unknown session, got %v", apperror.ErrRecordNotFound, err)
+	}
+	if err := u.RevokeForUser(ctx, "user-1", "old"); err != nil {
+		t.Fatalf("RevokeForUser: %v", err)
+	}
+	if !repo.Sessions["old"].IsRevoked {
+		t.Error("expected the session to be revoked")
+	}
+	if err := u.RevokeForUser(ctx, "user-1", "old"); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for an already revoked session, got %v", apperror.ErrRecordNotFound, err)
+	}
+}
+
+func TestTouchIsThrottled(t *testing.T) {
+	ctx := context.Background()
+	u, repo := setup()
+
+	for _, id := range []string{"old", "new"} {
+		session, _ := repo.FindByID(ctx, id)
+		if err := u.Touch(ctx, session); err != nil {
+			t.Fatalf("Touch: %v", err)
+		}
+	}
+	if !slices.Equal(repo.Touched(), []string{"old"}) {
+		t.Errorf("expected only the stale session to be touched, got %v", repo.Touched())
+	}
+}
+
+func tokensFor(session *entity.Session) *entity.TokenPair {
+	return &entity.TokenPair{SessionID: session.ID, RefreshToken: "refresh-" + session.ID, AccessToken: "access-" + session.ID}
+}
+
+func TestRotateKeepsFamily(t *testing.T) {
+	ctx := context.Background()
+	u, repo := setup()
+	repo.Sessions["old"].Provider = "google"
+
+	first := &entity.Session{ID: "rotated-1", UserID: "user-1"}
+	if _, _, err := u.Rotate(ctx, "old", first, tokensFor(first)); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	second := &entity.Session{ID: "rotated-2", UserID: "user-1"}
+	if _, _, err := u.Rotate(ctx, "rotated-1", second, tokensFor(second)); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if second.FamilyID != "old" || second.ParentID != "rotated-1" || second.Provider != "google" ||
+		!second.CreatedAt.Equal(repo.Sessions["old"].CreatedAt) {
+		t.Errorf("unexpected rotated session %+v", *second)
+	}
+	if !repo.Sessions["rotated-1"].IsRevoked || repo.Sessions["rotated-1"].ReplacedBy != "rotated-2" {
+		t.Error("expected the presented session to be marked as rotated")
+	}
+	if _, _, err := u.Rotate(ctx, "other", &entity.Session{ID: "x", UserID: "user-1"}, nil); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected %v for another user's session, got %v", apperror.ErrUnauthorized, err)
+	}
+}
+
+func TestRotateDetectsReuse(t *testing.T) {
+	ctx := context.Background()
+	u, repo, auditEventRepo := setupWithAudit(0)
+
+	rotated := &entity.Session{ID: "rotated", UserID: "user-1"}
+	if _, _, err := u.Rotate(ctx, "old", rotated, tokensFor(rotated)); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	stolen := &entity.Session{ID: "stolen", UserID: "user-1", IPAddress: "203.0.113.9"}
+	_, _, err := u.Rotate(ctx, "old", stolen, tokensFor(stolen))
+	if !errors.Is(err, apperror.ErrSessionReused) {
+		t.Fatalf("expected %v, got %v", apperror.ErrSessionReused, err)
+	}
+	if _, ok := repo.Sessions["stolen"]; ok {
+		t.Error("expected no session to be issued for a reused token")
+	}
+	if !repo.Sessions["rotated"].IsRevoked {
+		t.Error("expected the whole family to be revoked")
+	}
+	if repo.Sessions["new"].IsRevoked {
+		t.Error("expected sessions of other families to stay active")
+	}
+	if events := auditEventRepo.Events(); len(events) != 1 || events[0].Type != entity.AuditEventRefreshTokenReuse ||
+		events[0].IPAddress != "203.0.113.9" {
+		t.Errorf("expected a refresh token reuse event, got %+v", events)
+	}
+
+	if err := u.Revoke(ctx, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := u.Rotate(ctx, "new", &entity.Session{ID: "after-logout", UserID: "user-1"}, nil); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected %v for a logged out session, got %v", apperror.ErrUnauthorized, err)
+	}
+	if len(auditEventRepo.Events()) != 1 {
+		t.Error("expected no reuse event for a logged out session")
+	}
+}
+
+func TestRotateWithinGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	u, repo, auditEventRepo := setupWithAudit(10)
+
+	first := &entity.Session{ID: "first", UserID: "user-1"}
+	if _, _, err := u.Rotate(ctx, "old", first, tokensFor(first)); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	concurrent := &entity.Session{ID: "concurrent", UserID: "user-1"}
+	_, issued, err := u.Rotate(ctx, "old", concurrent, tokensFor(concurrent))
+	if err != nil {
+		t.Fatalf("expected a concurrent refresh to succeed, got %v", err)
+	}
+	if *issued != *tokensFor(first) {
+		t.Errorf("expected the successor's tokens, got %+v", *issued)
+	}
+	if _, ok := repo.Sessions["concurrent"]; ok {
+		t.Error("expected no extra session for a concurrent refresh")
+	}
+	if len(auditEventRepo.Events()) != 0 {
+		t.Error("expected no reuse event within the grace period")
+	}
+
+	if err := u.Revoke(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := u.Rotate(ctx, "old", concurrent, tokensFor(concurrent)); !errors.Is(err, apperror.ErrSessionReused) {
+		t.Errorf("expected %v once the successor is revoked, got %v", apperror.ErrSessionReused, err)
+	}
+}
+
+func TestStartAndRefresh(t *testing.T) {
+	ctx := context.Background()
+	u, repo := setup()
+
+	tokens, err := u.Start(ctx, "user-1", "google", "provider-refresh", "test-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	started := repo.Sessions[tokens.SessionID]
+	if started == nil || started.FamilyID != tokens.SessionID || started.Provider != "google" || started.IPAddress != "192.0.2.1" {
+		t.Fatalf("unexpected session %+v", started)
+	}
+
+	if _, _, err := u.Refresh(ctx, tokens.AccessToken, "", "test-agent", "192.0.2.1"); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected %v when refreshing with an access token, got %v", apperror.ErrUnauthorized, err)
+	}
+	previous, refreshed, err := u.Refresh(ctx, tokens.RefreshToken, "", "other-agent", "192.0.2.2")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if previous.ID != tokens.SessionID || refreshed.SessionID == tokens.SessionID || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Errorf("expected a new token pair, got %+v", *refreshed)
+	}
+	if next := repo.Sessions[refreshed.SessionID]; next == nil || next.FamilyID != tokens.SessionID || next.ProviderRefreshToken != "provider-refresh" {
+		t.Errorf("expected the refreshed session to stay in the family, got %+v", next)
+	}
+	if _, _, err := u.Refresh(ctx, tokens.RefreshToken, "", "attacker", "203.0.113.9"); !errors.Is(err, apperror.ErrSessionReused) {
+		t.Errorf("expected %v for a rotated refresh token, got %v", apperror.ErrSessionReused, err)
+	}
+}
+
+func TestDisabledUsersCannotSignIn(t *testing.T) {
+	ctx := context.Background()
+	u, _, _, users := setupWithUsers(0)
+
+	tokens, err := u.Start(ctx, "user-1", "", "", "test-agent", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	users.Users["user-1"].Disabled = true
+	if _, err := u.Start(ctx, "user-1", "", "", "test-agent", "192.0.2.1"); !errors.Is(err, apperror.ErrAccountDisabled) {
+		t.Errorf("expected %v when signing in, got %v", apperror.ErrAccountDisabled, err)
+	}
+	if _, _, err := u.Refresh(ctx, tokens.RefreshToken, "", "test-agent", "192.0.2.1"); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected %v when refreshing, got %v", apperror.ErrUnauthorized, err)
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	ctx := context.Background()
+	u, repo := setup()
+
+	if _, err := u.Impersonate(ctx, "user-1", "user-1", "ua", "127.0.0.1"); !errors.Is(err, apperror.ErrOperationDenied) {
+		t.Errorf("expected %v when impersonating yourself, got %v", apperror.ErrOperationDenied, err)
+	}
+	tokens, err := u.Impersonate(ctx, "admin-1", "user-1", "ua", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Impersonate: %v", err)
+	}
+	if session := repo.Sessions[tokens.SessionID]; session.UserID != "user-1" || session.ImpersonatorID != "admin-1" {
+		t.Errorf("expected a session of the user naming the admin, got %+v", session)
+	}
+	if time.Until(tokens.RefreshTokenExpiresAt) > 900*time.Second {
+		t.Errorf("expected the session to end with the impersonation period, got %v", tokens.RefreshTokenExpiresAt)
+	}
+
+	claims := new(token.UserClaims)
+	if _, _, err := jwt.NewParser().ParseUnverified(tokens.AccessToken, claims); err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if claims.Actor == nil || claims.Actor.Subject != "admin-1" || claims.Permissions != nil {
+		t.Errorf("expected the admin in act and no permissions, got %+v", claims)
+	}
+	introspection, err := u.Introspect(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if !introspection.Active || introspection.Subject != "user-1" || introspection.Actor != "admin-1" {
+		t.Errorf("unexpected introspection %+v", introspection)
+	}
+	if _, _, err := u.Refresh(ctx, tokens.RefreshToken, "", "ua", "127.0.0.1"); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected %v when refreshing, got %v", apperror.ErrUnauthorized, err)
+	}
+}
+
+func TestIntrospectAndRevokeToken(t *testing.T) {
+	u, _ := setup()
+	ctx := context.Background()
+	tokens, err := u.Start(ctx, "user-1", "password", "", "ua", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	access, err := u.Introspect(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if !access.Active || access.TokenType != entity.TokenTypeAccess || access.Subject != "user-1" || access.SessionID != tokens.SessionID {
+		t.Errorf("unexpected access token introspection %+v", access)
+	}
+	refresh, err := u.Introspect(ctx, tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if !refresh.Active || refresh.TokenType != entity.TokenTypeRefresh || refresh.SessionID != tokens.SessionID {
+		t.Errorf("unexpected refresh token introspection %+v", refresh)
+	}
+	if garbage, err := u.Introspect(ctx, "not-a-token"); err != nil || garbage.Active {
+		t.Errorf("expected an invalid token to be inactive, got %+v, %v", garbage, err)
+	}
+
+	if err := u.RevokeToken(ctx, tokens.RefreshToken); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	for _, tokenStr := range []string{tokens.AccessToken, tokens.RefreshToken} {
+		if introspection, err := u.Introspect(ctx, tokenStr); err != nil || introspection.Active {
+			t.Errorf("expected the revoked session's tokens to be inactive, got %+v, %v", introspection, err)
+		}
+	}
+	if err := u.RevokeToken(ctx, "not-a-token"); err != nil {
+		t.Errorf("expected invalid tokens to be ignored, got %v", err)
+	}
+}
+
+func TestClientSessionsOnlyRefreshForTheirClient(t *testing.T) {
+	ctx := context.Background()
+	u, repo := setup()
+
+	tokens, err := u.StartForClient(ctx, "user-1", "client-1", "openid email", "app", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("StartForClient: %v", err)
+	}
+	if _, _, err := u.Refresh(ctx, tokens.RefreshToken, "", "app", "192.0.2.1"); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected a first-party refresh of a client token to fail, got %v", err)
+	}
+	if _, _, err := u.Refresh(ctx, tokens.RefreshToken, "client-2", "app", "192.0.2.1"); !errors.Is(err, apperror.ErrUnauthorized) {
+		t.Errorf("expected another client's refresh to fail, got %v", err)
+	}
+	_, refreshed, err := u.Refresh(ctx, tokens.RefreshToken, "client-1", "app", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if next := repo.Sessions[refreshed.SessionID]; next.ClientID != "client-1" || next.Scope != "openid email" {
+		t.Errorf("expected the client and scope to carry over, got %+v", next)
+	}
+	introspection, err := u.Introspect(ctx, refreshed.AccessToken)
+	if err != nil || introspection.ClientID != "client-1" || introspection.Scope != "openid email" {
+		t.Errorf("unexpected introspection %+v, %v", introspection, err)
+	}
+}
+
+func TestOnlyFirstPartyAccessTokensCarryPermissions(t *testing.T) {
+	ctx := context.Background()
+	u, _ := setup()
+
+	permissions := func(accessToken string) []string {
+		claims := new(token.UserClaims)
+		if _, _, err := jwt.NewParser().ParseUnverified(accessToken, claims); err != nil {
+			t.Fatalf("ParseUnverified: %v", err)
+		}
+		return claims.Permissions
+	}
+	tokens, err := u.Start(ctx, "user-1", "password", "", "ua", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if got := permissions(tokens.AccessToken); !slices.Equal(got, []string{entity.PermissionUsersRead}) {
+		t.Errorf("expected the user's permissions in the access token, got %v", got)
+	}
+	if got := permissions(tokens.RefreshToken); got != nil {
+		t.Errorf("expected no permissions in the refresh token, got %v", got)
+	}
+	_, refreshed, err := u.Refresh(ctx, tokens.RefreshToken, "", "ua", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got := permissions(refreshed.AccessToken); !slices.Equal(got, []string{entity.PermissionUsersRead}) {
+		t.Errorf("expected a refreshed access token to keep the permissions, got %v", got)
+	}
+
+	clientTokens, err := u.StartForClient(ctx, "user-1", "client-1", "openid", "app", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("StartForClient: %v", err)
+	}
+	if got := permissions(clientTokens.AccessToken); got != nil {
+		t.Errorf("expected no permissions in a client's access token, got %v", got)
+	}
+}
@@ -2,20 +2,70 @@ package user
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/KimNattanan/go-user-service/internal/entity"
 	"github.com/KimNattanan/go-user-service/internal/repo"
 	"github.com/KimNattanan/go-user-service/pkg/apperror"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/mailer"
+	"github.com/KimNattanan/go-user-service/pkg/passwordhash"
+	"github.com/KimNattanan/go-user-service/pkg/passwordpolicy"
+	"github.com/KimNattanan/go-user-service/pkg/securetoken"
+)
+
+const (
+	EmailLoginLink = "link"
+	EmailLoginCode = "code"
+
+	emailLoginCodeDigits  = 6
+	maxEmailLoginAttempts = 5
 )
 
 type UserUsecase struct {
-	repo repo.UserRepo
+	repo                 repo.UserRepo
+	sessionRepo          repo.SessionRepo
+	tokenRepo            repo.OneTimeTokenRepo
+	passwordHistoryRepo  repo.PasswordHistoryRepo
+	mailer               mailer.Mailer
+	passwordPolicy       *passwordpolicy.Policy
+	passwordHasher       *passwordhash.Hasher
+	passwordHistory      int
+	emailVerificationURL string
+	emailVerificationTTL time.Duration
+	passwordResetURL     string
+	passwordResetTTL     time.Duration
+	reauthMaxAge         time.Duration
+	registrationOpen     bool
+	passwordlessURL      string
+	passwordlessTTL      time.Duration
 }
 
-func NewUserUsecase(repo repo.UserRepo) *UserUsecase {
-	return &UserUsecase{repo: repo}
+func NewUserUsecase(repo repo.UserRepo, sessionRepo repo.SessionRepo, tokenRepo repo.OneTimeTokenRepo, passwordHistoryRepo repo.PasswordHistoryRepo, mailer mailer.Mailer, passwordPolicy *passwordpolicy.Policy, passwordHasher *passwordhash.Hasher, cfg *config.Config) *UserUsecase {
+	return &UserUsecase{
+		repo:                 repo,
+		sessionRepo:          sessionRepo,
+		tokenRepo:            tokenRepo,
+		passwordHistoryRepo:  passwordHistoryRepo,
+		mailer:               mailer,
+		passwordPolicy:       passwordPolicy,
+		passwordHasher:       passwordHasher,
+		passwordHistory:      cfg.PasswordHistory,
+		emailVerificationURL: cfg.EmailVerificationURL,
+		emailVerificationTTL: time.Duration(cfg.EmailVerificationTTL) * time.Second,
+		passwordResetURL:     cfg.PasswordResetURL,
+		passwordResetTTL:     time.Duration(cfg.PasswordResetTTL) * time.Second,
+		reauthMaxAge:         time.Duration(cfg.ReauthMaxAge) * time.Second,
+		registrationOpen:     cfg.RegistrationOpen,
+		passwordlessURL:      cfg.PasswordlessURL,
+		passwordlessTTL:      time.Duration(cfg.PasswordlessTTL) * time.Second,
+	}
 }
 
 func (u *UserUsecase) FindAll(ctx context.Context) ([]*entity.User, error) {
@@ -39,76 +89,480 @@ func (u *UserUsecase) Delete(ctx context.Context, id string) error {
 	return u.repo.Delete(ctx, id)
 }
 
-func (u *UserUsecase) LoginOrRegisterWithGoogle(ctx context.Context, userInfo map[string]interface{}) (*entity.User, error) {
-	email, ok := userInfo["email"].(string)
-	if !ok || email == "" {
-		return nil, apperror.ErrInvalidData
+func (u *UserUsecase) Register(ctx context.Context, user *entity.User) (*entity.User, error) {
+	if !u.registrationOpen {
+		return nil, apperror.ErrRegistrationClosed
+	}
+	existingUser, err := u.repo.FindByEmail(ctx, user.Email)
+	if existingUser != nil {
+		return nil, apperror.ErrAlreadyExists
+	}
+	if err != nil && !errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err := u.checkPassword(ctx, "password", user, user.Password); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := u.passwordHasher.Hash(user.Password)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = passwordHash
+
+	if err := u.repo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	if err := u.recordPassword(ctx, user.ID, passwordHash); err != nil {
+		return nil, err
+	}
+	createdUser, err := u.repo.FindByID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.sendVerificationEmail(ctx, createdUser); err != nil {
+		log.Printf("failed to send verification email to user %s: %v", createdUser.ID, err)
 	}
-	name, _ := userInfo["name"].(string)
-	firstName, _ := userInfo["given_name"].(string)
-	lastName, _ := userInfo["family_name"].(string)
-	pictureURL, _ := userInfo["picture"].(string)
+	return createdUser, nil
+}
 
+// Login checks the password and, once it matches, transparently rehashes it
+// if it was stored with an outdated algorithm or cost.
+func (u *UserUsecase) Login(ctx context.Context, email, password string) (*entity.User, error) {
 	user, err := u.repo.FindByEmail(ctx, email)
-	if err != nil && !errors.Is(err, apperror.ErrRecordNotFound) {
+	if err != nil {
 		return nil, err
 	}
-	if user == nil {
-		user = &entity.User{
-			Email:      email,
-			Name:       name,
-			FirstName:  firstName,
-			LastName:   lastName,
-			Password:   "",
-			PictureURL: pictureURL,
+	if ok, err := u.passwordHasher.Verify(password, user.Password); err != nil || !ok {
+		if err != nil {
+			log.Printf("failed to verify password of user %s: %v", user.ID, err)
 		}
-		if err := u.repo.Create(ctx, user); err != nil {
-			return nil, err
-		}
-	} else {
-		if user, err = u.repo.Update(ctx, user.ID, map[string]interface{}{
-			"first_name":  firstName,
-			"last_name":   lastName,
-			"picture_url": pictureURL,
-		}); err != nil {
+		return nil, apperror.ErrIncorrectPassword
+	}
+	if user.PasswordResetRequired {
+		// The password is known to be compromised or expired, so it only
+		// earns a reset link sent to the owner.
+		if err := u.ForgotPassword(ctx, user.Email); err != nil {
 			return nil, err
 		}
+		return nil, apperror.ErrPasswordResetRequired
+	}
+	if u.passwordHasher.NeedsRehash(user.Password) {
+		u.rehashPassword(ctx, user, password)
 	}
 	return user, nil
 }
 
-func (u *UserUsecase) Register(ctx context.Context, user *entity.User) (*entity.User, error) {
-	existingUser, err := u.repo.FindByEmail(ctx, user.Email)
-	if existingUser != nil {
-		return nil, apperror.ErrAlreadyExists
+// rehashPassword upgrades the stored hash. Failures are only logged: the old
+// hash still verifies and the upgrade is retried on the next login.
+func (u *UserUsecase) rehashPassword(ctx context.Context, user *entity.User, password string) {
+	passwordHash, err := u.passwordHasher.Hash(password)
+	if err != nil {
+		log.Printf("failed to rehash password of user %s: %v", user.ID, err)
+		return
 	}
-	if err != nil && !errors.Is(err, apperror.ErrRecordNotFound) {
-		return nil, err
+	if _, err := u.repo.Update(ctx, user.ID, map[string]interface{}{
+		"password": passwordHash,
+	}); err != nil {
+		log.Printf("failed to store rehashed password of user %s: %v", user.ID, err)
+		return
+	}
+	user.Password = passwordHash
+}
+
+// ResendVerification issues a fresh verification token. Unknown or already
+// verified addresses are ignored so the caller cannot probe for accounts.
+func (u *UserUsecase) ResendVerification(ctx context.Context, email string) error {
+	user, err := u.repo.FindByEmail(ctx, email)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil
 	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return u.sendVerificationEmail(ctx, user)
+}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+func (u *UserUsecase) VerifyEmail(ctx context.Context, rawToken string) (*entity.User, error) {
+	user, err := u.consumeToken(ctx, entity.TokenPurposeEmailVerification, rawToken)
 	if err != nil {
 		return nil, err
 	}
-	user.Password = string(passwordHash)
+	if user.EmailVerified {
+		return user, nil
+	}
+	return u.repo.Update(ctx, user.ID, map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": time.Now(),
+	})
+}
 
-	if err := u.repo.Create(ctx, user); err != nil {
+// ForgotPassword emails a password reset link. Unknown addresses and delivery
+// failures are not reported so the response never reveals which emails exist.
+// The link is issued and sent in the background, as the time it takes would
+// give that away too.
+func (u *UserUsecase) ForgotPassword(ctx context.Context, email string) error {
+	user, err := u.repo.FindByEmail(ctx, email)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	go u.sendPasswordReset(context.WithoutCancel(ctx), user)
+	return nil
+}
+
+func (u *UserUsecase) sendPasswordReset(ctx context.Context, user *entity.User) {
+	rawToken, err := u.issueToken(ctx, entity.TokenPurposePasswordReset, user, u.passwordResetTTL)
+	if err != nil {
+		log.Printf("failed to issue password reset token for user %s: %v", user.ID, err)
+		return
+	}
+	link, err := tokenLink(u.passwordResetURL, url.Values{"token": {rawToken}})
+	if err != nil {
+		log.Printf("failed to build password reset link: %v", err)
+		return
+	}
+	if err := u.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for your account. If it was you, open the link below within %s.\n\n%s\n\nIf it was not, you can ignore this email.",
+			u.passwordResetTTL, link,
+		),
+	}); err != nil {
+		log.Printf("failed to send password reset email to user %s: %v", user.ID, err)
+	}
+}
+
+// ResetPassword consumes a reset token, replaces the password and signs the
+// user out everywhere.
+func (u *UserUsecase) ResetPassword(ctx context.Context, rawToken, password string) error {
+	// Check the policy before redeeming the token, so a rejected password
+	// does not cost the user their reset link.
+	token, err := u.tokenRepo.Find(ctx, entity.TokenPurposePasswordReset, securetoken.Hash(rawToken))
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return apperror.ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	user, err := u.tokenUser(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err := u.checkPassword(ctx, "password", user, password); err != nil {
+		return err
+	}
+
+	user, err = u.consumeToken(ctx, entity.TokenPurposePasswordReset, rawToken)
+	if err != nil {
+		return err
+	}
+	passwordHash, err := u.passwordHasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	fields := map[string]interface{}{
+		"password":                passwordHash,
+		"password_reset_required": false,
+	}
+	if !user.EmailVerified { // the reset link proves control of the address
+		fields["email_verified"] = true
+		fields["email_verified_at"] = time.Now()
+	}
+	if _, err := u.repo.Update(ctx, user.ID, fields); err != nil {
+		return err
+	}
+	if err := u.recordPassword(ctx, user.ID, passwordHash); err != nil {
+		return err
+	}
+	return u.sessionRepo.RevokeByUserID(ctx, user.ID)
+}
+
+// ChangePassword replaces the user's password and revokes every session except
+// the caller's. Accounts without a password (e.g. social sign-ups) can set one
+// if their session was authenticated recently.
+func (u *UserUsecase) ChangePassword(ctx context.Context, userID, sessionID, currentPassword, newPassword string) error {
+	user, err := u.repo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Password != "" {
+		if ok, err := u.passwordHasher.Verify(currentPassword, user.Password); err != nil || !ok {
+			return apperror.ErrIncorrectPassword
+		}
+	} else {
+		session, err := u.sessionRepo.FindByID(ctx, sessionID)
+		if err != nil || session.UserID != user.ID || time.Since(session.CreatedAt) > u.reauthMaxAge {
+			return apperror.ErrReauthRequired
+		}
+	}
+	if err := u.checkPassword(ctx, "new_password", user, newPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := u.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if _, err := u.repo.Update(ctx, user.ID, map[string]interface{}{
+		"password":                passwordHash,
+		"password_reset_required": false,
+	}); err != nil {
+		return err
+	}
+	if err := u.recordPassword(ctx, user.ID, passwordHash); err != nil {
+		return err
+	}
+	return u.sessionRepo.RevokeByUserID(ctx, user.ID, sessionID)
+}
+
+// StartEmailLogin emails a magic link or a short numeric code that can be
+// exchanged for a session. Addresses that cannot sign in (unknown while
+// registration is closed) are silently ignored.
+func (u *UserUsecase) StartEmailLogin(ctx context.Context, email, method string) error {
+	user, err := u.repo.FindByEmail(ctx, email)
+	if err != nil && !errors.Is(err, apperror.ErrRecordNotFound) {
+		return err
+	}
+	if user == nil && !u.registrationOpen {
+		return nil
+	}
+
+	var secret string
+	if method == EmailLoginCode {
+		secret, err = securetoken.GenerateDigits(emailLoginCodeDigits)
+	} else {
+		secret, err = securetoken.Generate(32)
+	}
+	if err != nil {
+		return err
+	}
+
+	// keyed by address so a new request replaces the previous link or code,
+	// while the failed attempts against it carry over
+	now := time.Now()
+	token := &entity.OneTimeToken{
+		Hash:      emailLoginKey(email),
+		Purpose:   entity.TokenPurposeEmailLogin,
+		Email:     email,
+		Data:      map[string]string{"secret": securetoken.Hash(secret)},
+		CreatedAt: now,
+		ExpiresAt: now.Add(u.passwordlessTTL),
+	}
+	if err := u.tokenRepo.Create(ctx, token); err != nil {
+		return err
+	}
+
+	message := &mailer.Message{To: email, Subject: "Your sign-in link"}
+	if method == EmailLoginCode {
+		message.Subject = "Your sign-in code"
+		message.Body = fmt.Sprintf(
+			"Your sign-in code is %s. It expires in %s.\n\nIf you did not try to sign in, you can ignore this email.",
+			secret, u.passwordlessTTL,
+		)
+	} else {
+		link, err := tokenLink(u.passwordlessURL, url.Values{"email": {email}, "token": {secret}})
+		if err != nil {
+			return err
+		}
+		message.Body = fmt.Sprintf(
+			"Open the link below within %s to sign in.\n\n%s\n\nIf you did not try to sign in, you can ignore this email.",
+			u.passwordlessTTL, link,
+		)
+	}
+	if err := u.mailer.Send(ctx, message); err != nil {
+		log.Printf("failed to send sign-in email: %v", err)
+	}
+	return nil
+}
+
+// CompleteEmailLogin redeems the link token or code sent by StartEmailLogin.
+// The address counts as verified, and an account is created on first use if
+// registration is open.
+func (u *UserUsecase) CompleteEmailLogin(ctx context.Context, email, secret string) (*entity.User, error) {
+	key := emailLoginKey(email)
+	token, err := u.tokenRepo.Find(ctx, entity.TokenPurposeEmailLogin, key)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidCode
+	}
+	if err != nil {
 		return nil, err
 	}
-	createdUser, err := u.repo.FindByID(ctx, user.ID)
+	// Every attempt is counted up front. Once the limit is reached, no code
+	// for the address is accepted until the last one issued has expired.
+	attempts, err := u.tokenRepo.IncrementAttempts(ctx, token)
 	if err != nil {
 		return nil, err
 	}
-	return createdUser, nil
+	if attempts > maxEmailLoginAttempts ||
+		subtle.ConstantTimeCompare([]byte(securetoken.Hash(secret)), []byte(token.Data["secret"])) != 1 {
+		return nil, apperror.ErrInvalidCode
+	}
+	if _, err := u.tokenRepo.Consume(ctx, entity.TokenPurposeEmailLogin, key); err != nil {
+		return nil, apperror.ErrInvalidCode
+	}
+
+	now := time.Now()
+	user, err := u.repo.FindByEmail(ctx, token.Email)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		if !u.registrationOpen {
+			return nil, apperror.ErrRegistrationClosed
+		}
+		user = &entity.User{
+			Email:           token.Email,
+			EmailVerified:   true,
+			EmailVerifiedAt: &now,
+		}
+		if err := u.repo.Create(ctx, user); err != nil {
+			return nil, err
+		}
+		return u.repo.FindByID(ctx, user.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return u.repo.Update(ctx, user.ID, map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": now,
+		})
+	}
+	return user, nil
 }
 
-func (u *UserUsecase) Login(ctx context.Context, email, password string) (*entity.User, error) {
-	user, err := u.repo.FindByEmail(ctx, email)
+func (u *UserUsecase) sendVerificationEmail(ctx context.Context, user *entity.User) error {
+	rawToken, err := u.issueToken(ctx, entity.TokenPurposeEmailVerification, user, u.emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	link, err := tokenLink(u.emailVerificationURL, url.Values{"token": {rawToken}})
+	if err != nil {
+		return err
+	}
+	return u.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Confirm your email address by opening the link below. It expires in %s.\n\n%s",
+			u.emailVerificationTTL, link,
+		),
+	})
+}
+
+// issueToken stores the hash of a new single-use token and returns the raw value.
+func (u *UserUsecase) issueToken(ctx context.Context, purpose string, user *entity.User, ttl time.Duration) (string, error) {
+	rawToken, err := securetoken.Generate(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token := &entity.OneTimeToken{
+		Hash:      securetoken.Hash(rawToken),
+		Purpose:   purpose,
+		UserID:    user.ID,
+		Email:     user.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := u.tokenRepo.Create(ctx, token); err != nil {
+		return "", err
+	}
+	return rawToken, nil
+}
+
+// consumeToken redeems a single-use token and returns the user it was issued to.
+func (u *UserUsecase) consumeToken(ctx context.Context, purpose, rawToken string) (*entity.User, error) {
+	token, err := u.tokenRepo.Consume(ctx, purpose, securetoken.Hash(rawToken))
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidToken
+	}
 	if err != nil {
 		return nil, err
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+	return u.tokenUser(ctx, token)
+}
+
+// tokenUser loads the user a token was issued to.
+func (u *UserUsecase) tokenUser(ctx context.Context, token *entity.OneTimeToken) (*entity.User, error) {
+	user, err := u.repo.FindByID(ctx, token.UserID)
+	if errors.Is(err, apperror.ErrRecordNotFound) {
+		return nil, apperror.ErrInvalidToken
+	}
+	if err != nil {
 		return nil, err
 	}
+	if user.Email != token.Email { // address changed after the token was issued
+		return nil, apperror.ErrInvalidToken
+	}
 	return user, nil
 }
+
+func tokenLink(baseURL string, params url.Values) (string, error) {
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+func emailLoginKey(email string) string {
+	return securetoken.Hash(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// checkPassword applies the password policy and, for existing users, rejects
+// the current and recently used passwords. Violations are reported under
+// field.
+func (u *UserUsecase) checkPassword(ctx context.Context, field string, user *entity.User, password string) error {
+	violations := u.passwordPolicy.Check(password, user.Email, user.Name, user.FirstName, user.LastName)
+
+	if user.ID != "" && u.passwordHistory > 0 {
+		hashes := []string{user.Password}
+		history, err := u.passwordHistoryRepo.FindRecent(ctx, user.ID, u.passwordHistory)
+		if err != nil {
+			return err
+		}
+		for _, entry := range history {
+			if entry.PasswordHash != user.Password {
+				hashes = append(hashes, entry.PasswordHash)
+			}
+		}
+		for _, hash := range hashes {
+			if ok, _ := u.passwordHasher.Verify(password, hash); ok {
+				violations = append(violations, apperror.FieldError{
+					Code:    passwordpolicy.CodeReused,
+					Message: fmt.Sprintf("must differ from your last %d passwords", u.passwordHistory),
+				})
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &apperror.ValidationError{
+			Err:    apperror.ErrWeakPassword,
+			Fields: map[string][]apperror.FieldError{field: violations},
+		}
+	}
+	return nil
+}
+
+func (u *UserUsecase) recordPassword(ctx context.Context, userID, passwordHash string) error {
+	if u.passwordHistory <= 0 {
+		return nil
+	}
+	return u.passwordHistoryRepo.Add(ctx, &entity.PasswordHistory{
+		UserID:       userID,
+		PasswordHash: passwordHash,
+	}, u.passwordHistory)
+}
@@ -0,0 +1,261 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	userUsecase "github.com/KimNattanan/go-user-service/internal/usecase/user"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/mailer"
+	"github.com/KimNattanan/go-user-service/pkg/passwordhash"
+	"github.com/KimNattanan/go-user-service/pkg/passwordpolicy"
+	"github.com/google/uuid"
+)
+
+type fakeMailer struct {
+	mu       sync.Mutex
+	messages []*mailer.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *fakeMailer) sent() []*mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*mailer.Message(nil), m.messages...)
+}
+
+var emailLoginCode = regexp.MustCompile(`code is (\d+)`)
+
+// lastCode returns the sign-in code of the last email sent.
+func (m *fakeMailer) lastCode(t *testing.T) string {
+	t.Helper()
+	sent := m.sent()
+	if len(sent) == 0 {
+		t.Fatal("expected a sign-in email")
+	}
+	match := emailLoginCode.FindStringSubmatch(sent[len(sent)-1].Body)
+	if match == nil {
+		t.Fatalf("expected a sign-in code in %q", sent[len(sent)-1].Body)
+	}
+	return match[1]
+}
+
+type fixture struct {
+	u        *userUsecase.UserUsecase
+	users    *repotest.UserRepo
+	sessions *repotest.SessionRepo
+	mailer   *fakeMailer
+	hasher   *passwordhash.Hasher
+}
+
+func setup(t *testing.T, registrationOpen bool, users ...*entity.User) *fixture {
+	t.Helper()
+	cfg := &config.Config{
+		PasswordHashAlgorithm:     passwordhash.AlgorithmArgon2id,
+		PasswordArgon2Memory:      1024,
+		PasswordArgon2Iterations:  1,
+		PasswordArgon2Parallelism: 1,
+		PasswordMinLength:         8,
+		PasswordMaxLength:         72,
+		PasswordMinClasses:        1,
+		PasswordHistory:           3,
+		ReauthMaxAge:              300,
+		RegistrationOpen:          registrationOpen,
+		PasswordlessURL:           "https://app.example.com/login/email",
+		PasswordlessTTL:           600,
+	}
+	hasher, err := passwordhash.NewHasher(cfg)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	policy, err := passwordpolicy.New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	f := &fixture{
+		users:    repotest.NewUserRepo(users...),
+		sessions: repotest.NewSessionRepo(),
+		mailer:   &fakeMailer{},
+		hasher:   hasher,
+	}
+	f.u = userUsecase.NewUserUsecase(f.users, f.sessions, repotest.NewOneTimeTokenRepo(), repotest.NewPasswordHistoryRepo(), f.mailer, policy, hasher, cfg)
+	return f
+}
+
+// hash returns the stored form of password.
+func (f *fixture) hash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := f.hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return hash
+}
+
+func (f *fixture) session(userID string, createdAt time.Time) *entity.Session {
+	session := &entity.Session{ID: uuid.NewString(), UserID: userID, CreatedAt: createdAt}
+	f.sessions.Create(context.Background(), session)
+	return session
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "jane@example.com"}
+	other := &entity.User{ID: uuid.NewString(), Email: "john@example.com"}
+	f := setup(t, true, user, other)
+	user.Password = f.hash(t, "old-password-1")
+	current := f.session(user.ID, time.Now().Add(-time.Hour))
+	elsewhere := f.session(user.ID, time.Now().Add(-time.Hour))
+	otherUsers := f.session(other.ID, time.Now())
+
+	if err := f.u.ChangePassword(ctx, user.ID, current.ID, "wrong-password", "new-password-1"); !errors.Is(err, apperror.ErrIncorrectPassword) {
+		t.Errorf("expected %v for a wrong current password, got %v", apperror.ErrIncorrectPassword, err)
+	}
+	if f.sessions.Sessions[elsewhere.ID].IsRevoked {
+		t.Error("expected a refused change to leave the sessions alone")
+	}
+
+	if err := f.u.ChangePassword(ctx, user.ID, current.ID, "old-password-1", "new-password-1"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if ok, err := f.hasher.Verify("new-password-1", user.Password); err != nil || !ok {
+		t.Errorf("expected the new password to be stored, got %v, %v", ok, err)
+	}
+	if f.sessions.Sessions[current.ID].IsRevoked {
+		t.Error("expected the session changing the password to be kept")
+	}
+	if !f.sessions.Sessions[elsewhere.ID].IsRevoked {
+		t.Error("expected the user's other sessions to be revoked")
+	}
+	if f.sessions.Sessions[otherUsers.ID].IsRevoked {
+		t.Error("expected other users' sessions to be left alone")
+	}
+
+	// Passwords set through a change are remembered and cannot be set again.
+	if err := f.u.ChangePassword(ctx, user.ID, current.ID, "new-password-1", "new-password-2"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if err := f.u.ChangePassword(ctx, user.ID, current.ID, "new-password-2", "new-password-1"); !errors.Is(err, apperror.ErrWeakPassword) {
+		t.Errorf("expected %v for a reused password, got %v", apperror.ErrWeakPassword, err)
+	}
+}
+
+func TestChangePasswordWithoutAPassword(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "jane@example.com"}
+	other := &entity.User{ID: uuid.NewString(), Email: "john@example.com"}
+	f := setup(t, true, user, other)
+	stale := f.session(user.ID, time.Now().Add(-10*time.Minute))
+	otherUsers := f.session(other.ID, time.Now())
+	recent := f.session(user.ID, time.Now().Add(-time.Minute))
+
+	// An account without a password proves who it is by a recent sign-in
+	// rather than the current password.
+	for name, sessionID := range map[string]string{
+		"a session older than REAUTH_MAX_AGE": stale.ID,
+		"another user's session":              otherUsers.ID,
+		"an unknown session":                  uuid.NewString(),
+	} {
+		if err := f.u.ChangePassword(ctx, user.ID, sessionID, "", "first-password-1"); !errors.Is(err, apperror.ErrReauthRequired) {
+			t.Errorf("%s: expected %v, got %v", name, apperror.ErrReauthRequired, err)
+		}
+	}
+	if user.Password != "" {
+		t.Fatal("expected no password to be set without a recent sign-in")
+	}
+
+	if err := f.u.ChangePassword(ctx, user.ID, recent.ID, "", "first-password-1"); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if ok, err := f.hasher.Verify("first-password-1", user.Password); err != nil || !ok {
+		t.Errorf("expected the first password to be stored, got %v, %v", ok, err)
+	}
+	if f.sessions.Sessions[recent.ID].IsRevoked || !f.sessions.Sessions[stale.ID].IsRevoked {
+		t.Error("expected every session but the current one to be revoked")
+	}
+}
+
+func TestEmailLoginCodeIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "jane@example.com"}
+	f := setup(t, false, user)
+
+	if err := f.u.StartEmailLogin(ctx, user.Email, userUsecase.EmailLoginCode); err != nil {
+		t.Fatalf("StartEmailLogin: %v", err)
+	}
+	code := f.mailer.lastCode(t)
+	signedIn, err := f.u.CompleteEmailLogin(ctx, user.Email, code)
+	if err != nil {
+		t.Fatalf("CompleteEmailLogin: %v", err)
+	}
+	if signedIn.ID != user.ID || !signedIn.EmailVerified {
+		t.Errorf("expected the user with a verified email, got %+v", signedIn)
+	}
+	if _, err := f.u.CompleteEmailLogin(ctx, user.Email, code); !errors.Is(err, apperror.ErrInvalidCode) {
+		t.Errorf("expected %v for a used code, got %v", apperror.ErrInvalidCode, err)
+	}
+}
+
+func TestEmailLoginAttemptsSurviveANewCode(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "jane@example.com"}
+	f := setup(t, false, user)
+
+	if err := f.u.StartEmailLogin(ctx, user.Email, userUsecase.EmailLoginCode); err != nil {
+		t.Fatalf("StartEmailLogin: %v", err)
+	}
+	wrong := "0000000"
+	for range 5 {
+		if _, err := f.u.CompleteEmailLogin(ctx, user.Email, wrong); !errors.Is(err, apperror.ErrInvalidCode) {
+			t.Fatalf("expected %v for a wrong code, got %v", apperror.ErrInvalidCode, err)
+		}
+	}
+
+	// Asking for a new code does not start the count over.
+	if err := f.u.StartEmailLogin(ctx, user.Email, userUsecase.EmailLoginCode); err != nil {
+		t.Fatalf("StartEmailLogin: %v", err)
+	}
+	if _, err := f.u.CompleteEmailLogin(ctx, user.Email, f.mailer.lastCode(t)); !errors.Is(err, apperror.ErrInvalidCode) {
+		t.Errorf("expected %v once the attempts are used up, got %v", apperror.ErrInvalidCode, err)
+	}
+}
+
+func TestEmailLoginRegistration(t *testing.T) {
+	ctx := context.Background()
+
+	// While registration is closed, unknown addresses get no email and no
+	// hint that they are unknown.
+	f := setup(t, false)
+	if err := f.u.StartEmailLogin(ctx, "new@example.com", userUsecase.EmailLoginCode); err != nil {
+		t.Errorf("expected an unknown address to be ignored silently, got %v", err)
+	}
+	if sent := f.mailer.sent(); len(sent) != 0 {
+		t.Errorf("expected no email for an unknown address, got %d", len(sent))
+	}
+
+	// Once it is open, the first sign-in creates a verified account.
+	f = setup(t, true)
+	if err := f.u.StartEmailLogin(ctx, "new@example.com", userUsecase.EmailLoginCode); err != nil {
+		t.Fatalf("StartEmailLogin: %v", err)
+	}
+	user, err := f.u.CompleteEmailLogin(ctx, "new@example.com", f.mailer.lastCode(t))
+	if err != nil {
+		t.Fatalf("CompleteEmailLogin: %v", err)
+	}
+	if user.ID == "" || user.Email != "new@example.com" || !user.EmailVerified {
+		t.Errorf("expected a new verified account, got %+v", user)
+	}
+}
@@ -0,0 +1,338 @@
+package useradmin
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// editableFields are the user columns an admin may set through Update.
+var editableFields = []string{"email", "email_verified", "name", "first_name", "last_name", "picture_url"}
+
+// UserAdminUsecase lets support staff manage other users' accounts. Every
+// method except Search records an audit event naming the acting admin.
+// Admins can also impersonate a user to see what they see.
+type UserAdminUsecase struct {
+	userRepo             repo.UserRepo
+	identityRepo         repo.IdentityRepo
+	auditEventRepo       repo.AuditEventRepo
+	sessionUsecase       usecase.SessionUsecase
+	roleUsecase          usecase.RoleUsecase
+	loginThrottleUsecase usecase.LoginThrottleUsecase
+}
+
+func NewUserAdminUsecase(userRepo repo.UserRepo, identityRepo repo.IdentityRepo, auditEventRepo repo.AuditEventRepo, sessionUsecase usecase.SessionUsecase, roleUsecase usecase.RoleUsecase, loginThrottleUsecase usecase.LoginThrottleUsecase) *UserAdminUsecase {
+	return &UserAdminUsecase{
+		userRepo:             userRepo,
+		identityRepo:         identityRepo,
+		auditEventRepo:       auditEventRepo,
+		sessionUsecase:       sessionUsecase,
+		roleUsecase:          roleUsecase,
+		loginThrottleUsecase: loginThrottleUsecase,
+	}
+}
+
+// Search returns a page of users whose email or name contains query. Pages
+// start at 1; a missing page size means DefaultPageSize.
+func (u *UserAdminUsecase) Search(ctx context.Context, query string, page, pageSize int) (*usecase.UserPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	pageSize = min(pageSize, MaxPageSize)
+	users, total, err := u.userRepo.Search(ctx, strings.TrimSpace(query), (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &usecase.UserPage{Users: users, Total: total, Page: page, PageSize: pageSize}, nil
+}
+
+// FindByID returns the user with their linked identities and active sessions.
+func (u *UserAdminUsecase) FindByID(ctx context.Context, actor *entity.Actor, id string) (*usecase.UserDetails, error) {
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := u.identityRepo.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := u.sessionUsecase.FindByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.record(ctx, actor, user.ID, entity.AuditEventAdminUserViewed, nil); err != nil {
+		return nil, err
+	}
+	return &usecase.UserDetails{User: user, Identities: identities, Sessions: sessions}, nil
+}
+
+// Update changes the user's profile. A new email is unverified unless
+// email_verified is set along with it.
+func (u *UserAdminUsecase) Update(ctx context.Context, actor *entity.Actor, id string, fields map[string]interface{}) (*entity.User, error) {
+	if len(fields) == 0 {
+		return nil, apperror.ErrInvalidData
+	}
+	for field := range fields {
+		if !slices.Contains(editableFields, field) {
+			return nil, apperror.ErrInvalidData
+		}
+	}
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if email, ok := fields["email"].(string); ok && !strings.EqualFold(email, user.Email) {
+		if _, err := u.userRepo.FindByEmail(ctx, email); err == nil {
+			return nil, apperror.ErrAlreadyExists
+		} else if !errors.Is(err, apperror.ErrRecordNotFound) {
+			return nil, err
+		}
+		if _, ok := fields["email_verified"]; !ok {
+			fields["email_verified"] = false
+		}
+	}
+	if verified, ok := fields["email_verified"].(bool); ok {
+		if !verified {
+			fields["email_verified_at"] = nil
+		} else if !user.EmailVerified {
+			fields["email_verified_at"] = time.Now()
+		}
+	}
+	changed := slices.Sorted(maps.Keys(fields))
+	user, err = u.userRepo.Update(ctx, user.ID, fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.record(ctx, actor, user.ID, entity.AuditEventAdminUserUpdated, map[string]string{
+		"fields": strings.Join(changed, ","),
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Disable stops the user from signing in and revokes their sessions. Their
+// API keys stop working until the user is enabled again.
+func (u *UserAdminUsecase) Disable(ctx context.Context, actor *entity.Actor, id string) (*entity.User, error) {
+	if actor.ID == id {
+		return nil, apperror.ErrOperationDenied
+	}
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Disabled {
+		if user, err = u.userRepo.Update(ctx, user.ID, map[string]interface{}{
+			"disabled":    true,
+			"disabled_at": time.Now(),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := u.sessionUsecase.RevokeByUserID(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if err := u.record(ctx, actor, user.ID, entity.AuditEventAdminUserDisabled, nil); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (u *UserAdminUsecase) Enable(ctx context.Context, actor *entity.Actor, id string) (*entity.User, error) {
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		if user, err = u.userRepo.Update(ctx, user.ID, map[string]interface{}{
+			"disabled":    false,
+			"disabled_at": nil,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := u.record(ctx, actor, user.ID, entity.AuditEventAdminUserEnabled, nil); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// RequirePasswordReset makes the user's next password login fail with a
+// reset link instead, until they set a new password.
+func (u *UserAdminUsecase) RequirePasswordReset(ctx context.Context, actor *entity.Actor, id string) (*entity.User, error) {
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user, err = u.userRepo.Update(ctx, user.ID, map[string]interface{}{
+		"password_reset_required": true,
+	}); err != nil {
+		return nil, err
+	}
+	if err := u.record(ctx, actor, user.ID, entity.AuditEventAdminPasswordResetForced, nil); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// RevokeSessions signs the user out of every device.
+func (u *UserAdminUsecase) RevokeSessions(ctx context.Context, actor *entity.Actor, id string) error {
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := u.sessionUsecase.RevokeByUserID(ctx, user.ID); err != nil {
+		return err
+	}
+	return u.record(ctx, actor, user.ID, entity.AuditEventAdminSessionsRevoked, nil)
+}
+
+// Unlock clears the failure counter, progressive delay and lock of the
+// user's email.
+func (u *UserAdminUsecase) Unlock(ctx context.Context, actor *entity.Actor, id string) error {
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := u.loginThrottleUsecase.Reset(ctx, user.Email); err != nil {
+		return err
+	}
+	return u.record(ctx, actor, user.ID, entity.AuditEventAdminUserUnlocked, nil)
+}
+
+// AssignRole gives the user a role. Their permissions change when their
+// access token is next refreshed.
+func (u *UserAdminUsecase) AssignRole(ctx context.Context, actor *entity.Actor, id, role string) error {
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := u.roleUsecase.Assign(ctx, user.ID, role); err != nil {
+		return err
+	}
+	return u.record(ctx, actor, user.ID, entity.AuditEventAdminRoleAssigned, map[string]string{
+		"role": role,
+	})
+}
+
+// UnassignRole takes a role away from the user. The last admin cannot lose
+// the admin role.
+func (u *UserAdminUsecase) UnassignRole(ctx context.Context, actor *entity.Actor, id, role string) error {
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := u.roleUsecase.Unassign(ctx, user.ID, role); err != nil {
+		return err
+	}
+	return u.record(ctx, actor, user.ID, entity.AuditEventAdminRoleUnassigned, map[string]string{
+		"role": role,
+	})
+}
+
+// Delete removes the user and everything they own. Their audit events are
+// kept.
+func (u *UserAdminUsecase) Delete(ctx context.Context, actor *entity.Actor, id string) error {
+	if actor.ID == id {
+		return apperror.ErrOperationDenied
+	}
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := u.sessionUsecase.RevokeByUserID(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := u.userRepo.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+	return u.record(ctx, actor, user.ID, entity.AuditEventAdminUserDeleted, map[string]string{
+		"email": user.Email,
+	})
+}
+
+// Impersonate starts a read-only session as the user for the admin, see
+// SessionUsecase.Impersonate.
+func (u *UserAdminUsecase) Impersonate(ctx context.Context, actor *entity.Actor, id string) (*entity.TokenPair, error) {
+	user, err := u.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := u.sessionUsecase.Impersonate(ctx, actor.ID, user.ID, actor.UserAgent, actor.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.record(ctx, actor, user.ID, entity.AuditEventImpersonationStarted, map[string]string{
+		"session_id": tokens.SessionID,
+		"expires_at": tokens.AccessTokenExpiresAt.UTC().Format(time.RFC3339),
+	}); err != nil {
+		u.sessionUsecase.Revoke(ctx, tokens.SessionID)
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// EndImpersonation revokes the impersonation session.
+func (u *UserAdminUsecase) EndImpersonation(ctx context.Context, actor *entity.Actor, userID, sessionID string) error {
+	if err := u.sessionUsecase.Revoke(ctx, sessionID); err != nil {
+		return err
+	}
+	return u.record(ctx, actor, userID, entity.AuditEventImpersonationEnded, map[string]string{
+		"session_id": sessionID,
+	})
+}
+
+// RecordImpersonatedRequest records a request the admin made as the user,
+// including ones refused because impersonation is read-only.
+func (u *UserAdminUsecase) RecordImpersonatedRequest(ctx context.Context, actor *entity.Actor, userID, sessionID, method, path string, blocked bool) error {
+	return u.record(ctx, actor, userID, entity.AuditEventImpersonatedRequest, map[string]string{
+		"session_id": sessionID,
+		"method":     method,
+		"path":       path,
+		"blocked":    strconv.FormatBool(blocked),
+	})
+}
+
+func (u *UserAdminUsecase) findUser(ctx context.Context, id string) (*entity.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, apperror.ErrRecordNotFound
+	}
+	return u.userRepo.FindByID(ctx, id)
+}
+
+// record stores an audit event of the actor's action on the user. The action
+// has already happened, so a failure is logged as well as returned.
+func (u *UserAdminUsecase) record(ctx context.Context, actor *entity.Actor, userID, eventType string, details map[string]string) error {
+	if err := u.auditEventRepo.Create(ctx, &entity.AuditEvent{
+		UserID:    userID,
+		ActorID:   &actor.ID,
+		ActorType: actor.Type,
+		Type:      eventType,
+		IPAddress: actor.IPAddress,
+		UserAgent: actor.UserAgent,
+		Details:   details,
+	}); err != nil {
+		log.Printf("failed to record %s by %s %s on user %s: %v", eventType, actor.Type, actor.ID, userID, err)
+		return err
+	}
+	return nil
+}
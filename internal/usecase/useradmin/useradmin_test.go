@@ -0,0 +1,329 @@
+package useradmin_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
+	"github.com/KimNattanan/go-user-service/internal/repo/repotest"
+	"github.com/KimNattanan/go-user-service/internal/usecase"
+	userAdminUsecase "github.com/KimNattanan/go-user-service/internal/usecase/useradmin"
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/google/uuid"
+)
+
+type fakeSessionUsecase struct {
+	usecase.SessionUsecase
+	revoked         []string // user IDs signed out everywhere
+	revokedSessions []string
+}
+
+func (u *fakeSessionUsecase) Impersonate(ctx context.Context, impersonatorID, userID, userAgent, ipAddress string) (*entity.TokenPair, error) {
+	return &entity.TokenPair{SessionID: "impersonation-1", AccessTokenExpiresAt: time.Now().Add(15 * time.Minute)}, nil
+}
+
+func (u *fakeSessionUsecase) Revoke(ctx context.Context, id string) error {
+	u.revokedSessions = append(u.revokedSessions, id)
+	return nil
+}
+
+func (u *fakeSessionUsecase) FindByUserID(ctx context.Context, userID string) ([]*entity.Session, error) {
+	return []*entity.Session{{ID: "session-1", UserID: userID}}, nil
+}
+
+func (u *fakeSessionUsecase) RevokeByUserID(ctx context.Context, userID string, exceptIDs ...string) error {
+	u.revoked = append(u.revoked, userID)
+	return nil
+}
+
+type fakeRoleUsecase struct {
+	usecase.RoleUsecase
+	roles map[string][]string // user ID -> role names
+}
+
+func (u *fakeRoleUsecase) Assign(ctx context.Context, userID, name string) error {
+	if name != "admin" && name != "support" {
+		return apperror.ErrRecordNotFound
+	}
+	u.roles[userID] = append(u.roles[userID], name)
+	return nil
+}
+
+func (u *fakeRoleUsecase) Unassign(ctx context.Context, userID, name string) error {
+	if name == "admin" {
+		return apperror.ErrLastAdmin
+	}
+	u.roles[userID] = slices.DeleteFunc(u.roles[userID], func(role string) bool { return role == name })
+	return nil
+}
+
+type fakeLoginThrottleUsecase struct {
+	usecase.LoginThrottleUsecase
+	reset []string
+}
+
+func (u *fakeLoginThrottleUsecase) Reset(ctx context.Context, email string) error {
+	u.reset = append(u.reset, email)
+	return nil
+}
+
+type fixture struct {
+	u        *userAdminUsecase.UserAdminUsecase
+	users    *repotest.UserRepo
+	audit    *repotest.AuditEventRepo
+	sessions *fakeSessionUsecase
+	roles    *fakeRoleUsecase
+	throttle *fakeLoginThrottleUsecase
+	admin    *entity.Actor
+}
+
+func setup(users ...*entity.User) *fixture {
+	f := &fixture{
+		users:    repotest.NewUserRepo(users...),
+		audit:    repotest.NewAuditEventRepo(),
+		sessions: &fakeSessionUsecase{},
+		roles:    &fakeRoleUsecase{roles: map[string][]string{}},
+		throttle: &fakeLoginThrottleUsecase{},
+		admin:    &entity.Actor{ID: uuid.NewString(), Type: "user", IPAddress: "203.0.113.7"},
+	}
+	f.u = userAdminUsecase.NewUserAdminUsecase(f.users, repotest.NewIdentityRepo(f.users), f.audit, f.sessions, f.roles, f.throttle)
+	return f
+}
+
+func TestActionsAreAuditedWithTheActor(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "jane@example.com"}
+	user.Identities = []entity.Identity{{ID: uuid.NewString(), UserID: user.ID, Provider: "google"}}
+	f := setup(user)
+
+	details, err := f.u.FindByID(ctx, f.admin, user.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if details.User != user || len(details.Identities) != 1 || len(details.Sessions) != 1 {
+		t.Errorf("expected the user with their identities and sessions, got %+v", details)
+	}
+	if _, err := f.u.Update(ctx, f.admin, user.ID, map[string]interface{}{"name": "Jane Doe"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := f.u.Disable(ctx, f.admin, user.ID); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	if !user.Disabled {
+		t.Error("expected the user to be disabled")
+	}
+	if _, err := f.u.Enable(ctx, f.admin, user.ID); err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	if user.Disabled {
+		t.Error("expected the user to be enabled again")
+	}
+	if _, err := f.u.RequirePasswordReset(ctx, f.admin, user.ID); err != nil {
+		t.Fatalf("RequirePasswordReset: %v", err)
+	}
+	if !user.PasswordResetRequired {
+		t.Error("expected a password reset to be required")
+	}
+	if err := f.u.RevokeSessions(ctx, f.admin, user.ID); err != nil {
+		t.Fatalf("RevokeSessions: %v", err)
+	}
+	if err := f.u.Unlock(ctx, f.admin, user.ID); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if !slices.Equal(f.throttle.reset, []string{user.Email}) {
+		t.Errorf("expected the login throttle of %s to be reset, got %v", user.Email, f.throttle.reset)
+	}
+	if err := f.u.AssignRole(ctx, f.admin, user.ID, "support"); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	if err := f.u.UnassignRole(ctx, f.admin, user.ID, "support"); err != nil {
+		t.Fatalf("UnassignRole: %v", err)
+	}
+	if err := f.u.Delete(ctx, f.admin, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := f.users.Users[user.ID]; ok {
+		t.Error("expected the user to be deleted")
+	}
+
+	// Disabling, revoking and deleting each sign the user out.
+	if len(f.sessions.revoked) != 3 {
+		t.Errorf("expected the sessions to be revoked 3 times, got %d", len(f.sessions.revoked))
+	}
+	var types []string
+	for _, event := range f.audit.Events() {
+		if event.UserID != user.ID || event.ActorID == nil || *event.ActorID != f.admin.ID || event.ActorType != "user" || event.IPAddress != f.admin.IPAddress {
+			t.Errorf("expected the event to name the user and the acting admin, got %+v", event)
+		}
+		types = append(types, event.Type)
+	}
+	want := []string{
+		entity.AuditEventAdminUserViewed,
+		entity.AuditEventAdminUserUpdated,
+		entity.AuditEventAdminUserDisabled,
+		entity.AuditEventAdminUserEnabled,
+		entity.AuditEventAdminPasswordResetForced,
+		entity.AuditEventAdminSessionsRevoked,
+		entity.AuditEventAdminUserUnlocked,
+		entity.AuditEventAdminRoleAssigned,
+		entity.AuditEventAdminRoleUnassigned,
+		entity.AuditEventAdminUserDeleted,
+	}
+	if !slices.Equal(types, want) {
+		t.Errorf("expected events %v, got %v", want, types)
+	}
+}
+
+func TestAdminCannotLockThemselvesOut(t *testing.T) {
+	ctx := context.Background()
+	f := setup()
+	f.users.Users[f.admin.ID] = &entity.User{ID: f.admin.ID, Email: "admin@example.com"}
+
+	if _, err := f.u.Disable(ctx, f.admin, f.admin.ID); !errors.Is(err, apperror.ErrOperationDenied) {
+		t.Errorf("expected %v when disabling yourself, got %v", apperror.ErrOperationDenied, err)
+	}
+	if err := f.u.Delete(ctx, f.admin, f.admin.ID); !errors.Is(err, apperror.ErrOperationDenied) {
+		t.Errorf("expected %v when deleting yourself, got %v", apperror.ErrOperationDenied, err)
+	}
+	if events := f.audit.Events(); len(events) != 0 {
+		t.Errorf("expected refused actions not to be recorded, got %d events", len(events))
+	}
+}
+
+func TestRoleChangesAreAudited(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "jane@example.com"}
+	f := setup(user)
+
+	if err := f.u.AssignRole(ctx, f.admin, user.ID, "support"); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	if !slices.Equal(f.roles.roles[user.ID], []string{"support"}) {
+		t.Errorf("expected the user to have the support role, got %v", f.roles.roles[user.ID])
+	}
+	if events := f.audit.Events(); len(events) != 1 || events[0].Details["role"] != "support" {
+		t.Errorf("expected the assignment to be recorded with the role, got %+v", events)
+	}
+
+	// Refused changes and unknown users are not recorded.
+	if err := f.u.AssignRole(ctx, f.admin, user.ID, "missing"); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for an unknown role, got %v", apperror.ErrRecordNotFound, err)
+	}
+	if err := f.u.UnassignRole(ctx, f.admin, user.ID, "admin"); !errors.Is(err, apperror.ErrLastAdmin) {
+		t.Errorf("expected %v for the last admin, got %v", apperror.ErrLastAdmin, err)
+	}
+	if err := f.u.AssignRole(ctx, f.admin, uuid.NewString(), "support"); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for an unknown user, got %v", apperror.ErrRecordNotFound, err)
+	}
+	if err := f.u.Unlock(ctx, f.admin, "not-a-uuid"); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for an invalid ID, got %v", apperror.ErrRecordNotFound, err)
+	}
+	if events := f.audit.Events(); len(events) != 1 {
+		t.Errorf("expected only the assignment to be recorded, got %d events", len(events))
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "jane@example.com", EmailVerified: true}
+	other := &entity.User{ID: uuid.NewString(), Email: "john@example.com"}
+	f := setup(user, other)
+
+	if _, err := f.u.Update(ctx, f.admin, user.ID, map[string]interface{}{"password": "hunter2"}); !errors.Is(err, apperror.ErrInvalidData) {
+		t.Errorf("expected %v for a field admins cannot set, got %v", apperror.ErrInvalidData, err)
+	}
+	if _, err := f.u.Update(ctx, f.admin, user.ID, map[string]interface{}{}); !errors.Is(err, apperror.ErrInvalidData) {
+		t.Errorf("expected %v for an empty update, got %v", apperror.ErrInvalidData, err)
+	}
+	if _, err := f.u.Update(ctx, f.admin, user.ID, map[string]interface{}{"email": other.Email}); !errors.Is(err, apperror.ErrAlreadyExists) {
+		t.Errorf("expected %v for an email in use, got %v", apperror.ErrAlreadyExists, err)
+	}
+	if _, err := f.u.Update(ctx, f.admin, "not-a-uuid", map[string]interface{}{"name": "Jane"}); !errors.Is(err, apperror.ErrRecordNotFound) {
+		t.Errorf("expected %v for an invalid ID, got %v", apperror.ErrRecordNotFound, err)
+	}
+
+	if _, err := f.u.Update(ctx, f.admin, user.ID, map[string]interface{}{"email": "jane.doe@example.com"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if user.Email != "jane.doe@example.com" || user.EmailVerified {
+		t.Errorf("expected the new email to be unverified, got %q verified=%v", user.Email, user.EmailVerified)
+	}
+	if events := f.audit.Events(); len(events) != 1 || !strings.Contains(events[0].Details["fields"], "email_verified") {
+		t.Errorf("expected one event listing the changed fields, got %+v", events)
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	ctx := context.Background()
+	users := []*entity.User{{ID: uuid.NewString(), Email: "john@example.com"}}
+	for i := range 105 {
+		users = append(users, &entity.User{ID: uuid.NewString(), Email: fmt.Sprintf("jane-%03d@example.com", i)})
+	}
+	f := setup(users...)
+
+	for _, tc := range []struct {
+		page, pageSize         int
+		wantPage, wantPageSize int
+		wantFirst              string
+		wantLen                int
+	}{
+		{0, 0, 1, userAdminUsecase.DefaultPageSize, "jane-000@example.com", userAdminUsecase.DefaultPageSize},
+		{3, 10, 3, 10, "jane-020@example.com", 10},
+		{2, 1000, 2, userAdminUsecase.MaxPageSize, "jane-100@example.com", 5},
+	} {
+		page, err := f.u.Search(ctx, "  JANE ", tc.page, tc.pageSize)
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if page.Page != tc.wantPage || page.PageSize != tc.wantPageSize || page.Total != 105 {
+			t.Errorf("page %d size %d: expected page %d size %d of 105, got %d %d of %d", tc.page, tc.pageSize, tc.wantPage, tc.wantPageSize, page.Page, page.PageSize, page.Total)
+		}
+		if len(page.Users) != tc.wantLen || page.Users[0].Email != tc.wantFirst {
+			t.Errorf("page %d size %d: expected %d users from %s, got %d", tc.page, tc.pageSize, tc.wantLen, tc.wantFirst, len(page.Users))
+		}
+	}
+}
+
+func TestImpersonationIsAudited(t *testing.T) {
+	ctx := context.Background()
+	user := &entity.User{ID: uuid.NewString(), Email: "jane@example.com"}
+	f := setup(user)
+
+	tokens, err := f.u.Impersonate(ctx, f.admin, user.ID)
+	if err != nil {
+		t.Fatalf("Impersonate: %v", err)
+	}
+	if err := f.u.RecordImpersonatedRequest(ctx, f.admin, user.ID, tokens.SessionID, "DELETE", "/api/v1/me", true); err != nil {
+		t.Fatalf("RecordImpersonatedRequest: %v", err)
+	}
+	if err := f.u.EndImpersonation(ctx, f.admin, user.ID, tokens.SessionID); err != nil {
+		t.Fatalf("EndImpersonation: %v", err)
+	}
+	if !slices.Equal(f.sessions.revokedSessions, []string{tokens.SessionID}) {
+		t.Errorf("expected the impersonation session to be revoked, got %v", f.sessions.revokedSessions)
+	}
+
+	var types []string
+	for _, event := range f.audit.Events() {
+		if event.UserID != user.ID || event.ActorID == nil || *event.ActorID != f.admin.ID || event.Details["session_id"] != tokens.SessionID {
+			t.Errorf("expected the event to name the user, the admin and the session, got %+v", event)
+		}
+		types = append(types, event.Type)
+	}
+	want := []string{
+		entity.AuditEventImpersonationStarted,
+		entity.AuditEventImpersonatedRequest,
+		entity.AuditEventImpersonationEnded,
+	}
+	if !slices.Equal(types, want) {
+		t.Errorf("expected events %v, got %v", want, types)
+	}
+	if details := f.audit.Events()[1].Details; details["method"] != "DELETE" || details["blocked"] != "true" {
+		t.Errorf("expected the blocked request to be recorded, got %v", details)
+	}
+}
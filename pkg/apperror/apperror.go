@@ -30,6 +30,27 @@ func NewAppError(code int, msg string, err error) *AppError {
 	}
 }
 
+// FieldError is one rule a request field failed.
+type FieldError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError carries field-level errors, keyed by the request's JSON
+// field name. It matches Err with errors.Is, so StatusCode still applies.
+type ValidationError struct {
+	Err    error
+	Fields map[string][]FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
 var (
 	// ------------------------
 	// Generic errors
@@ -69,20 +90,52 @@ var (
 	// ------------------------
 	// Validation errors
 	// ------------------------
-	ErrInvalidData   = errors.New("invalid data")           // 400
-	ErrInvalidID     = errors.New("invalid id")             // 400
-	ErrRequiredField = errors.New("required field missing") // 400
-	ErrInvalidFormat = errors.New("invalid format")         // 400
-	ErrOutOfRange    = errors.New("value out of range")     // 400
-	ErrUnprocessable = errors.New("unprocessable entity")   // 422
+	ErrInvalidData   = errors.New("invalid data")             // 400
+	ErrInvalidID     = errors.New("invalid id")               // 400
+	ErrRequiredField = errors.New("required field missing")   // 400
+	ErrInvalidFormat = errors.New("invalid format")           // 400
+	ErrOutOfRange    = errors.New("value out of range")       // 400
+	ErrUnprocessable = errors.New("unprocessable entity")     // 422
+	ErrInvalidToken  = errors.New("invalid or expired token") // 400
+	ErrInvalidCode   = errors.New("invalid code")             // 400
 
 	// ------------------------
 	// Business logic / domain-specific errors
 	// ------------------------
-	ErrAlreadyExists   = errors.New("already exists")   // 409
-	ErrNotAvailable    = errors.New("not available")    // 409
-	ErrLimitExceeded   = errors.New("limit exceeded")   // 429
-	ErrOperationDenied = errors.New("operation denied") // 403
+	ErrAlreadyExists         = errors.New("already exists")                                    // 409
+	ErrNotAvailable          = errors.New("not available")                                     // 409
+	ErrLimitExceeded         = errors.New("limit exceeded")                                    // 429
+	ErrOperationDenied       = errors.New("operation denied")                                  // 403
+	ErrEmailNotVerified      = errors.New("email not verified")                                // 403
+	ErrIncorrectPassword     = errors.New("incorrect password")                                // 403
+	ErrReauthRequired        = errors.New("recent login required")                             // 403
+	ErrRegistrationClosed    = errors.New("registration is closed")                            // 403
+	ErrIdentityNotLinked     = errors.New("email already registered, link the identity first") // 409
+	ErrIdentityInUse         = errors.New("identity is linked to another account")             // 409
+	ErrLastLoginMethod       = errors.New("cannot remove the last login method")               // 409
+	ErrUnknownProvider       = errors.New("unknown identity provider")                         // 404
+	ErrInvalidOAuthState     = errors.New("invalid oauth state")                               // 401
+	ErrAccessDenied          = errors.New("authorization denied by the identity provider")     // 401
+	ErrInvalidRedirect       = errors.New("redirect target not allowed")                       // 400
+	ErrAccountLocked         = errors.New("account temporarily locked")                        // 423
+	ErrTooManyAttempts       = errors.New("too many attempts, try again later")                // 429
+	ErrWeakPassword          = errors.New("password does not meet the policy")                 // 422
+	ErrSessionReused         = errors.New("refresh token reuse detected, sign in again")       // 401
+	ErrInvalidPermission     = errors.New("invalid permission")                                // 400
+	ErrBuiltInRole           = errors.New("built-in role cannot be changed")                   // 403
+	ErrLastAdmin             = errors.New("cannot remove the last admin")                      // 409
+	ErrAccountDisabled       = errors.New("account disabled")                                  // 403
+	ErrPasswordResetRequired = errors.New("password reset required, check your email")         // 403
+	ErrImpersonationReadOnly = errors.New("not allowed while impersonating")                   // 403
+
+	// ------------------------
+	// OAuth authorization server errors
+	// ------------------------
+	ErrInvalidClient           = errors.New("invalid client")            // 401
+	ErrInvalidGrant            = errors.New("invalid grant")             // 400
+	ErrInvalidScope            = errors.New("invalid scope")             // 400
+	ErrUnsupportedGrantType    = errors.New("unsupported grant type")    // 400
+	ErrUnsupportedResponseType = errors.New("unsupported response type") // 400
 
 	// ------------------------
 	// Other errors
@@ -100,17 +153,23 @@ func StatusCode(err error) int {
 		return http.StatusInternalServerError
 	case errors.Is(err, ErrTimeout):
 		return http.StatusGatewayTimeout
-	case errors.Is(err, ErrUnauthorized):
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrInvalidOAuthState), errors.Is(err, ErrAccessDenied),
+		errors.Is(err, ErrSessionReused), errors.Is(err, ErrInvalidClient):
 		return http.StatusUnauthorized
-	case errors.Is(err, ErrForbidden), errors.Is(err, ErrOperationDenied):
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrOperationDenied), errors.Is(err, ErrEmailNotVerified),
+		errors.Is(err, ErrIncorrectPassword), errors.Is(err, ErrReauthRequired), errors.Is(err, ErrRegistrationClosed),
+		errors.Is(err, ErrBuiltInRole), errors.Is(err, ErrAccountDisabled), errors.Is(err, ErrPasswordResetRequired),
+		errors.Is(err, ErrImpersonationReadOnly):
 		return http.StatusForbidden
 	case errors.Is(err, ErrNotImplemented):
 		return http.StatusNotImplemented
 
 	// Database / GORM errors
-	case errors.Is(err, ErrRecordNotFound):
+	case errors.Is(err, ErrRecordNotFound), errors.Is(err, ErrUnknownProvider):
 		return http.StatusNotFound
-	case errors.Is(err, ErrDuplicatedKey), errors.Is(err, ErrConflict), errors.Is(err, ErrAlreadyExists), errors.Is(err, ErrNotAvailable):
+	case errors.Is(err, ErrDuplicatedKey), errors.Is(err, ErrConflict), errors.Is(err, ErrAlreadyExists), errors.Is(err, ErrNotAvailable),
+		errors.Is(err, ErrIdentityNotLinked), errors.Is(err, ErrIdentityInUse), errors.Is(err, ErrLastLoginMethod),
+		errors.Is(err, ErrLastAdmin):
 		return http.StatusConflict
 	case errors.Is(err, ErrDependencyFail):
 		return http.StatusBadGateway
@@ -126,11 +185,16 @@ func StatusCode(err error) int {
 	// Validation / business logic
 	case errors.Is(err, ErrInvalidData), errors.Is(err, ErrInvalidID), errors.Is(err, ErrRequiredField),
 		errors.Is(err, ErrInvalidFormat), errors.Is(err, ErrOutOfRange), errors.Is(err, ErrInvalidValue),
-		errors.Is(err, ErrInvalidValueOfLength), errors.Is(err, ErrInvalidField):
+		errors.Is(err, ErrInvalidValueOfLength), errors.Is(err, ErrInvalidField),
+		errors.Is(err, ErrInvalidToken), errors.Is(err, ErrInvalidCode), errors.Is(err, ErrInvalidRedirect),
+		errors.Is(err, ErrInvalidGrant), errors.Is(err, ErrInvalidScope), errors.Is(err, ErrUnsupportedGrantType),
+		errors.Is(err, ErrUnsupportedResponseType), errors.Is(err, ErrInvalidPermission):
 		return http.StatusBadRequest
-	case errors.Is(err, ErrUnprocessable):
+	case errors.Is(err, ErrUnprocessable), errors.Is(err, ErrWeakPassword):
 		return http.StatusUnprocessableEntity
-	case errors.Is(err, ErrLimitExceeded):
+	case errors.Is(err, ErrAccountLocked):
+		return http.StatusLocked
+	case errors.Is(err, ErrLimitExceeded), errors.Is(err, ErrTooManyAttempts):
 		return http.StatusTooManyRequests
 
 	// Default
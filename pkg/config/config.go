@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -23,16 +25,110 @@ type Config struct {
 	RedisPassword string
 	RedisDB       int
 
-	JWTSecret      string
-	JWTExpiration  int // in seconds
-	SessionAuthKey string
-	SessionEncKey  string
+	JWTAlgorithm           string // RS256, ES256 or EdDSA, used for new signing keys
+	JWTKeyDir              string // PEM signing keys; generated keys are written here
+	JWTKeyRotationInterval int    // in seconds, 0 to disable
+	JWTIssuer              string
+	JWTExpiration          int // in seconds
+	SessionAuthKey         string
+	SessionEncKey          string
 
-	GoogleClientID     string
-	GoogleClientSecret string
-	GoogleRedirectURL  string
+	SessionRotationGracePeriod int // in seconds; a rotated refresh token still yields its successor
+	ImpersonationExpiration    int // in seconds; impersonation sessions cannot be extended
+
+	ResourceServers []ResourceServerConfig
+	OAuthLoginURL   string // where /oauth/authorize sends users who are not signed in, with return_to
+	OAuthConsentURL string // consent screen, called with consent_id
+
+	ServiceAccountTokenExpiration int // in seconds
+	ServiceAccountSecretOverlap   int // in seconds; how long a rotated secret keeps working
+
+	IdentityProviders      []IdentityProviderConfig
+	LoginRedirectAllowlist []string // origins, or origin + path prefixes, return_to may point to
+	LoginErrorURL          string   // where failed browser logins are sent, with an error code
+
+	MailDriver string
+	MailFrom   string
+	MailDir    string
+
+	EmailVerificationURL    string
+	EmailVerificationTTL    int // in seconds
+	EmailVerificationPolicy string
+
+	PasswordResetURL string
+	PasswordResetTTL int // in seconds
+	ReauthMaxAge     int // in seconds
+	RegistrationOpen bool
+
+	PasswordMinLength    int
+	PasswordMaxLength    int // in bytes
+	PasswordMinClasses   int // of lowercase, uppercase, digits and symbols
+	PasswordMinEntropy   int // in bits, 0 to disable
+	PasswordHistory      int // previous passwords that cannot be reused
+	PasswordBreachedFile string
+
+	PasswordHashAlgorithm     string // argon2id or bcrypt, used for new hashes
+	PasswordArgon2Memory      int    // in KiB
+	PasswordArgon2Iterations  int
+	PasswordArgon2Parallelism int
+	PasswordBcryptCost        int
+
+	LoginMaxFailures     int // failures within the window that lock the account
+	LoginDelayAfter      int // failures after which attempts are progressively delayed
+	LoginMaxDelay        int // in seconds
+	LoginFailureWindow   int // in seconds
+	LoginLockoutDuration int // in seconds
+	LoginIPMaxFailures   int // failures within the window that throttle a client IP
+	TrustProxyHeaders    bool
+	BootstrapAdminEmail  string
+
+	PasswordlessEnabled bool
+	PasswordlessURL     string
+	PasswordlessTTL     int // in seconds
+
+	MFAIssuer       string
+	MFAChallengeTTL int // in seconds
+
+	WebAuthnRPID         string
+	WebAuthnRPName       string
+	WebAuthnRPOrigins    []string
+	WebAuthnChallengeTTL int // in seconds
 }
 
+// IdentityProviderConfig configures one external login provider. Type is one
+// of the IdentityProvider* constants.
+type IdentityProviderConfig struct {
+	Name         string
+	Type         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	IssuerURL    string            // OIDC issuer, or the GitHub base URL
+	Scopes       []string          // replaces the provider's default scopes if set
+	Claims       map[string]string // normalized claim name -> provider claim name
+}
+
+// ResourceServerConfig holds the credentials a service uses to introspect
+// and revoke tokens.
+type ResourceServerConfig struct {
+	ID     string
+	Secret string
+}
+
+const (
+	IdentityProviderOIDC      = "oidc"
+	IdentityProviderGoogle    = "google"
+	IdentityProviderMicrosoft = "microsoft"
+	IdentityProviderGitHub    = "github"
+)
+
+// Email verification policies applied by the auth middleware to unverified users.
+const (
+	EmailVerificationOff   = "off"   // unverified users have full access
+	EmailVerificationLimit = "limit" // unverified users may only read
+	EmailVerificationBlock = "block" // unverified users are rejected
+)
+
 func LoadConfig(env string) *Config {
 	envFile := ".env"
 	if env != "" {
@@ -56,14 +152,74 @@ func LoadConfig(env string) *Config {
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
 		RedisDB:       getEnvAsInt("REDIS_DB", 0),
 
-		JWTSecret:      getEnv("JWT_SECRET", "secret"),
-		JWTExpiration:  getEnvAsInt("JWT_EXPIRATION", 60*60*24*7),
-		SessionAuthKey: getEnv("SESSION_AUTH_KEY", ""),
-		SessionEncKey:  getEnv("SESSION_ENC_KEY", ""),
+		JWTAlgorithm:           getEnv("JWT_ALGORITHM", "RS256"),
+		JWTKeyDir:              getEnv("JWT_KEY_DIR", "data/jwt-keys"),
+		JWTKeyRotationInterval: getEnvAsInt("JWT_KEY_ROTATION_INTERVAL", 60*60*24*30),
+		JWTIssuer:              getEnv("JWT_ISSUER", "http://localhost:8000"),
+		JWTExpiration:          getEnvAsInt("JWT_EXPIRATION", 60*60*24*7),
+		SessionAuthKey:         getEnv("SESSION_AUTH_KEY", ""),
+		SessionEncKey:          getEnv("SESSION_ENC_KEY", ""),
+
+		SessionRotationGracePeriod: getEnvAsInt("SESSION_ROTATION_GRACE_PERIOD", 10),
+		ImpersonationExpiration:    getEnvAsInt("IMPERSONATION_EXPIRATION", 900),
+
+		ResourceServers: loadResourceServers(getEnvAsSlice("RESOURCE_SERVERS", nil)),
+		OAuthLoginURL:   getEnv("OAUTH_LOGIN_URL", "http://localhost:3000/login"),
+		OAuthConsentURL: getEnv("OAUTH_CONSENT_URL", "http://localhost:3000/oauth/consent"),
+
+		ServiceAccountTokenExpiration: getEnvAsInt("SERVICE_ACCOUNT_TOKEN_EXPIRATION", 900),
+		ServiceAccountSecretOverlap:   getEnvAsInt("SERVICE_ACCOUNT_SECRET_OVERLAP", 86400),
+
+		IdentityProviders:      loadIdentityProviders(getEnvAsSlice("IDENTITY_PROVIDERS", []string{IdentityProviderGoogle})),
+		LoginRedirectAllowlist: getEnvAsSlice("LOGIN_REDIRECT_ALLOWLIST", []string{"http://localhost:3000"}),
+		LoginErrorURL:          getEnv("LOGIN_ERROR_URL", ""),
+
+		MailDriver: getEnv("MAIL_DRIVER", "log"),
+		MailFrom:   getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailDir:    getEnv("MAIL_DIR", "tmp/mail"),
+
+		EmailVerificationURL:    getEnv("EMAIL_VERIFICATION_URL", "http://localhost:3000/verify-email"),
+		EmailVerificationTTL:    getEnvAsInt("EMAIL_VERIFICATION_TTL", 60*60*24),
+		EmailVerificationPolicy: getEnv("EMAIL_VERIFICATION_POLICY", EmailVerificationOff),
+
+		PasswordResetURL: getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+		PasswordResetTTL: getEnvAsInt("PASSWORD_RESET_TTL", 60*30),
+		ReauthMaxAge:     getEnvAsInt("REAUTH_MAX_AGE", 60*10),
+		RegistrationOpen: getEnvAsBool("REGISTRATION_OPEN", true),
+
+		PasswordMinLength:    getEnvAsInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:    getEnvAsInt("PASSWORD_MAX_LENGTH", 72),
+		PasswordMinClasses:   getEnvAsInt("PASSWORD_MIN_CLASSES", 2),
+		PasswordMinEntropy:   getEnvAsInt("PASSWORD_MIN_ENTROPY", 0),
+		PasswordHistory:      getEnvAsInt("PASSWORD_HISTORY", 5),
+		PasswordBreachedFile: getEnv("PASSWORD_BREACHED_FILE", ""),
+
+		PasswordHashAlgorithm:     getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		PasswordArgon2Memory:      getEnvAsInt("PASSWORD_ARGON2_MEMORY", 19*1024),
+		PasswordArgon2Iterations:  getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", 2),
+		PasswordArgon2Parallelism: getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", 1),
+		PasswordBcryptCost:        getEnvAsInt("PASSWORD_BCRYPT_COST", 12),
 
-		GoogleClientID:     getEnv("GOOGLE_OAUTH_CLIENT_ID", ""),
-		GoogleClientSecret: getEnv("GOOGLE_OAUTH_CLIENT_SECRET", ""),
-		GoogleRedirectURL:  getEnv("GOOGLE_OAUTH_REDIRECT_URL", "http://localhost:8000/api/v1/auth/google/callback"),
+		LoginMaxFailures:     getEnvAsInt("LOGIN_MAX_FAILURES", 10),
+		LoginDelayAfter:      getEnvAsInt("LOGIN_DELAY_AFTER", 3),
+		LoginMaxDelay:        getEnvAsInt("LOGIN_MAX_DELAY", 30),
+		LoginFailureWindow:   getEnvAsInt("LOGIN_FAILURE_WINDOW", 60*15),
+		LoginLockoutDuration: getEnvAsInt("LOGIN_LOCKOUT_DURATION", 60*15),
+		LoginIPMaxFailures:   getEnvAsInt("LOGIN_IP_MAX_FAILURES", 100),
+		TrustProxyHeaders:    getEnvAsBool("TRUST_PROXY_HEADERS", false),
+		BootstrapAdminEmail:  getEnv("BOOTSTRAP_ADMIN_EMAIL", ""),
+
+		PasswordlessEnabled: getEnvAsBool("PASSWORDLESS_ENABLED", false),
+		PasswordlessURL:     getEnv("PASSWORDLESS_URL", "http://localhost:3000/login/email"),
+		PasswordlessTTL:     getEnvAsInt("PASSWORDLESS_TTL", 60*10),
+
+		MFAIssuer:       getEnv("MFA_ISSUER", "go-user-service"),
+		MFAChallengeTTL: getEnvAsInt("MFA_CHALLENGE_TTL", 60*5),
+
+		WebAuthnRPID:         getEnv("WEBAUTHN_RP_ID", "localhost"),
+		WebAuthnRPName:       getEnv("WEBAUTHN_RP_NAME", "go-user-service"),
+		WebAuthnRPOrigins:    getEnvAsSlice("WEBAUTHN_RP_ORIGINS", []string{"http://localhost:3000"}),
+		WebAuthnChallengeTTL: getEnvAsInt("WEBAUTHN_CHALLENGE_TTL", 60*5),
 	}
 	cfg.DBDSN = fmt.Sprintf(
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
@@ -73,6 +229,64 @@ func LoadConfig(env string) *Config {
 	return cfg
 }
 
+// loadResourceServers reads the RESOURCE_SERVER_<NAME>_SECRET variable for
+// every configured resource server.
+func loadResourceServers(names []string) []ResourceServerConfig {
+	servers := make([]ResourceServerConfig, 0, len(names))
+	for _, name := range names {
+		prefix := "RESOURCE_SERVER_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		servers = append(servers, ResourceServerConfig{
+			ID:     name,
+			Secret: getEnv(prefix+"SECRET", ""),
+		})
+	}
+	return servers
+}
+
+// loadIdentityProviders reads OAUTH_<NAME>_* variables for every enabled
+// provider. The Google client also falls back to the older GOOGLE_OAUTH_*
+// variables.
+func loadIdentityProviders(names []string) []IdentityProviderConfig {
+	providers := make([]IdentityProviderConfig, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		prefix := "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		providerType := name
+		switch name {
+		case IdentityProviderGoogle, IdentityProviderMicrosoft, IdentityProviderGitHub:
+		default:
+			providerType = IdentityProviderOIDC
+		}
+		clientID, clientSecret := "", ""
+		redirectURL := "http://localhost:8000/api/v1/auth/" + name + "/callback"
+		if name == IdentityProviderGoogle {
+			clientID = getEnv("GOOGLE_OAUTH_CLIENT_ID", "")
+			clientSecret = getEnv("GOOGLE_OAUTH_CLIENT_SECRET", "")
+			redirectURL = getEnv("GOOGLE_OAUTH_REDIRECT_URL", redirectURL)
+		}
+
+		claims := map[string]string{}
+		for _, pair := range getEnvAsSlice(prefix+"CLAIMS", nil) {
+			if field, claim, ok := strings.Cut(pair, ":"); ok {
+				claims[strings.TrimSpace(field)] = strings.TrimSpace(claim)
+			}
+		}
+
+		providers = append(providers, IdentityProviderConfig{
+			Name:         name,
+			Type:         getEnv(prefix+"TYPE", providerType),
+			ClientID:     getEnv(prefix+"CLIENT_ID", clientID),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", clientSecret),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", redirectURL),
+			IssuerURL:    getEnv(prefix+"ISSUER_URL", ""),
+			Scopes:       getEnvAsSlice(prefix+"SCOPES", nil),
+			Claims:       claims,
+		})
+	}
+	return providers
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -90,3 +304,26 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := strconv.ParseBool(valueStr); err == nil {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsSlice reads a comma separated list.
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		var values []string
+		for _, value := range strings.Split(valueStr, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+	return defaultValue
+}
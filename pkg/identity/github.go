@@ -0,0 +1,126 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"golang.org/x/oauth2"
+)
+
+// githubProvider signs in with GitHub OAuth apps. GitHub is not an OpenID
+// provider, so the profile comes from the REST API instead of an ID token.
+type githubProvider struct {
+	name   string
+	apiURL string
+	config oauth2.Config
+	claims claimMapping
+}
+
+// newGitHubProvider uses IssuerURL as the GitHub base URL, which allows
+// GitHub Enterprise Server instances.
+func newGitHubProvider(cfg config.IdentityProviderConfig) *githubProvider {
+	baseURL := strings.TrimSuffix(cfg.IssuerURL, "/")
+	apiURL := baseURL + "/api/v3"
+	if baseURL == "" || baseURL == "https://github.com" {
+		baseURL = "https://github.com"
+		apiURL = "https://api.github.com"
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+	return &githubProvider{
+		name:   cfg.Name,
+		apiURL: apiURL,
+		config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  baseURL + "/login/oauth/authorize",
+				TokenURL: baseURL + "/login/oauth/access_token",
+			},
+		},
+		claims: newClaimMapping(map[string]string{
+			"subject": "id",
+			"picture": "avatar_url",
+		}, cfg.Claims),
+	}
+}
+
+func (p *githubProvider) Name() string {
+	return p.name
+}
+
+// AuthCodeURL uses PKCE only; without an ID token there is nothing to bind a
+// nonce to.
+func (p *githubProvider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	return p.config.AuthCodeURL(req.State, oauth2.S256ChallengeOption(req.CodeVerifier)), nil
+}
+
+func (p *githubProvider) Exchange(ctx context.Context, code string, req *AuthRequest) (*Claims, *oauth2.Token, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(req.CodeVerifier))
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := p.profile(ctx, p.config.Client(ctx, token))
+	if err != nil {
+		return nil, nil, err
+	}
+	return claims, token, nil
+}
+
+// Refresh only works for GitHub apps with expiring user tokens; OAuth apps
+// never receive a refresh token.
+func (p *githubProvider) Refresh(ctx context.Context, refreshToken string) (*Claims, error) {
+	if refreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+	return p.profile(ctx, p.config.Client(ctx, &oauth2.Token{RefreshToken: refreshToken}))
+}
+
+// profile reads the user and replaces the public email with the primary
+// address, which is the only one GitHub reports as verified.
+func (p *githubProvider) profile(ctx context.Context, client *http.Client) (*Claims, error) {
+	var user map[string]interface{}
+	if err := p.get(ctx, client, "/user", &user); err != nil {
+		return nil, err
+	}
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.get(ctx, client, "/user/emails", &emails); err != nil {
+		return nil, err
+	}
+	user["email"], user["email_verified"] = nil, false
+	for _, email := range emails {
+		if email.Primary {
+			user["email"], user["email_verified"] = email.Email, email.Verified
+		}
+	}
+	return p.claims.apply(p.name, user), nil
+}
+
+func (p *githubProvider) get(ctx context.Context, client *http.Client, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("github %s: %s", path, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,157 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"golang.org/x/oauth2"
+)
+
+// Claims is the provider independent profile of an external account.
+type Claims struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	GivenName     string
+	FamilyName    string
+	Picture       string
+}
+
+// AuthRequest holds the per-login secrets of one authorization code flow: the
+// state, the PKCE code verifier and the OIDC nonce.
+type AuthRequest struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+}
+
+func NewAuthRequest() *AuthRequest {
+	return &AuthRequest{
+		State:        rand.Text(),
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        rand.Text(),
+	}
+}
+
+// Provider runs the OAuth 2.0 authorization code flow against one external
+// identity provider and maps its profile onto Claims.
+type Provider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error)
+	// Exchange redeems an authorization code issued for req. The returned
+	// token may carry a refresh token that can later be passed to Refresh.
+	Exchange(ctx context.Context, code string, req *AuthRequest) (*Claims, *oauth2.Token, error)
+	Refresh(ctx context.Context, refreshToken string) (*Claims, error)
+}
+
+var (
+	ErrNoRefreshToken = errors.New("no refresh token")
+	ErrInvalidNonce   = errors.New("id_token nonce mismatch")
+)
+
+// Registry holds the configured providers by name.
+type Registry map[string]Provider
+
+func NewRegistry(configs []config.IdentityProviderConfig) (Registry, error) {
+	registry := make(Registry, len(configs))
+	for _, cfg := range configs {
+		provider, err := New(cfg)
+		if err != nil {
+			return nil, err
+		}
+		registry[cfg.Name] = provider
+	}
+	return registry, nil
+}
+
+func (r Registry) Get(name string) (Provider, error) {
+	provider, ok := r[name]
+	if !ok {
+		return nil, apperror.ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// New builds the adapter for cfg.Type. Provider metadata is discovered lazily,
+// so an unreachable provider does not keep the service from starting.
+func New(cfg config.IdentityProviderConfig) (Provider, error) {
+	switch cfg.Type {
+	case config.IdentityProviderOIDC:
+		if cfg.IssuerURL == "" {
+			return nil, fmt.Errorf("identity provider %q: issuer url is required", cfg.Name)
+		}
+		return newOIDCProvider(cfg, oidcOptions{}), nil
+	case config.IdentityProviderGoogle:
+		return newGoogleProvider(cfg), nil
+	case config.IdentityProviderMicrosoft:
+		return newMicrosoftProvider(cfg), nil
+	case config.IdentityProviderGitHub:
+		return newGitHubProvider(cfg), nil
+	default:
+		return nil, fmt.Errorf("identity provider %q: unsupported type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// claimMapping resolves normalized claim names to the provider's claim names.
+type claimMapping map[string]string
+
+func newClaimMapping(defaults, overrides map[string]string) claimMapping {
+	mapping := claimMapping{
+		"subject":        "sub",
+		"email":          "email",
+		"email_verified": "email_verified",
+		"name":           "name",
+		"given_name":     "given_name",
+		"family_name":    "family_name",
+		"picture":        "picture",
+	}
+	for field, claim := range defaults {
+		mapping[field] = claim
+	}
+	for field, claim := range overrides {
+		mapping[field] = claim
+	}
+	return mapping
+}
+
+func (m claimMapping) apply(provider string, raw map[string]interface{}) *Claims {
+	return &Claims{
+		Provider:      provider,
+		Subject:       stringClaim(raw[m["subject"]]),
+		Email:         stringClaim(raw[m["email"]]),
+		EmailVerified: boolClaim(raw[m["email_verified"]]),
+		Name:          stringClaim(raw[m["name"]]),
+		GivenName:     stringClaim(raw[m["given_name"]]),
+		FamilyName:    stringClaim(raw[m["family_name"]]),
+		Picture:       stringClaim(raw[m["picture"]]),
+	}
+}
+
+func stringClaim(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64: // numeric ids, e.g. GitHub
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return ""
+	}
+}
+
+// boolClaim also accepts "true", which some providers send for email_verified.
+func boolClaim(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
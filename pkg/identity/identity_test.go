@@ -0,0 +1,326 @@
+package identity_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/identity"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "test-client"
+	testRedirectURL = "http://localhost:8000/api/v1/auth/stub/callback"
+)
+
+// stubOIDCServer is a minimal OpenID provider that accepts a single
+// authorization code and signs ID tokens with its own RSA key. Once an
+// authorization request has been recorded with authorize, the code is only
+// redeemed with the matching PKCE verifier and the ID token carries its nonce.
+type stubOIDCServer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	code      string
+	audience  string
+	challenge string
+	nonce     string
+}
+
+// authorize records the PKCE challenge and nonce the way the provider would
+// when the user is sent to authURL.
+func (s *stubOIDCServer) authorize(t *testing.T, authURL string) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Errorf("expected an S256 code challenge, got %q", query.Get("code_challenge_method"))
+	}
+	s.challenge = query.Get("code_challenge")
+	s.nonce = query.Get("nonce")
+}
+
+func (s *stubOIDCServer) verifierMatches(verifier string) bool {
+	if s.challenge == "" {
+		return true
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == s.challenge
+}
+
+func newStubOIDCServer(t *testing.T) *stubOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubOIDCServer{key: key, code: "good-code", audience: testClientID}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                s.URL,
+			"authorization_endpoint":                s.URL + "/authorize",
+			"token_endpoint":                        s.URL + "/token",
+			"userinfo_endpoint":                     s.URL + "/userinfo",
+			"jwks_uri":                              s.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "stub",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch {
+		case r.Form.Get("grant_type") == "authorization_code" && r.Form.Get("code") == s.code && s.verifierMatches(r.Form.Get("code_verifier")):
+		case r.Form.Get("grant_type") == "refresh_token" && r.Form.Get("refresh_token") == "refresh-token":
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-token",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh-token",
+			"id_token":      s.idToken(t),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":         "user-1",
+			"email":       "stub@example.com",
+			"name":        "Updated Name",
+			"given_name":  "Updated",
+			"family_name": "Name",
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubOIDCServer) idToken(t *testing.T) string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.URL,
+		"sub":            "user-1",
+		"aud":            s.audience,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"email":          "stub@example.com",
+		"email_verified": true,
+		"name":           "Stub User",
+		"given_name":     "Stub",
+		"family_name":    "User",
+		"picture":        "http://example.com/pic.jpg",
+	}
+	if s.nonce != "" {
+		claims["nonce"] = s.nonce
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "stub"
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newStubProvider(t *testing.T, issuerURL string) identity.Provider {
+	provider, err := identity.New(config.IdentityProviderConfig{
+		Name:         "stub",
+		Type:         config.IdentityProviderOIDC,
+		ClientID:     testClientID,
+		ClientSecret: "secret",
+		RedirectURL:  testRedirectURL,
+		IssuerURL:    issuerURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestOIDCProvider(t *testing.T) {
+	ctx := context.Background()
+	server := newStubOIDCServer(t)
+	provider := newStubProvider(t, server.URL)
+
+	req := identity.NewAuthRequest()
+	authURL, err := provider.AuthCodeURL(ctx, req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	if !strings.HasPrefix(authURL, server.URL+"/authorize") ||
+		parsed.Query().Get("state") != req.State ||
+		parsed.Query().Get("nonce") != req.Nonce ||
+		parsed.Query().Get("client_id") != testClientID ||
+		parsed.Query().Get("redirect_uri") != testRedirectURL {
+		t.Errorf("unexpected auth url %s", authURL)
+	}
+	server.authorize(t, authURL)
+
+	claims, token, err := provider.Exchange(ctx, "good-code", req)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := identity.Claims{
+		Provider:      "stub",
+		Subject:       "user-1",
+		Email:         "stub@example.com",
+		EmailVerified: true,
+		Name:          "Stub User",
+		GivenName:     "Stub",
+		FamilyName:    "User",
+		Picture:       "http://example.com/pic.jpg",
+	}
+	if *claims != want {
+		t.Errorf("expected %+v, got %+v", want, *claims)
+	}
+	if token.RefreshToken != "refresh-token" {
+		t.Errorf("expected refresh token, got %q", token.RefreshToken)
+	}
+
+	claims, err = provider.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if claims.Name != "Updated Name" || claims.Subject != "user-1" {
+		t.Errorf("unexpected refreshed claims %+v", *claims)
+	}
+
+	if _, _, err := provider.Exchange(ctx, "bad-code", req); err == nil {
+		t.Error("expected an error for an unknown code")
+	}
+	wrongVerifier := *req
+	wrongVerifier.CodeVerifier = identity.NewAuthRequest().CodeVerifier
+	if _, _, err := provider.Exchange(ctx, "good-code", &wrongVerifier); err == nil {
+		t.Error("expected an error for a code redeemed with the wrong PKCE verifier")
+	}
+	wrongNonce := *req
+	wrongNonce.Nonce = "replayed-nonce"
+	if _, _, err := provider.Exchange(ctx, "good-code", &wrongNonce); !errors.Is(err, identity.ErrInvalidNonce) {
+		t.Errorf("expected %v for an ID token with another nonce, got %v", identity.ErrInvalidNonce, err)
+	}
+	server.audience = "someone-else"
+	if _, _, err := provider.Exchange(ctx, "good-code", req); err == nil {
+		t.Error("expected an error for an ID token issued to another client")
+	}
+}
+
+func TestOIDCProviderClaimMapping(t *testing.T) {
+	server := newStubOIDCServer(t)
+	provider, err := identity.New(config.IdentityProviderConfig{
+		Name:      "stub",
+		Type:      config.IdentityProviderOIDC,
+		ClientID:  testClientID,
+		IssuerURL: server.URL,
+		Claims:    map[string]string{"name": "given_name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := identity.NewAuthRequest()
+	authURL, err := provider.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	server.authorize(t, authURL)
+	claims, _, err := provider.Exchange(context.Background(), "good-code", req)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Name != "Stub" {
+		t.Errorf("expected mapped name %q, got %q", "Stub", claims.Name)
+	}
+}
+
+func TestGitHubProvider(t *testing.T) {
+	mux := http.NewServeMux()
+	req := identity.NewAuthRequest()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code_verifier") != req.CodeVerifier {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gh-token", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":         12345,
+			"login":      "octocat",
+			"name":       "The Octocat",
+			"email":      "public@example.com",
+			"avatar_url": "http://example.com/octocat.png",
+		})
+	})
+	mux.HandleFunc("/api/v3/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "public@example.com", "primary": false, "verified": false},
+			{"email": "octocat@example.com", "primary": true, "verified": true},
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	provider, err := identity.New(config.IdentityProviderConfig{
+		Name:      "github",
+		Type:      config.IdentityProviderGitHub,
+		ClientID:  testClientID,
+		IssuerURL: server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _, err := provider.Exchange(context.Background(), "code", req)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "12345" || claims.Email != "octocat@example.com" || !claims.EmailVerified || claims.Picture != "http://example.com/octocat.png" {
+		t.Errorf("unexpected claims %+v", *claims)
+	}
+}
+
+func TestNewRejectsUnknownType(t *testing.T) {
+	if _, err := identity.New(config.IdentityProviderConfig{Name: "x", Type: "saml"}); err == nil {
+		t.Error("expected an error for an unsupported provider type")
+	}
+	if _, err := identity.New(config.IdentityProviderConfig{Name: "x", Type: config.IdentityProviderOIDC}); err == nil {
+		t.Error("expected an error for an OIDC provider without issuer")
+	}
+}
@@ -0,0 +1,210 @@
+package identity
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrMissingIDToken = errors.New("id_token missing")
+
+type oidcOptions struct {
+	defaultIssuer   string
+	defaultScopes   []string
+	claims          map[string]string
+	authParams      []oauth2.AuthCodeOption
+	expectedIssuer  string // issuer to expect when it differs from the discovery URL
+	skipIssuerCheck bool
+}
+
+// oidcProvider is a generic OpenID Connect relying party. Endpoints and keys
+// come from the issuer's discovery document on first use.
+type oidcProvider struct {
+	name       string
+	issuerURL  string
+	options    oidcOptions
+	claims     claimMapping
+	authParams []oauth2.AuthCodeOption
+
+	mu       sync.Mutex
+	config   oauth2.Config
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+func newOIDCProvider(cfg config.IdentityProviderConfig, options oidcOptions) *oidcProvider {
+	issuerURL := cfg.IssuerURL
+	if issuerURL == "" {
+		issuerURL = options.defaultIssuer
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = options.defaultScopes
+	}
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	return &oidcProvider{
+		name:       cfg.Name,
+		issuerURL:  issuerURL,
+		options:    options,
+		claims:     newClaimMapping(options.claims, cfg.Claims),
+		authParams: options.authParams,
+		config: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+		},
+	}
+}
+
+func newGoogleProvider(cfg config.IdentityProviderConfig) *oidcProvider {
+	return newOIDCProvider(cfg, oidcOptions{
+		defaultIssuer: "https://accounts.google.com",
+		authParams: []oauth2.AuthCodeOption{
+			oauth2.AccessTypeOffline,
+			oauth2.SetAuthURLParam("prompt", "select_account"),
+		},
+	})
+}
+
+// Multi-tenant Microsoft endpoints issue tokens under the user's own tenant.
+var microsoftTenantIssuers = map[string]string{
+	"common":        "https://login.microsoftonline.com/{tenantid}/v2.0",
+	"organizations": "https://login.microsoftonline.com/{tenantid}/v2.0",
+	"consumers":     "https://login.microsoftonline.com/9188040d-6c67-4c5b-b112-36a304b66dad/v2.0",
+}
+
+// newMicrosoftProvider signs in with the Microsoft identity platform. Entra ID
+// only asserts ownership of an email through the optional xms_edov claim, so
+// it must be enabled on the app registration for logins to be accepted.
+func newMicrosoftProvider(cfg config.IdentityProviderConfig) *oidcProvider {
+	options := oidcOptions{
+		defaultIssuer: "https://login.microsoftonline.com/common/v2.0",
+		defaultScopes: []string{oidc.ScopeOpenID, "email", "profile", oidc.ScopeOfflineAccess},
+		claims:        map[string]string{"email_verified": "xms_edov"},
+	}
+	issuerURL := cfg.IssuerURL
+	if issuerURL == "" {
+		issuerURL = options.defaultIssuer
+	}
+	for tenant, issuer := range microsoftTenantIssuers {
+		if strings.Contains(issuerURL, "/"+tenant+"/") {
+			options.expectedIssuer = issuer
+			options.skipIssuerCheck = true
+		}
+	}
+	return newOIDCProvider(cfg, options)
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+// discover loads the provider metadata once and returns the completed client config.
+func (p *oidcProvider) discover(ctx context.Context) (*oauth2.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider == nil {
+		// the remote key set keeps using this context after the request ends
+		ctx = context.WithoutCancel(ctx)
+		if p.options.expectedIssuer != "" {
+			ctx = oidc.InsecureIssuerURLContext(ctx, p.options.expectedIssuer)
+		}
+		provider, err := oidc.NewProvider(ctx, p.issuerURL)
+		if err != nil {
+			return nil, err
+		}
+		p.provider = provider
+		p.verifier = provider.Verifier(&oidc.Config{
+			ClientID:        p.config.ClientID,
+			SkipIssuerCheck: p.options.skipIssuerCheck,
+		})
+		p.config.Endpoint = provider.Endpoint()
+	}
+	config := p.config
+	return &config, nil
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(req.State, slices.Concat(p.authParams, []oauth2.AuthCodeOption{
+		oauth2.S256ChallengeOption(req.CodeVerifier),
+		oidc.Nonce(req.Nonce),
+	})...), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code string, req *AuthRequest) (*Claims, *oauth2.Token, error) {
+	config, err := p.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(req.CodeVerifier))
+	if err != nil {
+		return nil, nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, ErrMissingIDToken
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(req.Nonce)) != 1 {
+		return nil, nil, ErrInvalidNonce
+	}
+	var raw map[string]interface{}
+	if err := idToken.Claims(&raw); err != nil {
+		return nil, nil, err
+	}
+	// some providers keep the profile out of the ID token
+	if _, ok := raw[p.claims["email"]]; !ok && p.provider.UserInfoEndpoint() != "" {
+		if info, err := p.userInfo(ctx, config.TokenSource(ctx, token)); err == nil && info[p.claims["subject"]] == raw[p.claims["subject"]] {
+			for claim, value := range info {
+				if _, ok := raw[claim]; !ok {
+					raw[claim] = value
+				}
+			}
+		}
+	}
+	return p.claims.apply(p.name, raw), token, nil
+}
+
+func (p *oidcProvider) Refresh(ctx context.Context, refreshToken string) (*Claims, error) {
+	if refreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+	config, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := p.userInfo(ctx, config.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}))
+	if err != nil {
+		return nil, err
+	}
+	return p.claims.apply(p.name, raw), nil
+}
+
+func (p *oidcProvider) userInfo(ctx context.Context, source oauth2.TokenSource) (map[string]interface{}, error) {
+	info, err := p.provider.UserInfo(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := info.Claims(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
@@ -0,0 +1,169 @@
+// Package passwordhash hashes and verifies passwords with argon2id or bcrypt.
+//
+// Argon2id hashes use the PHC string format
+// ($argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>); bcrypt hashes keep their
+// native $2a$/$2b$/$2y$ form, so hashes written before this package existed
+// still verify. The algorithm and parameters used for new hashes are
+// configurable, and NeedsRehash tells whether a stored hash is outdated.
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash    = errors.New("malformed password hash")
+)
+
+type argon2Params struct {
+	memory      uint32 // in KiB
+	iterations  uint32
+	parallelism uint8
+	keyLength   uint32
+}
+
+type Hasher struct {
+	algorithm  string
+	argon2     argon2Params
+	bcryptCost int
+}
+
+func NewHasher(cfg *config.Config) (*Hasher, error) {
+	h := &Hasher{
+		algorithm: cfg.PasswordHashAlgorithm,
+		argon2: argon2Params{
+			memory:      uint32(cfg.PasswordArgon2Memory),
+			iterations:  uint32(cfg.PasswordArgon2Iterations),
+			parallelism: uint8(cfg.PasswordArgon2Parallelism),
+			keyLength:   argon2KeyLength,
+		},
+		bcryptCost: cfg.PasswordBcryptCost,
+	}
+	switch h.algorithm {
+	case AlgorithmArgon2id:
+		if h.argon2.memory == 0 || h.argon2.iterations == 0 || h.argon2.parallelism == 0 {
+			return nil, fmt.Errorf("invalid argon2id parameters m=%d,t=%d,p=%d", h.argon2.memory, h.argon2.iterations, h.argon2.parallelism)
+		}
+	case AlgorithmBcrypt:
+		if h.bcryptCost < bcrypt.MinCost || h.bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("invalid bcrypt cost %d", h.bcryptCost)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, h.algorithm)
+	}
+	return h, nil
+}
+
+// Hash encodes password with the configured algorithm and parameters.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon2.iterations, h.argon2.memory, h.argon2.parallelism, h.argon2.keyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.argon2.memory, h.argon2.iterations, h.argon2.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether password matches encoded, whichever supported
+// algorithm produced it. An empty hash never matches.
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	switch {
+	case encoded == "":
+		return false, nil
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, params.keyLength)
+		return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+	default:
+		return false, ErrUnknownAlgorithm
+	}
+}
+
+// NeedsRehash reports whether encoded was produced with another algorithm
+// or other parameters than the ones currently configured.
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	switch {
+	case isBcrypt(encoded):
+		if h.algorithm != AlgorithmBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.bcryptCost
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		if h.algorithm != AlgorithmArgon2id {
+			return true
+		}
+		params, _, _, err := decodeArgon2id(encoded)
+		return err != nil || params != h.argon2
+	default:
+		return true
+	}
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func decodeArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	params.keyLength = uint32(len(key))
+	return params, salt, key, nil
+}
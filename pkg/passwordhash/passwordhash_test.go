@@ -0,0 +1,98 @@
+package passwordhash_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/passwordhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newHasher(t *testing.T, algorithm string, bcryptCost, argon2Memory int) *passwordhash.Hasher {
+	hasher, err := passwordhash.NewHasher(&config.Config{
+		PasswordHashAlgorithm:     algorithm,
+		PasswordArgon2Memory:      argon2Memory,
+		PasswordArgon2Iterations:  1,
+		PasswordArgon2Parallelism: 1,
+		PasswordBcryptCost:        bcryptCost,
+	})
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return hasher
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{passwordhash.AlgorithmArgon2id, passwordhash.AlgorithmBcrypt} {
+		t.Run(algorithm, func(t *testing.T) {
+			hasher := newHasher(t, algorithm, bcrypt.MinCost, 1024)
+			hash, err := hasher.Hash("correct-Horse-battery")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if algorithm == passwordhash.AlgorithmArgon2id && !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+				t.Errorf("unexpected PHC string %q", hash)
+			}
+			if ok, err := hasher.Verify("correct-Horse-battery", hash); err != nil || !ok {
+				t.Errorf("expected the password to verify, got %v, %v", ok, err)
+			}
+			if ok, err := hasher.Verify("wrong-password", hash); err != nil || ok {
+				t.Errorf("expected a mismatch, got %v, %v", ok, err)
+			}
+			if hasher.NeedsRehash(hash) {
+				t.Error("expected a fresh hash not to need a rehash")
+			}
+		})
+	}
+}
+
+func TestVerifyLegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct-Horse-battery"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher := newHasher(t, passwordhash.AlgorithmArgon2id, bcrypt.MinCost, 1024)
+	if ok, err := hasher.Verify("correct-Horse-battery", string(legacy)); err != nil || !ok {
+		t.Errorf("expected a legacy bcrypt hash to verify, got %v, %v", ok, err)
+	}
+	if !hasher.NeedsRehash(string(legacy)) {
+		t.Error("expected a bcrypt hash to need a rehash when argon2id is configured")
+	}
+	if ok, _ := hasher.Verify("correct-Horse-battery", ""); ok {
+		t.Error("expected an empty hash never to verify")
+	}
+	if _, err := hasher.Verify("correct-Horse-battery", "$md5$abc"); err == nil {
+		t.Error("expected an error for an unknown hash format")
+	}
+}
+
+func TestNeedsRehashOnParameterChange(t *testing.T) {
+	argon2Hash, err := newHasher(t, passwordhash.AlgorithmArgon2id, bcrypt.MinCost, 1024).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !newHasher(t, passwordhash.AlgorithmArgon2id, bcrypt.MinCost, 2048).NeedsRehash(argon2Hash) {
+		t.Error("expected a rehash after raising the argon2id memory cost")
+	}
+	if !newHasher(t, passwordhash.AlgorithmBcrypt, bcrypt.MinCost, 1024).NeedsRehash(argon2Hash) {
+		t.Error("expected a rehash after switching to bcrypt")
+	}
+
+	bcryptHash, err := newHasher(t, passwordhash.AlgorithmBcrypt, bcrypt.MinCost, 1024).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !newHasher(t, passwordhash.AlgorithmBcrypt, bcrypt.MinCost+1, 1024).NeedsRehash(bcryptHash) {
+		t.Error("expected a rehash after raising the bcrypt cost")
+	}
+}
+
+func TestNewHasherRejectsInvalidConfig(t *testing.T) {
+	if _, err := passwordhash.NewHasher(&config.Config{PasswordHashAlgorithm: "scrypt"}); err == nil {
+		t.Error("expected an error for an unsupported algorithm")
+	}
+	if _, err := passwordhash.NewHasher(&config.Config{PasswordHashAlgorithm: passwordhash.AlgorithmBcrypt, PasswordBcryptCost: 64}); err == nil {
+		t.Error("expected an error for an out-of-range bcrypt cost")
+	}
+}
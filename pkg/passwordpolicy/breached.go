@@ -0,0 +1,53 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BreachedList holds SHA-1 hashes of known breached passwords, in the format
+// of the Have I Been Pwned downloads: one upper-case hex hash per line,
+// optionally followed by ":count". Only the hash is kept in memory.
+type BreachedList struct {
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+func LoadBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedList{hashes: map[[sha1.Size]byte]struct{}{}}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		entry, _, _ = strings.Cut(entry, ":")
+		var hash [sha1.Size]byte
+		if n, err := hex.Decode(hash[:], []byte(entry)); err != nil || n != sha1.Size {
+			return nil, fmt.Errorf("%s:%d: invalid SHA-1 hash", path, line)
+		}
+		list.hashes[hash] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	_, ok := l.hashes[sha1.Sum([]byte(password))]
+	return ok
+}
+
+func (l *BreachedList) Len() int {
+	return len(l.hashes)
+}
@@ -0,0 +1,155 @@
+// Package passwordpolicy checks new passwords against length, complexity,
+// personal information and breached-password rules.
+package passwordpolicy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+)
+
+// Violation codes reported in apperror.FieldError.
+const (
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeTooFewClasses = "too_few_character_classes"
+	CodeTooSimple     = "too_predictable"
+	CodePersonalInfo  = "contains_personal_info"
+	CodeBreached      = "breached"
+	CodeReused        = "reused"
+)
+
+// personalInfoMinLength keeps short names or email parts such as "al" from
+// rejecting unrelated passwords.
+const personalInfoMinLength = 3
+
+type Policy struct {
+	minLength  int
+	maxLength  int // in bytes; bcrypt ignores anything past 72
+	minClasses int
+	minEntropy float64 // in bits
+	breached   *BreachedList
+}
+
+// New builds the policy from the configuration and loads the breached
+// password list, if one is configured.
+func New(cfg *config.Config) (*Policy, error) {
+	policy := &Policy{
+		minLength:  cfg.PasswordMinLength,
+		maxLength:  cfg.PasswordMaxLength,
+		minClasses: cfg.PasswordMinClasses,
+		minEntropy: float64(cfg.PasswordMinEntropy),
+	}
+	if cfg.PasswordBreachedFile != "" {
+		breached, err := LoadBreachedList(cfg.PasswordBreachedFile)
+		if err != nil {
+			return nil, err
+		}
+		policy.breached = breached
+	}
+	return policy, nil
+}
+
+// Check returns every rule password fails. personal holds values the
+// password must not contain, such as the user's email and name.
+func (p *Policy) Check(password string, personal ...string) []apperror.FieldError {
+	var violations []apperror.FieldError
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		violations = append(violations, apperror.FieldError{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("must be at least %d characters", p.minLength),
+		})
+	}
+	if p.maxLength > 0 && len(password) > p.maxLength {
+		violations = append(violations, apperror.FieldError{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("must be at most %d bytes", p.maxLength),
+		})
+	}
+
+	classes, pool := characterClasses(password)
+	if classes < p.minClasses {
+		violations = append(violations, apperror.FieldError{
+			Code:    CodeTooFewClasses,
+			Message: fmt.Sprintf("must mix at least %d of lowercase, uppercase, digits and symbols", p.minClasses),
+		})
+	}
+	if p.minEntropy > 0 && float64(length)*math.Log2(float64(max(pool, 1))) < p.minEntropy {
+		violations = append(violations, apperror.FieldError{
+			Code:    CodeTooSimple,
+			Message: "is too easy to guess, use a longer password",
+		})
+	}
+
+	if containsPersonalInfo(password, personal) {
+		violations = append(violations, apperror.FieldError{
+			Code:    CodePersonalInfo,
+			Message: "must not contain your email or name",
+		})
+	}
+	if p.breached != nil && p.breached.Contains(password) {
+		violations = append(violations, apperror.FieldError{
+			Code:    CodeBreached,
+			Message: "has appeared in a data breach, choose another password",
+		})
+	}
+	return violations
+}
+
+// characterClasses counts the classes used and the size of the alphabet
+// they span, which is what the entropy estimate is based on.
+func characterClasses(password string) (int, int) {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	classes, pool := 0, 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			classes++
+			pool += class.size
+		}
+	}
+	return classes, pool
+}
+
+// containsPersonalInfo looks for the email, its local part and each word of
+// the given values inside the password, ignoring case.
+func containsPersonalInfo(password string, personal []string) bool {
+	password = strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		parts := strings.FieldsFunc(value, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '@' || r == '.' || r == '_' || r == '-' || r == '+'
+		})
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			parts = append(parts, local)
+		}
+		for _, part := range append(parts, value) {
+			if utf8.RuneCountInString(part) >= personalInfoMinLength && strings.Contains(password, part) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package passwordpolicy_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/KimNattanan/go-user-service/pkg/apperror"
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/passwordpolicy"
+)
+
+func codes(violations []apperror.FieldError) []string {
+	var result []string
+	for _, violation := range violations {
+		result = append(result, violation.Code)
+	}
+	return result
+}
+
+func TestCheck(t *testing.T) {
+	breachedFile := filepath.Join(t.TempDir(), "breached.txt")
+	sum := sha1.Sum([]byte("Summer2024!"))
+	content := "# comment\n" + strings.ToUpper(hex.EncodeToString(sum[:])) + ":3861493\n"
+	if err := os.WriteFile(breachedFile, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := passwordpolicy.New(&config.Config{
+		PasswordMinLength:    8,
+		PasswordMaxLength:    72,
+		PasswordMinClasses:   2,
+		PasswordMinEntropy:   45,
+		PasswordBreachedFile: breachedFile,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"strong", "correct-Horse-battery", nil},
+		{"too short", "a1", []string{passwordpolicy.CodeTooShort, passwordpolicy.CodeTooSimple}},
+		{"too long", strings.Repeat("aB3", 25), []string{passwordpolicy.CodeTooLong}},
+		{"single class", "abcdefghijkl", []string{passwordpolicy.CodeTooFewClasses}},
+		{"low entropy", "aaaa1111", []string{passwordpolicy.CodeTooSimple}},
+		{"contains email", "Jane.Doe#2024", []string{passwordpolicy.CodePersonalInfo}},
+		{"contains name", "xx-SMITHSON-99", []string{passwordpolicy.CodePersonalInfo}},
+		{"breached", "Summer2024!", []string{passwordpolicy.CodeBreached}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := codes(policy.Check(tt.password, "jane.doe@example.com", "Ann Smithson"))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadBreachedListRejectsInvalidLines(t *testing.T) {
+	breachedFile := filepath.Join(t.TempDir(), "breached.txt")
+	os.WriteFile(breachedFile, []byte("not-a-hash\n"), 0o600)
+	if _, err := passwordpolicy.LoadBreachedList(breachedFile); err == nil {
+		t.Error("expected an error for an invalid hash")
+	}
+}
+
+func TestShippedBreachedList(t *testing.T) {
+	list, err := passwordpolicy.LoadBreachedList("../../data/breached-passwords.txt")
+	if err != nil {
+		t.Fatalf("LoadBreachedList: %v", err)
+	}
+	if !list.Contains("123456") || list.Contains("correct-Horse-battery") {
+		t.Error("unexpected breached list contents")
+	}
+}
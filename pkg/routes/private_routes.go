@@ -1,20 +1,59 @@
 package routes
 
 import (
+	"log"
+	"net/http"
+
+	"github.com/KimNattanan/go-user-service/internal/entity"
 	"github.com/KimNattanan/go-user-service/internal/handler/rest"
 	"github.com/KimNattanan/go-user-service/internal/middleware"
 	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/identity"
+	"github.com/KimNattanan/go-user-service/pkg/mailer"
+	"github.com/KimNattanan/go-user-service/pkg/passwordhash"
+	"github.com/KimNattanan/go-user-service/pkg/passwordpolicy"
 	"github.com/KimNattanan/go-user-service/pkg/token"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 
 	userRepo "github.com/KimNattanan/go-user-service/internal/repo/user"
 	userUsecase "github.com/KimNattanan/go-user-service/internal/usecase/user"
 
+	oneTimeTokenRepo "github.com/KimNattanan/go-user-service/internal/repo/onetimetoken"
+
+	identityRepo "github.com/KimNattanan/go-user-service/internal/repo/identity"
+	identityUsecase "github.com/KimNattanan/go-user-service/internal/usecase/identity"
+
+	recoveryCodeRepo "github.com/KimNattanan/go-user-service/internal/repo/recoverycode"
+	mfaUsecase "github.com/KimNattanan/go-user-service/internal/usecase/mfa"
+
+	passkeyRepo "github.com/KimNattanan/go-user-service/internal/repo/passkey"
+	passkeyUsecase "github.com/KimNattanan/go-user-service/internal/usecase/passkey"
+
+	apiKeyRepo "github.com/KimNattanan/go-user-service/internal/repo/apikey"
+	apiKeyUsecase "github.com/KimNattanan/go-user-service/internal/usecase/apikey"
+
+	loginThrottleRepo "github.com/KimNattanan/go-user-service/internal/repo/loginthrottle"
+	loginThrottleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/loginthrottle"
+
+	passwordHistoryRepo "github.com/KimNattanan/go-user-service/internal/repo/passwordhistory"
+
 	sessionRepo "github.com/KimNattanan/go-user-service/internal/repo/session"
 	sessionUsecase "github.com/KimNattanan/go-user-service/internal/usecase/session"
 
+	auditEventRepo "github.com/KimNattanan/go-user-service/internal/repo/auditevent"
+
+	oauthClientRepo "github.com/KimNattanan/go-user-service/internal/repo/oauthclient"
+	oauthConsentRepo "github.com/KimNattanan/go-user-service/internal/repo/oauthconsent"
+	oauthUsecase "github.com/KimNattanan/go-user-service/internal/usecase/oauth"
+
+	serviceAccountRepo "github.com/KimNattanan/go-user-service/internal/repo/serviceaccount"
+	serviceAccountUsecase "github.com/KimNattanan/go-user-service/internal/usecase/serviceaccount"
+
+	roleRepo "github.com/KimNattanan/go-user-service/internal/repo/role"
+	roleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/role"
+
+	userAdminUsecase "github.com/KimNattanan/go-user-service/internal/usecase/useradmin"
+
 	preferenceRepo "github.com/KimNattanan/go-user-service/internal/repo/preference"
 	preferenceUsecase "github.com/KimNattanan/go-user-service/internal/usecase/preference"
 
@@ -23,41 +62,154 @@ import (
 	"gorm.io/gorm"
 )
 
-func RegisterPrivateRoutes(r *mux.Router, db *gorm.DB, rdb *redis.Client, sessionStore sessions.Store, cfg *config.Config) {
+func RegisterPrivateRoutes(r *mux.Router, db *gorm.DB, rdb *redis.Client, sessionStore sessions.Store, providers identity.Registry, passwordPolicy *passwordpolicy.Policy, passwordHasher *passwordhash.Hasher, jwtMaker *token.JWTMaker, cfg *config.Config) {
 	api := r.PathPrefix("/api/v1").Subrouter()
 
-	jwtMaker := token.NewJWTMaker(cfg.JWTSecret)
-	googleOauthConfig := &oauth2.Config{
-		ClientID:     cfg.GoogleClientID,
-		ClientSecret: cfg.GoogleClientSecret,
-		RedirectURL:  cfg.GoogleRedirectURL,
-		Scopes:       []string{"openid", "email", "profile"},
-		Endpoint:     google.Endpoint,
-	}
-
 	userRepo := userRepo.NewUserRepo(db)
 	sessionRepo := sessionRepo.NewSessionRepo(rdb)
+	auditEventRepo := auditEventRepo.NewAuditEventRepo(db)
+	oneTimeTokenRepo := oneTimeTokenRepo.NewOneTimeTokenRepo(rdb)
+	recoveryCodeRepo := recoveryCodeRepo.NewRecoveryCodeRepo(db)
+	passkeyRepo := passkeyRepo.NewPasskeyRepo(db)
+	apiKeyRepo := apiKeyRepo.NewAPIKeyRepo(db)
+	identityRepo := identityRepo.NewIdentityRepo(db)
+	passwordHistoryRepo := passwordHistoryRepo.NewPasswordHistoryRepo(db)
+	loginThrottleRepo := loginThrottleRepo.NewLoginThrottleRepo(rdb)
 	preferenceRepo := preferenceRepo.NewPreferenceRepo(db)
+	oauthClientRepo := oauthClientRepo.NewOAuthClientRepo(db)
+	oauthConsentRepo := oauthConsentRepo.NewOAuthConsentRepo(db)
+	serviceAccountRepo := serviceAccountRepo.NewServiceAccountRepo(db)
+	roleRepo := roleRepo.NewRoleRepo(db)
 
-	userUsecase := userUsecase.NewUserUsecase(userRepo)
-	sessionUsecase := sessionUsecase.NewSessionUsecase(sessionRepo)
+	userUsecase := userUsecase.NewUserUsecase(userRepo, sessionRepo, oneTimeTokenRepo, passwordHistoryRepo, mailer.New(cfg.MailDriver, cfg.MailFrom, cfg.MailDir), passwordPolicy, passwordHasher, cfg)
+	roleUsecase := roleUsecase.NewRoleUsecase(roleRepo, userRepo, cfg)
+	sessionUsecase := sessionUsecase.NewSessionUsecase(sessionRepo, userRepo, auditEventRepo, roleUsecase, jwtMaker, cfg)
+	mfaUsecase := mfaUsecase.NewMFAUsecase(userRepo, recoveryCodeRepo, oneTimeTokenRepo, cfg)
+	identityUsecase := identityUsecase.NewIdentityUsecase(userRepo, identityRepo, passkeyRepo, oneTimeTokenRepo, providers, cfg)
+	loginThrottleUsecase := loginThrottleUsecase.NewLoginThrottleUsecase(loginThrottleRepo, cfg)
+	passkeyUsecase, err := passkeyUsecase.NewPasskeyUsecase(userRepo, passkeyRepo, oneTimeTokenRepo, cfg)
+	if err != nil {
+		log.Fatalf("invalid webauthn config: %v", err)
+	}
+	apiKeyUsecase := apiKeyUsecase.NewAPIKeyUsecase(apiKeyRepo)
 	preferenceUsecase := preferenceUsecase.NewPreferenceUsecase(preferenceRepo)
+	oauthUsecase := oauthUsecase.NewOAuthUsecase(oauthClientRepo, oauthConsentRepo, oneTimeTokenRepo, userRepo, sessionUsecase, jwtMaker)
+	serviceAccountUsecase := serviceAccountUsecase.NewServiceAccountUsecase(serviceAccountRepo, jwtMaker, cfg)
+	userAdminUsecase := userAdminUsecase.NewUserAdminUsecase(userRepo, identityRepo, auditEventRepo, sessionUsecase, roleUsecase, loginThrottleUsecase)
 
-	userHandler := rest.NewHttpUserHandler(userUsecase, sessionUsecase, sessionStore, googleOauthConfig, jwtMaker, cfg.JWTExpiration)
+	userHandler := rest.NewHttpUserHandler(userUsecase, sessionUsecase, mfaUsecase, identityUsecase, passkeyUsecase, loginThrottleUsecase, sessionStore, cfg.LoginErrorURL)
 	preferenceHandler := rest.NewHttpPreferenceHandler(preferenceUsecase)
+	mfaHandler := rest.NewHttpMFAHandler(mfaUsecase)
+	passkeyHandler := rest.NewHttpPasskeyHandler(passkeyUsecase)
+	apiKeyHandler := rest.NewHttpAPIKeyHandler(apiKeyUsecase)
+	identityHandler := rest.NewHttpIdentityHandler(identityUsecase, sessionStore)
+	sessionHandler := rest.NewHttpSessionHandler(sessionUsecase, sessionStore)
+	oauthServerHandler := rest.NewHttpOAuthServerHandler(sessionUsecase, oauthUsecase, serviceAccountUsecase, cfg.ResourceServers, cfg.JWTIssuer, cfg.OAuthLoginURL, cfg.OAuthConsentURL)
+	adminHandler := rest.NewHttpAdminHandler(userUsecase, loginThrottleUsecase, oauthUsecase, serviceAccountUsecase, roleUsecase)
+	userAdminHandler := rest.NewHttpUserAdminHandler(userAdminUsecase, sessionStore)
+
+	authMiddleware := middleware.NewAuthMiddleware(userUsecase, sessionUsecase, serviceAccountUsecase, apiKeyUsecase, userAdminUsecase, sessionStore, jwtMaker, providers, cfg.EmailVerificationPolicy)
+
+	// The authorization endpoint sends signed out users to the login page
+	// instead of failing, so it is registered before the protected routes.
+	authorizeGroup := r.PathPrefix("/api/v1/oauth/authorize").Subrouter()
+	authorizeGroup.Use(authMiddleware.Optional)
+	authorizeGroup.HandleFunc("", oauthServerHandler.Authorize).Methods("GET")
 
-	authMiddleware := middleware.NewAuthMiddleware(userUsecase, sessionUsecase, sessionStore, jwtMaker, googleOauthConfig, cfg.JWTExpiration)
 	api.Use(authMiddleware.Handle)
 
+	// Users and service accounts reach the admin routes their permissions
+	// allow, and API keys only the /me routes their scopes allow. Ending an
+	// impersonation is the one route acting on the user that an impersonating
+	// admin may use, so it is registered outside the RequireUser groups.
+	api.HandleFunc("/auth/impersonation", userAdminHandler.StopImpersonation).Methods("DELETE")
+
 	authGroup := api.PathPrefix("/auth").Subrouter()
+	authGroup.Use(middleware.RequireUser)
 	authGroup.HandleFunc("/logout", userHandler.Logout).Methods("POST")
 
 	meGroup := api.PathPrefix("/me").Subrouter()
-	meGroup.HandleFunc("", userHandler.GetUser).Methods("GET")
-	meGroup.HandleFunc("", userHandler.Update).Methods("PATCH")
-	meGroup.HandleFunc("", userHandler.Delete).Methods("DELETE")
+	meGroup.Handle("", scoped(entity.ScopeProfileRead, userHandler.GetUser)).Methods("GET")
+	meGroup.Handle("", scoped(entity.ScopeProfileWrite, userHandler.Update)).Methods("PATCH")
+	meGroup.Handle("/preferences", scoped(entity.ScopePreferencesRead, preferenceHandler.GetPreference)).Methods("GET")
+	meGroup.Handle("/preferences", scoped(entity.ScopePreferencesWrite, preferenceHandler.Update)).Methods("PATCH")
+
+	accountGroup := meGroup.NewRoute().Subrouter()
+	accountGroup.Use(middleware.RequireUser)
+	accountGroup.HandleFunc("", userHandler.Delete).Methods("DELETE")
+	accountGroup.HandleFunc("/password", userHandler.ChangePassword).Methods("POST")
+
+	mfaGroup := accountGroup.PathPrefix("/mfa").Subrouter()
+	mfaGroup.HandleFunc("/totp", mfaHandler.EnrollTOTP).Methods("POST")
+	mfaGroup.HandleFunc("/totp/confirm", mfaHandler.ConfirmTOTP).Methods("POST")
+	mfaGroup.HandleFunc("/totp", mfaHandler.DisableTOTP).Methods("DELETE")
+	mfaGroup.HandleFunc("/recovery-codes", mfaHandler.RegenerateRecoveryCodes).Methods("POST")
+
+	sessionsGroup := accountGroup.PathPrefix("/sessions").Subrouter()
+	sessionsGroup.HandleFunc("", sessionHandler.FindSessions).Methods("GET")
+	sessionsGroup.HandleFunc("/revoke-others", sessionHandler.RevokeOthers).Methods("POST")
+	sessionsGroup.HandleFunc("/{id}", sessionHandler.Revoke).Methods("DELETE")
+
+	passkeysGroup := accountGroup.PathPrefix("/passkeys").Subrouter()
+	passkeysGroup.HandleFunc("", passkeyHandler.FindPasskeys).Methods("GET")
+	passkeysGroup.HandleFunc("/register/begin", passkeyHandler.BeginRegistration).Methods("POST")
+	passkeysGroup.HandleFunc("/register/finish", passkeyHandler.FinishRegistration).Methods("POST")
+	passkeysGroup.HandleFunc("/{id}", passkeyHandler.Rename).Methods("PATCH")
+	passkeysGroup.HandleFunc("/{id}", passkeyHandler.Delete).Methods("DELETE")
+
+	identitiesGroup := accountGroup.PathPrefix("/identities").Subrouter()
+	identitiesGroup.HandleFunc("", identityHandler.FindIdentities).Methods("GET")
+	identitiesGroup.HandleFunc("/{provider}/link", identityHandler.Link).Methods("GET")
+	identitiesGroup.HandleFunc("/{id}", identityHandler.Unlink).Methods("DELETE")
+
+	apiKeysGroup := accountGroup.PathPrefix("/api-keys").Subrouter()
+	apiKeysGroup.HandleFunc("", apiKeyHandler.FindAPIKeys).Methods("GET")
+	apiKeysGroup.HandleFunc("", apiKeyHandler.Create).Methods("POST")
+	apiKeysGroup.HandleFunc("/{id}", apiKeyHandler.Revoke).Methods("DELETE")
+
+	oauthGroup := api.PathPrefix("/oauth").Subrouter()
+	oauthGroup.Use(middleware.RequireUser)
+	oauthGroup.HandleFunc("/consent/{id}", oauthServerHandler.FindConsentRequest).Methods("GET")
+	oauthGroup.HandleFunc("/consent/{id}", oauthServerHandler.DecideConsent).Methods("POST")
+
+	usersGroup := api.PathPrefix("/users").Subrouter()
+	usersGroup.Use(middleware.RequirePermission(entity.PermissionUsersRead))
+	usersGroup.HandleFunc("", userHandler.FindAllUsers).Methods("GET")
+	usersGroup.HandleFunc("/{id}", userHandler.FindUser).Methods("GET")
+
+	adminGroup := api.PathPrefix("/admin").Subrouter()
+	adminGroup.Handle("/users", permitted(entity.PermissionUsersRead, userAdminHandler.Search)).Methods("GET")
+	adminGroup.Handle("/users/{id}", permitted(entity.PermissionUsersRead, userAdminHandler.FindByID)).Methods("GET")
+	adminGroup.Handle("/users/{id}", permitted(entity.PermissionUsersWrite, userAdminHandler.Update)).Methods("PATCH")
+	adminGroup.Handle("/users/{id}", permitted(entity.PermissionUsersDelete, userAdminHandler.Delete)).Methods("DELETE")
+	adminGroup.Handle("/users/{id}/disable", permitted(entity.PermissionUsersWrite, userAdminHandler.Disable)).Methods("POST")
+	adminGroup.Handle("/users/{id}/enable", permitted(entity.PermissionUsersWrite, userAdminHandler.Enable)).Methods("POST")
+	adminGroup.Handle("/users/{id}/password-reset", permitted(entity.PermissionUsersWrite, userAdminHandler.RequirePasswordReset)).Methods("POST")
+	adminGroup.Handle("/users/{id}/sessions", permitted(entity.PermissionUsersWrite, userAdminHandler.RevokeSessions)).Methods("DELETE")
+	adminGroup.Handle("/users/{id}/impersonate", permitted(entity.PermissionUsersImpersonate, userAdminHandler.Impersonate)).Methods("POST")
+	adminGroup.Handle("/users/{id}/lockout", permitted(entity.PermissionUsersRead, adminHandler.GetLockout)).Methods("GET")
+	adminGroup.Handle("/users/{id}/lockout", permitted(entity.PermissionUsersWrite, userAdminHandler.Unlock)).Methods("DELETE")
+	adminGroup.Handle("/users/{id}/roles", permitted(entity.PermissionRolesManage, adminHandler.FindUserRoles)).Methods("GET")
+	adminGroup.Handle("/users/{id}/roles", permitted(entity.PermissionRolesManage, userAdminHandler.AssignRole)).Methods("POST")
+	adminGroup.Handle("/users/{id}/roles/{role}", permitted(entity.PermissionRolesManage, userAdminHandler.UnassignRole)).Methods("DELETE")
+	adminGroup.Handle("/roles", permitted(entity.PermissionRolesManage, adminHandler.FindRoles)).Methods("GET")
+	adminGroup.Handle("/roles/{name}", permitted(entity.PermissionRolesManage, adminHandler.SaveRole)).Methods("PUT")
+	adminGroup.Handle("/roles/{name}", permitted(entity.PermissionRolesManage, adminHandler.DeleteRole)).Methods("DELETE")
+	adminGroup.Handle("/oauth/clients", permitted(entity.PermissionClientsManage, adminHandler.CreateClient)).Methods("POST")
+	adminGroup.Handle("/oauth/clients", permitted(entity.PermissionClientsManage, adminHandler.FindClients)).Methods("GET")
+	adminGroup.Handle("/oauth/clients/{id}", permitted(entity.PermissionClientsManage, adminHandler.DeleteClient)).Methods("DELETE")
+	adminGroup.Handle("/service-accounts", permitted(entity.PermissionClientsManage, adminHandler.CreateServiceAccount)).Methods("POST")
+	adminGroup.Handle("/service-accounts", permitted(entity.PermissionClientsManage, adminHandler.FindServiceAccounts)).Methods("GET")
+	adminGroup.Handle("/service-accounts/{id}/secrets", permitted(entity.PermissionClientsManage, adminHandler.RotateServiceAccountSecret)).Methods("POST")
+	adminGroup.Handle("/service-accounts/{id}", permitted(entity.PermissionClientsManage, adminHandler.DeleteServiceAccount)).Methods("DELETE")
+}
+
+// scoped guards a /me route that API keys may use with scope.
+func scoped(scope string, handler http.HandlerFunc) http.Handler {
+	return middleware.RequireScope(scope)(handler)
+}
 
-	preferencesGroup := meGroup.PathPrefix("/preferences").Subrouter()
-	preferencesGroup.HandleFunc("", preferenceHandler.GetPreference).Methods("GET")
-	preferencesGroup.HandleFunc("", preferenceHandler.Update).Methods("PATCH")
+// permitted guards a route with permission.
+func permitted(permission string, handler http.HandlerFunc) http.Handler {
+	return middleware.RequirePermission(permission)(handler)
 }
@@ -1,51 +1,114 @@
 package routes
 
 import (
+	"log"
+
 	"github.com/KimNattanan/go-user-service/internal/handler/rest"
 	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/identity"
+	"github.com/KimNattanan/go-user-service/pkg/mailer"
+	"github.com/KimNattanan/go-user-service/pkg/passwordhash"
+	"github.com/KimNattanan/go-user-service/pkg/passwordpolicy"
 	"github.com/KimNattanan/go-user-service/pkg/token"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 
 	userRepo "github.com/KimNattanan/go-user-service/internal/repo/user"
 	userUsecase "github.com/KimNattanan/go-user-service/internal/usecase/user"
 
+	oneTimeTokenRepo "github.com/KimNattanan/go-user-service/internal/repo/onetimetoken"
+
+	identityRepo "github.com/KimNattanan/go-user-service/internal/repo/identity"
+	identityUsecase "github.com/KimNattanan/go-user-service/internal/usecase/identity"
+
+	recoveryCodeRepo "github.com/KimNattanan/go-user-service/internal/repo/recoverycode"
+	mfaUsecase "github.com/KimNattanan/go-user-service/internal/usecase/mfa"
+
+	passkeyRepo "github.com/KimNattanan/go-user-service/internal/repo/passkey"
+	passkeyUsecase "github.com/KimNattanan/go-user-service/internal/usecase/passkey"
+
+	loginThrottleRepo "github.com/KimNattanan/go-user-service/internal/repo/loginthrottle"
+	loginThrottleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/loginthrottle"
+
+	passwordHistoryRepo "github.com/KimNattanan/go-user-service/internal/repo/passwordhistory"
+
 	sessionRepo "github.com/KimNattanan/go-user-service/internal/repo/session"
 	sessionUsecase "github.com/KimNattanan/go-user-service/internal/usecase/session"
 
+	auditEventRepo "github.com/KimNattanan/go-user-service/internal/repo/auditevent"
+
+	oauthClientRepo "github.com/KimNattanan/go-user-service/internal/repo/oauthclient"
+	oauthConsentRepo "github.com/KimNattanan/go-user-service/internal/repo/oauthconsent"
+	oauthUsecase "github.com/KimNattanan/go-user-service/internal/usecase/oauth"
+
+	serviceAccountRepo "github.com/KimNattanan/go-user-service/internal/repo/serviceaccount"
+	serviceAccountUsecase "github.com/KimNattanan/go-user-service/internal/usecase/serviceaccount"
+
+	roleRepo "github.com/KimNattanan/go-user-service/internal/repo/role"
+	roleUsecase "github.com/KimNattanan/go-user-service/internal/usecase/role"
+
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"gorm.io/gorm"
 )
 
-func RegisterPublicRoutes(r *mux.Router, db *gorm.DB, rdb *redis.Client, sessionStore sessions.Store, cfg *config.Config) {
+func RegisterPublicRoutes(r *mux.Router, db *gorm.DB, rdb *redis.Client, sessionStore sessions.Store, providers identity.Registry, passwordPolicy *passwordpolicy.Policy, passwordHasher *passwordhash.Hasher, jwtMaker *token.JWTMaker, cfg *config.Config) {
 	api := r.PathPrefix("/api/v1").Subrouter()
 
-	jwtMaker := token.NewJWTMaker(cfg.JWTSecret)
-
 	userRepo := userRepo.NewUserRepo(db)
 	sessionRepo := sessionRepo.NewSessionRepo(rdb)
+	auditEventRepo := auditEventRepo.NewAuditEventRepo(db)
+	oneTimeTokenRepo := oneTimeTokenRepo.NewOneTimeTokenRepo(rdb)
+	recoveryCodeRepo := recoveryCodeRepo.NewRecoveryCodeRepo(db)
+	passkeyRepo := passkeyRepo.NewPasskeyRepo(db)
+	identityRepo := identityRepo.NewIdentityRepo(db)
+	passwordHistoryRepo := passwordHistoryRepo.NewPasswordHistoryRepo(db)
+	loginThrottleRepo := loginThrottleRepo.NewLoginThrottleRepo(rdb)
+	oauthClientRepo := oauthClientRepo.NewOAuthClientRepo(db)
+	oauthConsentRepo := oauthConsentRepo.NewOAuthConsentRepo(db)
+	serviceAccountRepo := serviceAccountRepo.NewServiceAccountRepo(db)
+	roleRepo := roleRepo.NewRoleRepo(db)
 
-	userUsecase := userUsecase.NewUserUsecase(userRepo)
-	sessionUsecase := sessionUsecase.NewSessionUsecase(sessionRepo)
-
-	googleOauthConfig := &oauth2.Config{
-		ClientID:     cfg.GoogleClientID,
-		ClientSecret: cfg.GoogleClientSecret,
-		RedirectURL:  cfg.GoogleRedirectURL,
-		Scopes:       []string{"openid", "email", "profile"},
-		Endpoint:     google.Endpoint,
+	userUsecase := userUsecase.NewUserUsecase(userRepo, sessionRepo, oneTimeTokenRepo, passwordHistoryRepo, mailer.New(cfg.MailDriver, cfg.MailFrom, cfg.MailDir), passwordPolicy, passwordHasher, cfg)
+	roleUsecase := roleUsecase.NewRoleUsecase(roleRepo, userRepo, cfg)
+	sessionUsecase := sessionUsecase.NewSessionUsecase(sessionRepo, userRepo, auditEventRepo, roleUsecase, jwtMaker, cfg)
+	mfaUsecase := mfaUsecase.NewMFAUsecase(userRepo, recoveryCodeRepo, oneTimeTokenRepo, cfg)
+	identityUsecase := identityUsecase.NewIdentityUsecase(userRepo, identityRepo, passkeyRepo, oneTimeTokenRepo, providers, cfg)
+	loginThrottleUsecase := loginThrottleUsecase.NewLoginThrottleUsecase(loginThrottleRepo, cfg)
+	passkeyUsecase, err := passkeyUsecase.NewPasskeyUsecase(userRepo, passkeyRepo, oneTimeTokenRepo, cfg)
+	if err != nil {
+		log.Fatalf("invalid webauthn config: %v", err)
 	}
-	userHandler := rest.NewHttpUserHandler(userUsecase, sessionUsecase, sessionStore, googleOauthConfig, jwtMaker, cfg.JWTExpiration)
+	oauthUsecase := oauthUsecase.NewOAuthUsecase(oauthClientRepo, oauthConsentRepo, oneTimeTokenRepo, userRepo, sessionUsecase, jwtMaker)
+	serviceAccountUsecase := serviceAccountUsecase.NewServiceAccountUsecase(serviceAccountRepo, jwtMaker, cfg)
+
+	userHandler := rest.NewHttpUserHandler(userUsecase, sessionUsecase, mfaUsecase, identityUsecase, passkeyUsecase, loginThrottleUsecase, sessionStore, cfg.LoginErrorURL)
+	oauthServerHandler := rest.NewHttpOAuthServerHandler(sessionUsecase, oauthUsecase, serviceAccountUsecase, cfg.ResourceServers, cfg.JWTIssuer, cfg.OAuthLoginURL, cfg.OAuthConsentURL)
+	wellKnownHandler := rest.NewHttpWellKnownHandler(jwtMaker)
+
+	r.HandleFunc("/.well-known/jwks.json", wellKnownHandler.JWKS).Methods("GET")
+	r.HandleFunc("/.well-known/openid-configuration", wellKnownHandler.OpenIDConfiguration).Methods("GET")
 
 	authGroup := api.PathPrefix("/auth").Subrouter()
 	authGroup.HandleFunc("/register", userHandler.Register).Methods("POST")
 	authGroup.HandleFunc("/login", userHandler.Login).Methods("POST")
-	authGroup.HandleFunc("/google/login", userHandler.GoogleLogin).Methods("GET")
-	authGroup.HandleFunc("/google/callback", userHandler.GoogleCallback).Methods("GET")
+	authGroup.HandleFunc("/refresh", userHandler.Refresh).Methods("POST")
+	authGroup.HandleFunc("/mfa/verify", userHandler.VerifyMFA).Methods("POST")
+	authGroup.HandleFunc("/passkey/login/begin", userHandler.BeginPasskeyLogin).Methods("POST")
+	authGroup.HandleFunc("/passkey/login/finish", userHandler.FinishPasskeyLogin).Methods("POST")
+	if cfg.PasswordlessEnabled {
+		authGroup.HandleFunc("/email/start", userHandler.StartEmailLogin).Methods("POST")
+		authGroup.HandleFunc("/email/complete", userHandler.CompleteEmailLogin).Methods("POST")
+	}
+	authGroup.HandleFunc("/{provider}/login", userHandler.ProviderLogin).Methods("GET")
+	authGroup.HandleFunc("/{provider}/callback", userHandler.ProviderCallback).Methods("GET")
+	authGroup.HandleFunc("/verify-email", userHandler.VerifyEmail).Methods("POST")
+	authGroup.HandleFunc("/verify-email/resend", userHandler.ResendVerification).Methods("POST")
+	authGroup.HandleFunc("/password/forgot", userHandler.ForgotPassword).Methods("POST")
+	authGroup.HandleFunc("/password/reset", userHandler.ResetPassword).Methods("POST")
 
-	userGroup := api.PathPrefix("/users").Subrouter()
-	userGroup.HandleFunc("", userHandler.FindAllUsers).Methods("GET")
-	userGroup.HandleFunc("/{id}", userHandler.FindUser).Methods("GET")
+	oauthGroup := api.PathPrefix("/oauth").Subrouter()
+	oauthGroup.HandleFunc("/token", oauthServerHandler.Token).Methods("POST")
+	oauthGroup.HandleFunc("/userinfo", oauthServerHandler.UserInfo).Methods("GET", "POST")
+	oauthGroup.HandleFunc("/introspect", oauthServerHandler.Introspect).Methods("POST")
+	oauthGroup.HandleFunc("/revoke", oauthServerHandler.Revoke).Methods("POST")
 }
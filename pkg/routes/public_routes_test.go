@@ -39,10 +39,10 @@ func TestPublicRoutes(t *testing.T) {
 		wantStatus int
 	}{
 		{
-			name:       "GET users",
+			name:       "GET users without signing in",
 			method:     http.MethodGet,
 			path:       "/api/v1/users",
-			wantStatus: http.StatusOK,
+			wantStatus: http.StatusUnauthorized,
 		},
 		{
 			name:       "unknown route",
@@ -64,6 +64,17 @@ func TestPublicRoutes(t *testing.T) {
 			},
 			wantStatus: http.StatusOK,
 		},
+		{
+			name:   "register with a weak password",
+			method: http.MethodPost,
+			path:   "/api/v1/auth/register",
+			body: map[string]string{
+				"email":    "weak@gmail.com",
+				"password": "a",
+				"name":     "weak user",
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
 		{
 			name:   "login the created user",
 			method: http.MethodPost,
@@ -94,6 +105,86 @@ func TestPublicRoutes(t *testing.T) {
 			},
 			wantStatus: http.StatusUnauthorized,
 		},
+		{
+			name:   "verify email with invalid token",
+			method: http.MethodPost,
+			path:   "/api/v1/auth/verify-email",
+			body: map[string]string{
+				"token": "invalid-token",
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "resend verification for unknown email",
+			method: http.MethodPost,
+			path:   "/api/v1/auth/verify-email/resend",
+			body: map[string]string{
+				"email": "unknown@gmail.com",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "forgot password for unknown email",
+			method: http.MethodPost,
+			path:   "/api/v1/auth/password/forgot",
+			body: map[string]string{
+				"email": "unknown@gmail.com",
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "reset password with invalid token",
+			method: http.MethodPost,
+			path:   "/api/v1/auth/password/reset",
+			body: map[string]string{
+				"token":    "invalid-token",
+				"password": "newpassword123",
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "verify mfa with invalid challenge",
+			method: http.MethodPost,
+			path:   "/api/v1/auth/mfa/verify",
+			body: map[string]string{
+				"challenge_token": "invalid-challenge",
+				"code":            "123456",
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "login with unknown identity provider",
+			method:     http.MethodGet,
+			path:       "/api/v1/auth/unknown/login",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "login with a return_to outside the allowlist",
+			method:     http.MethodGet,
+			path:       "/api/v1/auth/google/login?return_to=https://evil.example.com/",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "identity provider callback without state",
+			method:     http.MethodGet,
+			path:       "/api/v1/auth/google/callback?state=forged&code=code",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "begin passkey login",
+			method:     http.MethodPost,
+			path:       "/api/v1/auth/passkey/login/begin",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "finish passkey login with invalid ceremony",
+			method: http.MethodPost,
+			path:   "/api/v1/auth/passkey/login/finish",
+			body: map[string]string{
+				"ceremony_id": "invalid-ceremony",
+			},
+			wantStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
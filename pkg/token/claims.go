@@ -8,18 +8,34 @@ import (
 	"github.com/google/uuid"
 )
 
+// PrincipalTypeServiceAccount marks tokens issued to service accounts. Tokens
+// without a principal type belong to users.
+const PrincipalTypeServiceAccount = "service_account"
+
 type UserClaims struct {
-	ID                 string `json:"id"`
+	ID            string      `json:"id"`
+	PrincipalType string      `json:"principal_type,omitempty"`
+	SessionID     string      `json:"sid,omitempty"`
+	ClientID      string      `json:"client_id,omitempty"` // OAuth client the token was issued to
+	Scope         string      `json:"scope,omitempty"`     // space separated
+	Permissions   []string    `json:"perms,omitempty"`     // from the user's roles, first-party access tokens only
+	Actor         *ActorClaim `json:"act,omitempty"`       // set while an admin impersonates the user
 	jwt.RegisteredClaims
 }
 
+// ActorClaim is the act claim of RFC 8693: the party acting on behalf of the
+// token's subject.
+type ActorClaim struct {
+	Subject string `json:"sub"`
+}
+
 func NewUserClaims(id string, duration time.Duration) (*UserClaims, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, fmt.Errorf("error generating token ID: %w", err)
 	}
 	return &UserClaims{
-		ID:                 id,
+		ID: id,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        tokenID.String(),
 			Subject:   id,
@@ -28,3 +44,17 @@ func NewUserClaims(id string, duration time.Duration) (*UserClaims, error) {
 		},
 	}, nil
 }
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. The profile
+// and email claims are only set when the matching scope was granted.
+type IDTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	GivenName     string `json:"given_name,omitempty"`
+	FamilyName    string `json:"family_name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	jwt.RegisteredClaims
+}
@@ -0,0 +1,109 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+)
+
+// JWK is the public half of a key as a JSON Web Key (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) JWK() (JWK, error) {
+	jwk, err := publicJWK(k)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk.KeyID = k.ID
+	jwk.Use = "sig"
+	jwk.Algorithm = k.Algorithm
+	return jwk, nil
+}
+
+// publicJWK holds only the members that make up the key itself.
+func publicJWK(k *Key) (JWK, error) {
+	switch pub := k.Public().(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType: "RSA",
+			N:       encodeBase64(pub.N.Bytes()),
+			E:       encodeBase64(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			KeyType: "EC",
+			Curve:   pub.Curve.Params().Name,
+			X:       encodeBase64(pub.X.FillBytes(make([]byte, size))),
+			Y:       encodeBase64(pub.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       encodeBase64(pub),
+		}, nil
+	}
+	return JWK{}, ErrUnsupportedKey
+}
+
+// thumbprint computes the JWK thumbprint (RFC 7638). The required members
+// are marshalled in lexicographic order, which the field order of the
+// anonymous structs below guarantees.
+func thumbprint(k *Key) (string, error) {
+	jwk, err := publicJWK(k)
+	if err != nil {
+		return "", err
+	}
+	var members any
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return encodeBase64(sum[:]), nil
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -2,17 +2,49 @@ package token
 
 import (
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// JWTMaker signs tokens with the active key of its keyring, naming the key in
+// the kid header, and verifies them with whichever key the header names.
 type JWTMaker struct {
-	secretKey string
+	keyring *Keyring
+	issuer  string
 }
 
-func NewJWTMaker(secretKey string) *JWTMaker {
-	return &JWTMaker{secretKey}
+func NewJWTMaker(keyring *Keyring, issuer string) *JWTMaker {
+	return &JWTMaker{keyring: keyring, issuer: issuer}
+}
+
+func (maker *JWTMaker) Issuer() string {
+	return maker.issuer
+}
+
+// JWKS returns the public keys tokens may currently be signed with.
+func (maker *JWTMaker) JWKS() (*JWKSet, error) {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range maker.keyring.Keys() {
+		jwk, err := key.JWK()
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// Algorithms returns the signing algorithms of the keys in the keyring.
+func (maker *JWTMaker) Algorithms() []string {
+	algorithms := []string{}
+	for _, key := range maker.keyring.Keys() {
+		if !slices.Contains(algorithms, key.Algorithm) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
 }
 
 func (maker *JWTMaker) CreateToken(id string, duration time.Duration) (string, *UserClaims, error) {
@@ -20,23 +52,83 @@ func (maker *JWTMaker) CreateToken(id string, duration time.Duration) (string, *
 	if err != nil {
 		return "", nil, err
 	}
+	return maker.Sign(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString([]byte(maker.secretKey))
+// CreateAccessToken creates a token bound to the session identified by sessionID.
+func (maker *JWTMaker) CreateAccessToken(id, sessionID string, duration time.Duration) (string, *UserClaims, error) {
+	claims, err := NewUserClaims(id, duration)
 	if err != nil {
-		return "", nil, fmt.Errorf("error signing token: %w", err)
+		return "", nil, err
+	}
+	claims.SessionID = sessionID
+	return maker.Sign(claims)
+}
+
+// CreateServiceAccountToken creates a token for a service account, which has
+// no session and is only good until it expires.
+func (maker *JWTMaker) CreateServiceAccountToken(id, scope string, duration time.Duration) (string, *UserClaims, error) {
+	claims, err := NewUserClaims(id, duration)
+	if err != nil {
+		return "", nil, err
+	}
+	claims.PrincipalType = PrincipalTypeServiceAccount
+	claims.ClientID = id
+	claims.Scope = scope
+	return maker.Sign(claims)
+}
+
+// Sign signs claims built with NewUserClaims, for tokens that need more than
+// CreateToken and CreateAccessToken set.
+func (maker *JWTMaker) Sign(claims *UserClaims) (string, *UserClaims, error) {
+	claims.Issuer = maker.issuer
+	tokenStr, err := maker.signClaims(claims)
+	if err != nil {
+		return "", nil, err
 	}
 	return tokenStr, claims, nil
 }
 
+// CreateIDToken signs an OpenID Connect ID token for audience, the client ID.
+func (maker *JWTMaker) CreateIDToken(subject, audience string, duration time.Duration, claims *IDTokenClaims) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    maker.issuer,
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+	}
+	return maker.signClaims(claims)
+}
+
+func (maker *JWTMaker) signClaims(claims jwt.Claims) (string, error) {
+	key := maker.keyring.Active()
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	tokenStr, err := token.SignedString(key.Signer)
+	if err != nil {
+		return "", fmt.Errorf("error signing token: %w", err)
+	}
+	return tokenStr, nil
+}
+
 func (maker *JWTMaker) VerfiyToken(tokenStr string) (*UserClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenStr, &UserClaims{}, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+		kid, _ := token.Header["kid"].(string)
+		key, ok := maker.keyring.Key(kid)
 		if !ok {
+			return nil, fmt.Errorf("unknown signing key")
+		}
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("invalid token signing method")
 		}
-		return []byte(maker.secretKey), nil
-	})
+		return key.Public(), nil
+	}, jwt.WithIssuer(maker.issuer))
 	if err != nil {
 		return nil, fmt.Errorf("error parsing token: %w", err)
 	}
@@ -49,3 +141,15 @@ func (maker *JWTMaker) VerfiyToken(tokenStr string) (*UserClaims, error) {
 	}
 	return claims, nil
 }
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmES256:
+		return jwt.SigningMethodES256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, ErrUnknownAlgorithm
+}
@@ -0,0 +1,382 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/pkg/config"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+	// keyCheckInterval is how often Run picks up keys written by other
+	// instances and rotates when the active key is due.
+	keyCheckInterval = time.Minute
+	pemCreatedHeader = "Created"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown JWT signing algorithm")
+	ErrUnsupportedKey   = errors.New("unsupported JWT signing key")
+)
+
+// Key is a signing key of the keyring. Its public half verifies tokens for
+// as long as the keyring keeps it.
+type Key struct {
+	ID        string
+	Algorithm string
+	Signer    crypto.Signer
+	CreatedAt time.Time
+	path      string // the PEM file, if the key is stored
+}
+
+func (k *Key) Public() crypto.PublicKey {
+	return k.Signer.Public()
+}
+
+// Keyring holds the key tokens are signed with and the retired keys whose
+// tokens may still be around. Keys live as PEM files in a directory: any
+// PKCS#8, PKCS#1 or SEC 1 private key placed there is loaded, and generated
+// keys are written there. Without a directory keys only live in memory.
+//
+// The newest key signs. Once it is older than the rotation interval, or was
+// made for another algorithm than the configured one, a new key takes over;
+// the old one keeps verifying for the retention period, the lifetime of the
+// longest lived token, and is then deleted.
+type Keyring struct {
+	mu               sync.RWMutex
+	algorithm        string
+	dir              string
+	rotationInterval time.Duration
+	retention        time.Duration
+	keys             []*Key // oldest first
+	loadedAt         time.Time
+}
+
+func NewKeyring(cfg *config.Config) (*Keyring, error) {
+	if _, err := signingMethod(cfg.JWTAlgorithm); err != nil {
+		return nil, err
+	}
+	k := &Keyring{
+		algorithm:        cfg.JWTAlgorithm,
+		dir:              cfg.JWTKeyDir,
+		rotationInterval: time.Duration(cfg.JWTKeyRotationInterval) * time.Second,
+		retention:        time.Duration(cfg.JWTExpiration) * time.Second,
+	}
+	if k.dir != "" {
+		if err := os.MkdirAll(k.dir, 0o700); err != nil {
+			return nil, fmt.Errorf("error creating key directory: %w", err)
+		}
+	}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	if err := k.RotateIfDue(time.Now()); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Active returns the key new tokens are signed with.
+func (k *Keyring) Active() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[len(k.keys)-1]
+}
+
+// Key looks a key up by ID. An unknown ID may belong to a key another
+// instance just generated, so the directory is read again, at most once per
+// keyCheckInterval.
+func (k *Keyring) Key(id string) (*Key, bool) {
+	if key, ok := k.find(id); ok {
+		return key, true
+	}
+	k.mu.RLock()
+	stale := k.dir != "" && time.Since(k.loadedAt) >= keyCheckInterval
+	k.mu.RUnlock()
+	if !stale {
+		return nil, false
+	}
+	if err := k.reload(); err != nil {
+		log.Printf("failed to reload JWT keys: %v", err)
+	}
+	return k.find(id)
+}
+
+func (k *Keyring) find(id string) (*Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns every key that still verifies tokens, oldest first.
+func (k *Keyring) Keys() []*Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return slices.Clone(k.keys)
+}
+
+// RotateIfDue rotates when the active key has served its interval or was
+// made for another algorithm, and drops keys whose tokens have all expired.
+func (k *Keyring) RotateIfDue(now time.Time) error {
+	k.mu.RLock()
+	due := len(k.keys) == 0
+	if !due {
+		active := k.keys[len(k.keys)-1]
+		due = active.Algorithm != k.algorithm ||
+			(k.rotationInterval > 0 && now.Sub(active.CreatedAt) >= k.rotationInterval)
+	}
+	k.mu.RUnlock()
+	if due {
+		if err := k.Rotate(); err != nil {
+			return err
+		}
+	}
+	k.prune(now)
+	return nil
+}
+
+// Rotate generates a key that replaces the active one for signing.
+func (k *Keyring) Rotate() error {
+	key, err := generateKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+	if k.dir != "" {
+		if err := writeKey(k.dir, key); err != nil {
+			return err
+		}
+	}
+	k.mu.Lock()
+	k.keys = append(k.keys, key)
+	k.mu.Unlock()
+	log.Printf("rotated JWT signing key, new key %s (%s)", key.ID, key.Algorithm)
+	return nil
+}
+
+// prune drops keys retired for longer than the retention period. A key
+// retires when the next one is created.
+func (k *Keyring) prune(now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	kept := k.keys[:0]
+	for i, key := range k.keys {
+		if i+1 < len(k.keys) && now.Sub(k.keys[i+1].CreatedAt) > k.retention {
+			if key.path != "" {
+				if err := os.Remove(key.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+					log.Printf("failed to delete retired JWT key %s: %v", key.ID, err)
+				}
+			}
+			continue
+		}
+		kept = append(kept, key)
+	}
+	k.keys = kept
+}
+
+// Run rotates keys on schedule and picks up keys written by other instances
+// sharing the directory, until ctx is done.
+func (k *Keyring) Run(ctx context.Context) {
+	ticker := time.NewTicker(keyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := k.reload(); err != nil {
+				log.Printf("failed to reload JWT keys: %v", err)
+			}
+			if err := k.RotateIfDue(now); err != nil {
+				log.Printf("failed to rotate JWT signing key: %v", err)
+			}
+		}
+	}
+}
+
+// reload merges the keys found in the directory into the keyring.
+func (k *Keyring) reload() error {
+	if k.dir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(k.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	loaded := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		key, err := readKey(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// Pruned by another instance in the meantime.
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error loading JWT key %s: %w", path, err)
+		}
+		loaded = append(loaded, key)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, key := range loaded {
+		if !slices.ContainsFunc(k.keys, func(known *Key) bool { return known.ID == key.ID }) {
+			k.keys = append(k.keys, key)
+		}
+	}
+	slices.SortStableFunc(k.keys, func(a, b *Key) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	k.loadedAt = time.Now()
+	return nil
+}
+
+func generateKey(algorithm string) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error generating JWT key: %w", err)
+	}
+	return newKey(signer, time.Now().UTC().Truncate(time.Second))
+}
+
+// newKey identifies a key by the thumbprint of its public JWK, so the same
+// key gets the same ID on every instance.
+func newKey(signer crypto.Signer, createdAt time.Time) (*Key, error) {
+	key := &Key{Signer: signer, CreatedAt: createdAt}
+	switch priv := signer.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgorithmRS256
+	case *ecdsa.PrivateKey:
+		if priv.Curve != elliptic.P256() {
+			return nil, ErrUnsupportedKey
+		}
+		key.Algorithm = AlgorithmES256
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgorithmEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	id, err := thumbprint(key)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = id
+	return key, nil
+}
+
+// writeKey stores the key as PKCS#8 with its creation time in a PEM header.
+// The file is renamed into place so other instances never read half of it.
+func writeKey(dir string, key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.Signer)
+	if err != nil {
+		return fmt.Errorf("error encoding JWT key: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".key-*")
+	if err != nil {
+		return fmt.Errorf("error writing JWT key: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	err = pem.Encode(tmp, &pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{pemCreatedHeader: key.CreatedAt.Format(time.RFC3339)},
+		Bytes:   der,
+	})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	path := filepath.Join(dir, key.ID+".pem")
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing JWT key: %w", err)
+	}
+	key.path = path
+	return nil
+}
+
+// readKey loads a private key PEM file. Keys without a Created header, such
+// as ones generated with openssl, count as created when the file was last
+// modified.
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	var createdAt time.Time
+	if created := strings.TrimSpace(block.Headers[pemCreatedHeader]); created != "" {
+		if createdAt, err = time.Parse(time.RFC3339, created); err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", pemCreatedHeader, err)
+		}
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		createdAt = info.ModTime().UTC().Truncate(time.Second)
+	}
+	key, err := newKey(signer, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	key.path = path
+	return key, nil
+}
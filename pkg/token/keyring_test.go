@@ -0,0 +1,177 @@
+package token_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/pkg/config"
+	"github.com/KimNattanan/go-user-service/pkg/token"
+)
+
+const retention = time.Hour
+
+func newKeyring(t *testing.T, algorithm, dir string) *token.Keyring {
+	keyring, err := token.NewKeyring(&config.Config{
+		JWTAlgorithm:  algorithm,
+		JWTKeyDir:     dir,
+		JWTExpiration: int(retention / time.Second),
+	})
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return keyring
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{token.AlgorithmRS256, token.AlgorithmES256, token.AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			maker := token.NewJWTMaker(newKeyring(t, algorithm, ""), "https://auth.example.com")
+			tokenStr, _, err := maker.CreateAccessToken("user-1", "session-1", time.Minute)
+			if err != nil {
+				t.Fatalf("CreateAccessToken: %v", err)
+			}
+			claims, err := maker.VerfiyToken(tokenStr)
+			if err != nil {
+				t.Fatalf("VerfiyToken: %v", err)
+			}
+			if claims.ID != "user-1" || claims.SessionID != "session-1" || claims.Issuer != "https://auth.example.com" {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+
+			parts := strings.Split(tokenStr, ".")
+			parts[1] = parts[1][:len(parts[1])-2] + "AA"
+			if _, err := maker.VerfiyToken(strings.Join(parts, ".")); err == nil {
+				t.Error("expected a tampered token to be rejected")
+			}
+		})
+	}
+}
+
+func TestRejectsOtherKeyring(t *testing.T) {
+	maker := token.NewJWTMaker(newKeyring(t, token.AlgorithmEdDSA, ""), "issuer")
+	other := token.NewJWTMaker(newKeyring(t, token.AlgorithmEdDSA, ""), "issuer")
+	tokenStr, _, err := other.CreateToken("user-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if _, err := maker.VerfiyToken(tokenStr); err == nil {
+		t.Error("expected a token signed with an unknown key to be rejected")
+	}
+}
+
+func TestKeysArePersisted(t *testing.T) {
+	dir := t.TempDir()
+	first := newKeyring(t, token.AlgorithmES256, dir)
+	tokenStr, _, err := token.NewJWTMaker(first, "issuer").CreateToken("user-1", time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	second := newKeyring(t, token.AlgorithmES256, dir)
+	if second.Active().ID != first.Active().ID {
+		t.Errorf("expected the stored key %s to be reused, got %s", first.Active().ID, second.Active().ID)
+	}
+	if _, err := token.NewJWTMaker(second, "issuer").VerfiyToken(tokenStr); err != nil {
+		t.Errorf("expected the token to verify after a restart: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, first.Active().ID+".pem"))
+	if err != nil {
+		t.Fatalf("expected the key file to exist: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the key file to be private, got %v", info.Mode().Perm())
+	}
+}
+
+func TestRotationKeepsRetiredKeysUntilTheirTokensExpire(t *testing.T) {
+	dir := t.TempDir()
+	keyring := newKeyring(t, token.AlgorithmEdDSA, dir)
+	maker := token.NewJWTMaker(keyring, "issuer")
+	old := keyring.Active()
+	oldToken, _, err := maker.CreateToken("user-1", retention)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	if err := keyring.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if keyring.Active().ID == old.ID {
+		t.Fatal("expected a new active key")
+	}
+	newToken, _, err := maker.CreateToken("user-1", retention)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	for _, tokenStr := range []string{oldToken, newToken} {
+		if _, err := maker.VerfiyToken(tokenStr); err != nil {
+			t.Errorf("expected the token to verify: %v", err)
+		}
+	}
+	set, err := maker.JWKS()
+	if err != nil || len(set.Keys) != 2 {
+		t.Fatalf("expected both keys to be published, got %+v, %v", set, err)
+	}
+
+	if err := keyring.RotateIfDue(time.Now().Add(retention + time.Minute)); err != nil {
+		t.Fatalf("RotateIfDue: %v", err)
+	}
+	if _, ok := keyring.Key(old.ID); ok {
+		t.Error("expected the retired key to be dropped")
+	}
+	if _, err := os.Stat(filepath.Join(dir, old.ID+".pem")); !os.IsNotExist(err) {
+		t.Errorf("expected the retired key file to be deleted, got %v", err)
+	}
+	if _, err := maker.VerfiyToken(newToken); err != nil {
+		t.Errorf("expected the active key to keep verifying: %v", err)
+	}
+}
+
+func TestAlgorithmChangeRotates(t *testing.T) {
+	dir := t.TempDir()
+	newKeyring(t, token.AlgorithmES256, dir)
+	keyring := newKeyring(t, token.AlgorithmEdDSA, dir)
+	if keyring.Active().Algorithm != token.AlgorithmEdDSA {
+		t.Errorf("expected an EdDSA key to take over, got %s", keyring.Active().Algorithm)
+	}
+	if len(keyring.Keys()) != 2 {
+		t.Errorf("expected the ES256 key to stay for verification, got %d keys", len(keyring.Keys()))
+	}
+}
+
+func TestLoadsProvidedKey(t *testing.T) {
+	dir := t.TempDir()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	if err := os.WriteFile(filepath.Join(dir, "signing.pem"), data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	keyring := newKeyring(t, token.AlgorithmRS256, dir)
+	if len(keyring.Keys()) != 1 || !priv.PublicKey.Equal(keyring.Active().Public()) {
+		t.Fatal("expected the provided key to be used")
+	}
+	jwk, err := keyring.Active().JWK()
+	if err != nil {
+		t.Fatalf("JWK: %v", err)
+	}
+	if jwk.KeyType != "RSA" || jwk.KeyID != keyring.Active().ID || jwk.E != "AQAB" {
+		t.Errorf("unexpected JWK %+v", jwk)
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	if _, err := token.NewKeyring(&config.Config{JWTAlgorithm: "HS256"}); err != token.ErrUnknownAlgorithm {
+		t.Errorf("expected ErrUnknownAlgorithm, got %v", err)
+	}
+}
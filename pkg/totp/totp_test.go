@@ -0,0 +1,55 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/KimNattanan/go-user-service/pkg/totp"
+)
+
+// RFC 6238 appendix B vectors for SHA1, truncated to 6 digits.
+func TestGenerateCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := totp.GenerateCode(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("at %d: expected %s, got %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	now := time.Now()
+	previous, _ := totp.GenerateCode(secret, now.Add(-totp.Period*time.Second))
+
+	if _, ok := totp.Validate(secret, previous, now, 1); !ok {
+		t.Errorf("expected code from previous step to be accepted with skew 1")
+	}
+	if _, ok := totp.Validate(secret, previous, now, 0); ok {
+		t.Errorf("expected code from previous step to be rejected with skew 0")
+	}
+	if _, ok := totp.Validate(secret, "12345", now, 1); ok {
+		t.Errorf("expected short code to be rejected")
+	}
+}